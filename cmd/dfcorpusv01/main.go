@@ -5,9 +5,12 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rickhallett/darkfactorio/internal/dfcorpus"
+	"github.com/rickhallett/darkfactorio/internal/gatereport"
 	"github.com/rickhallett/darkfactorio/internal/level4gate"
 )
 
@@ -23,31 +26,83 @@ func run(args []string) int {
 	var criteriaPath string
 	var output string
 	var windows string
+	var duplicates string
+	var runsDir string
+	var from, to, last string
+	var rollingWidth, rollingStep string
+	var reversalsPath, reversalsAsOf string
+	var incidentsPath string
 
-	fs.StringVar(&inputs, "inputs", "", "comma-separated NDJSON files (required)")
+	fs.StringVar(&inputs, "inputs", "", "comma-separated NDJSON files (required unless --runs-dir)")
+	fs.StringVar(&runsDir, "runs-dir", "", "evaluate every *.ndjson window file in this directory")
 	fs.StringVar(&criteriaPath, "criteria", "profiles/level4-gate-v0.1-adversarial.json", "criteria profile JSON path")
-	fs.StringVar(&output, "output", "text", "output format: text|json")
+	fs.StringVar(&output, "output", "text", "output format: text|json|markdown|html (text|json with --rolling-width)")
 	fs.StringVar(&windows, "windows", "", "optional comma-separated window_id filter")
+	fs.StringVar(&from, "from", "", "RFC3339 start of the time range (inclusive)")
+	fs.StringVar(&to, "to", "", "RFC3339 end of the time range (exclusive; default now with --last or rolling)")
+	fs.StringVar(&last, "last", "", "time range ending at --to, e.g. 14d or 36h; replaces --from")
+	fs.StringVar(&rollingWidth, "rolling-width", "", "evaluate a rolling window of this width, e.g. 7d; needs a time range")
+	fs.StringVar(&rollingStep, "rolling-step", "1d", "step between rolling windows")
+	fs.StringVar(&duplicates, "duplicates", level4gate.DuplicateError, "policy for repeated (window_id, run_id): "+strings.Join(level4gate.DuplicatePolicies(), "|"))
+	fs.StringVar(&reversalsPath, "reversals", "", "optional NDJSON stream of decision reversal events to join against the records")
+	fs.StringVar(&reversalsAsOf, "reversals-as-of", "", "RFC3339 time; ignore reversal events made after it")
+	fs.StringVar(&incidentsPath, "incidents", "", "optional NDJSON incident file linking incidents to run IDs")
 
 	if err := fs.Parse(args); err != nil {
 		return 1
 	}
-	if strings.TrimSpace(inputs) == "" {
-		fmt.Fprintln(os.Stderr, "error: --inputs is required")
+	paths := splitCSV(inputs)
+	if runsDir != "" {
+		found, err := dfcorpus.InputsInDir(runsDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		paths = append(paths, found...)
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "error: --inputs or --runs-dir is required")
+		return 1
+	}
+
+	start, end, err := timeRange(from, to, last, rollingWidth != "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		return 1
 	}
 
-	criteria, err := loadCriteria(criteriaPath)
+	criteria, err := level4gate.LoadCriteria(criteriaPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: loading criteria: %v\n", err)
 		return 1
 	}
 
-	res, err := dfcorpus.Replay(dfcorpus.ReplayOptions{
-		Inputs:       splitCSV(inputs),
+	reversals, err := loadReversals(reversalsPath, reversalsAsOf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	replay := dfcorpus.ReplayOptions{
+		Inputs:       paths,
 		WindowFilter: asSet(splitCSV(windows)),
+		From:         start,
+		To:           end,
 		Criteria:     criteria,
-	})
+		Duplicates:   duplicates,
+		Reversals:    reversals,
+	}
+	if incidentsPath != "" {
+		if replay.Incidents, err = level4gate.LoadIncidents(incidentsPath); err != nil {
+			fmt.Fprintf(os.Stderr, "error: loading incidents: %v\n", err)
+			return 1
+		}
+	}
+	if rollingWidth != "" {
+		return runRolling(replay, rollingWidth, rollingStep, output)
+	}
+
+	res, err := dfcorpus.Replay(replay)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		return 1
@@ -61,30 +116,136 @@ func run(args []string) int {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			return 1
 		}
+	case "markdown", "html":
+		if err := gatereport.Render(os.Stdout, output, res.Report); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
 	default:
-		printText(res.Report, len(res.Records))
+		printText(res.Report, res.RecordCount, res.DuplicatesDropped)
 	}
 
 	if !res.Report.Passed {
 		return 2
 	}
+	if len(res.Report.Warnings) > 0 {
+		return 3
+	}
 	return 0
 }
 
-func loadCriteria(path string) (level4gate.Criteria, error) {
-	f, err := os.Open(path)
+func runRolling(replay dfcorpus.ReplayOptions, width, step, output string) int {
+	w, err := parseSpan(width)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: invalid --rolling-width: %v\n", err)
+		return 1
+	}
+	st, err := parseSpan(step)
 	if err != nil {
-		return level4gate.Criteria{}, err
+		fmt.Fprintf(os.Stderr, "error: invalid --rolling-step: %v\n", err)
+		return 1
 	}
-	defer f.Close()
-	var c level4gate.Criteria
-	if err := json.NewDecoder(f).Decode(&c); err != nil {
-		return level4gate.Criteria{}, err
+	res, err := dfcorpus.Rolling(dfcorpus.RollingOptions{ReplayOptions: replay, Width: w, Step: st})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
 	}
-	if c.MinRuns <= 0 {
-		return level4gate.Criteria{}, fmt.Errorf("min_runs must be > 0")
+
+	switch output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+	default:
+		printRolling(res)
 	}
-	return c, nil
+
+	latest := res.Points[len(res.Points)-1]
+	if !latest.Passed {
+		return 2
+	}
+	if latest.Report != nil && len(latest.Report.Warnings) > 0 {
+		return 3
+	}
+	return 0
+}
+
+// timeRange resolves --from, --to and --last. --to defaults to now when a
+// range is implied by --last or rolling mode.
+func timeRange(from, to, last string, rolling bool) (time.Time, time.Time, error) {
+	var start, end time.Time
+	if from != "" && last != "" {
+		return start, end, fmt.Errorf("--from and --last are mutually exclusive")
+	}
+	if to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return start, end, fmt.Errorf("invalid --to: %w", err)
+		}
+		end = t
+	} else if last != "" || rolling {
+		end = time.Now().UTC()
+	}
+	if from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return start, end, fmt.Errorf("invalid --from: %w", err)
+		}
+		start = t
+	}
+	if last != "" {
+		d, err := parseSpan(last)
+		if err != nil {
+			return start, end, fmt.Errorf("invalid --last: %w", err)
+		}
+		start = end.Add(-d)
+	}
+	return start, end, nil
+}
+
+// loadReversals reads the --reversals stream, keeping the events made at
+// or before --reversals-as-of when it is set.
+func loadReversals(path, asOf string) (*level4gate.ReversalLog, error) {
+	if path == "" {
+		if asOf != "" {
+			return nil, fmt.Errorf("--reversals-as-of needs --reversals")
+		}
+		return nil, nil
+	}
+	log, err := level4gate.LoadReversals(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading reversals: %w", err)
+	}
+	if asOf != "" {
+		t, err := time.Parse(time.RFC3339, asOf)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --reversals-as-of: %w", err)
+		}
+		log = log.AsOf(t)
+	}
+	return log, nil
+}
+
+// parseSpan accepts Go durations plus a whole-day suffix, e.g. 14d.
+func parseSpan(raw string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("%q is not a positive number of days", raw)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%q must be positive", raw)
+	}
+	return d, nil
 }
 
 func splitCSV(raw string) []string {
@@ -114,9 +275,10 @@ func asSet(vals []string) map[string]struct{} {
 	return out
 }
 
-func printText(report level4gate.GateReport, corpusSize int) {
+func printText(report level4gate.GateReport, corpusSize int, duplicatesDropped int) {
 	fmt.Printf("darkfactorio corpus gate\n")
 	fmt.Printf("records: %d\n", corpusSize)
+	fmt.Printf("duplicates_dropped: %d\n", duplicatesDropped)
 	fmt.Printf("passed: %v\n", report.Passed)
 	fmt.Printf("run_count: %d\n", report.Metrics.RunCount)
 	fmt.Printf("run_count_by_class: %v\n", report.Metrics.RunCountByClass)
@@ -124,7 +286,33 @@ func printText(report level4gate.GateReport, corpusSize int) {
 	fmt.Printf("first_pass_rate: %.2f%%\n", report.Metrics.FirstPassRatePercent)
 	fmt.Printf("mean_retries: %.2f\n", report.Metrics.MeanRetries)
 	fmt.Printf("decision_reversal_rate: %.2f%%\n", report.Metrics.DecisionReversalPercent)
+	if rv := report.Metrics.Reversals; rv != nil {
+		fmt.Printf(
+			"reversals: events=%d approved=%.2f%% rejected=%.2f%% latency_hours_p95=%.1f conflicts=%d\n",
+			rv.Events, rv.ApprovedReversalPercent, rv.RejectedReversalPercent, rv.LatencyHours.P95, rv.Conflicts,
+		)
+	}
 	fmt.Printf("approved_run_critical_incidents: %d\n", report.Metrics.ApprovedRunCriticalIncidents)
+	if inc := report.Metrics.Incidents; inc != nil {
+		fmt.Printf("incidents: count=%d by_severity=%v mean_time_to_detect_hours=%.1f conflicts=%d\n", inc.Count, inc.BySeverity, inc.TimeToDetectHours.Mean, inc.Conflicts)
+	}
+	for _, c := range report.Classes {
+		fmt.Printf(
+			"class[%s]: passed=%v run_count=%d scenario_pass_rate=%.2f%% first_pass_rate=%.2f%% mean_retries=%.2f\n",
+			c.PipelineClass,
+			c.Passed,
+			c.Metrics.RunCount,
+			c.Metrics.ScenarioPassRatePercent,
+			c.Metrics.FirstPassRatePercent,
+			c.Metrics.MeanRetries,
+		)
+	}
+	if len(report.Warnings) > 0 {
+		fmt.Println("warnings:")
+		for _, w := range report.Warnings {
+			fmt.Printf("- %s\n", w)
+		}
+	}
 	if len(report.Failures) > 0 {
 		fmt.Println("failures:")
 		for _, f := range report.Failures {
@@ -132,3 +320,28 @@ func printText(report level4gate.GateReport, corpusSize int) {
 		}
 	}
 }
+
+func printRolling(res dfcorpus.RollingResult) {
+	fmt.Printf("darkfactorio corpus rolling gate\n")
+	fmt.Printf("duplicates_dropped: %d\n", res.DuplicatesDropped)
+	for _, p := range res.Points {
+		failures := 0
+		if p.Report != nil {
+			failures = len(p.Report.Failures)
+		}
+		fmt.Printf(
+			"%s/%s records=%d passed=%v failures=%d\n",
+			p.From.Format(time.RFC3339),
+			p.To.Format(time.RFC3339),
+			p.RecordCount,
+			p.Passed,
+			failures,
+		)
+	}
+	if res.FirstPassed == nil {
+		fmt.Println("first_passed: never")
+	} else {
+		fmt.Printf("first_passed: %s\n", res.FirstPassed.Format(time.RFC3339))
+	}
+	fmt.Printf("stayed_green: %v\n", res.StayedGreen)
+}
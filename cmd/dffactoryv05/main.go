@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/rickhallett/darkfactorio/internal/cireport"
 	"github.com/rickhallett/darkfactorio/internal/factoryv05"
 )
 
@@ -17,7 +18,7 @@ func run(args []string) int {
 	fs := flag.NewFlagSet("dffactoryv05", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
 	bundle := fs.String("bundle", "factory/v0.5/examples/bundle.json", "bundle JSON path")
-	output := fs.String("output", "text", "output format: text|json")
+	output := fs.String("output", "text", "output format: text|json|junit|sarif")
 	if err := fs.Parse(args); err != nil {
 		return 1
 	}
@@ -32,6 +33,11 @@ func run(args []string) int {
 		enc := json.NewEncoder(os.Stdout)
 		enc.SetIndent("", "  ")
 		_ = enc.Encode(rep)
+	case "junit", "sarif":
+		if err := cireport.Write(os.Stdout, *output, cireport.FromBundle("dffactoryv05", *bundle, rep)); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
 	default:
 		fmt.Printf("factory bundle: %s\n", rep.BundleRef)
 		fmt.Printf("passed: %v\n", rep.Passed)
@@ -137,6 +137,10 @@ func runCheck(args []string) int {
 	}
 
 	fmt.Println("learning gate: FAIL")
+	if len(result.MalformedCloseouts) > 0 {
+		fmt.Printf("closeout records missing required sections: %s\n", strings.Join(result.MalformedCloseouts, ", "))
+		return 1
+	}
 	fmt.Printf("substantive changes without learning log updates: %s\n", strings.Join(result.SubstantiveChanged, ", "))
 	if len(result.LearningChanged) == 0 {
 		fmt.Println("required: update learning/journal/* or learning/decisions/* in same change set")
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/rickhallett/darkfactorio/internal/cireport"
 	"github.com/rickhallett/darkfactorio/internal/shadowpack"
 )
 
@@ -17,7 +18,7 @@ func run(args []string) int {
 	fs := flag.NewFlagSet("dfshadowv01", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
 	manifest := fs.String("manifest", "shadowpacks/examples/manifest.json", "shadow pack manifest path")
-	output := fs.String("output", "text", "output format: text|json")
+	output := fs.String("output", "text", "output format: text|json|junit|sarif")
 	if err := fs.Parse(args); err != nil {
 		return 1
 	}
@@ -33,6 +34,11 @@ func run(args []string) int {
 		enc := json.NewEncoder(os.Stdout)
 		enc.SetIndent("", "  ")
 		_ = enc.Encode(rep)
+	case "junit", "sarif":
+		if err := cireport.Write(os.Stdout, *output, cireport.FromShadow("dfshadowv01", *manifest, rep)); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
 	default:
 		fmt.Printf("shadow pack: %s\n", rep.PackID)
 		fmt.Printf("passed: %v\n", rep.Passed)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
@@ -14,11 +15,25 @@ func main() {
 }
 
 func run(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "open", "freeze", "close", "backfill", "verify":
+			return runLifecycle(args[0], args[1:])
+		case "closeout":
+			return runCloseout(args[1:])
+		}
+	}
 	fs := flag.NewFlagSet("dfwindowv01", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
 
 	var windowID string
 	var runsPath string
+	var synthetic bool
+	var envelopes string
+	var shadowPack string
+	var class string
+	var retries int
+	var interventions int
 	var appendCount int
 	var logLearning bool
 	var start string
@@ -27,17 +42,25 @@ func run(args []string) int {
 	var adversarial string
 	var quality string
 	var qualityReason string
+	var target int
 
 	fs.StringVar(&windowID, "window", "", "window id (required)")
 	fs.StringVar(&runsPath, "runs", "", "runs NDJSON path (default runs/<window>.ndjson)")
-	fs.IntVar(&appendCount, "append", 2, "number of runs to append")
+	fs.StringVar(&envelopes, "envelopes", "", "ingest a run envelope JSON file or a directory of envelopes")
+	fs.StringVar(&shadowPack, "shadow-pack", "", "ingest a shadow-pack manifest as one run (requires --class, --retries and --interventions)")
+	fs.StringVar(&class, "class", "", "pipeline class for --shadow-pack runs")
+	fs.IntVar(&retries, "retries", -1, "retries the --shadow-pack run took")
+	fs.IntVar(&interventions, "interventions", -1, "human interventions in the --shadow-pack run")
+	fs.BoolVar(&synthetic, "synthetic", false, "append generated records instead of real run outcomes (labelled SYNTHETIC in the learning entry)")
+	fs.IntVar(&appendCount, "append", 2, "number of synthetic runs to append")
 	fs.BoolVar(&logLearning, "log-learning", true, "append learning journal entry")
 	fs.StringVar(&start, "start", "", "RFC3339 start time for first appended run (default now UTC)")
 	fs.StringVar(&interval, "interval", "15m", "duration between appended runs")
 	fs.StringVar(&baseline, "baseline", "profiles/level4-gate-v0.1-baseline.json", "baseline criteria path")
 	fs.StringVar(&adversarial, "adversarial", "profiles/level4-gate-v0.1-adversarial.json", "adversarial criteria path")
-	fs.StringVar(&quality, "quality", "standard", "run quality mode: standard|high")
+	fs.StringVar(&quality, "quality", "standard", "synthetic run quality mode: standard|high")
 	fs.StringVar(&qualityReason, "quality-reason", "", "required when --quality high; why remediation mode is justified")
+	fs.IntVar(&target, "target", 0, "window size that triggers a closeout record (default baseline min_runs; -1 disables)")
 
 	if err := fs.Parse(args); err != nil {
 		return 1
@@ -47,6 +70,26 @@ func run(args []string) int {
 		return 1
 	}
 
+	var source dfwindow.Source
+	switch {
+	case envelopes != "" && shadowPack != "":
+		fmt.Fprintln(os.Stderr, "error: use one of --envelopes and --shadow-pack")
+		return 1
+	case envelopes != "":
+		source = dfwindow.Source{Kind: dfwindow.SourceEnvelopes, Path: envelopes}
+	case shadowPack != "":
+		source = dfwindow.Source{Kind: dfwindow.SourceShadowPack, Path: shadowPack, PipelineClass: class}
+		if retries >= 0 {
+			source.Retries = &retries
+		}
+		if interventions >= 0 {
+			source.Interventions = &interventions
+		}
+	case !synthetic:
+		fmt.Fprintln(os.Stderr, "error: --envelopes or --shadow-pack is required (or --synthetic for generated records)")
+		return 1
+	}
+
 	var t time.Time
 	if start != "" {
 		parsed, err := time.Parse(time.RFC3339, start)
@@ -66,6 +109,8 @@ func run(args []string) int {
 		Root:                ".",
 		WindowID:            windowID,
 		RunsPath:            runsPath,
+		Source:              source,
+		Synthetic:           synthetic,
 		AppendCount:         appendCount,
 		StartTime:           t,
 		Interval:            d,
@@ -74,6 +119,7 @@ func run(args []string) int {
 		LogLearning:         logLearning,
 		QualityMode:         quality,
 		QualityReason:       qualityReason,
+		TargetRuns:          target,
 	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
@@ -83,16 +129,161 @@ func run(args []string) int {
 	first := res.Added[0].RunID
 	last := res.Added[len(res.Added)-1].RunID
 	fmt.Printf("window advance complete: %s\n", windowID)
+	if synthetic {
+		fmt.Println("record source: SYNTHETIC (generated, not real run outcomes)")
+	} else {
+		fmt.Printf("record source: %s %s\n", source.Kind, source.Path)
+	}
 	fmt.Printf("runs appended: %d (%s..%s)\n", len(res.Added), first, last)
+	for _, s := range res.Skipped {
+		fmt.Printf("skipped: %s (%s)\n", s.RunID, s.Reason)
+	}
 	fmt.Printf("runs path: %s\n", res.RunsPath)
 	fmt.Printf("baseline: passed=%v run_count=%d scenario_pass=%.2f%%\n", res.BaselineReport.Passed, res.BaselineReport.Metrics.RunCount, res.BaselineReport.Metrics.ScenarioPassRatePercent)
 	fmt.Printf("adversarial: passed=%v run_count=%d scenario_pass=%.2f%%\n", res.AdversarialReport.Passed, res.AdversarialReport.Metrics.RunCount, res.AdversarialReport.Metrics.ScenarioPassRatePercent)
+	if r := res.BaselineReport.Metrics.Remediation; r != nil {
+		fmt.Printf("remediation: high=%d share=%.2f%%\n", r.HighRunCount, r.SharePercent)
+	}
 	if res.LearningEntryPath != "" {
 		fmt.Printf("learning entry: %s\n", res.LearningEntryPath)
 	}
+	if res.CloseoutPath != "" {
+		fmt.Printf("closeout record: %s\n", res.CloseoutPath)
+	}
+	for _, w := range res.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", w)
+	}
 
 	if !res.BaselineReport.Passed {
 		return 2
 	}
 	return 0
 }
+
+// runCloseout writes a window's closeout decision record on demand, for
+// windows that reached their target before closeouts were generated.
+func runCloseout(args []string) int {
+	fs := flag.NewFlagSet("dfwindowv01 closeout", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	var opts dfwindow.CloseoutOptions
+	var when string
+	fs.StringVar(&opts.WindowID, "window", "", "window id (required)")
+	fs.StringVar(&opts.RunsPath, "runs", "", "runs NDJSON path (default runs/<window>.ndjson)")
+	fs.StringVar(&opts.BaselineCriteria, "baseline", "profiles/level4-gate-v0.1-baseline.json", "baseline criteria path")
+	fs.StringVar(&opts.AdversarialCriteria, "adversarial", "profiles/level4-gate-v0.1-adversarial.json", "adversarial criteria path")
+	fs.StringVar(&when, "date", "", "YYYY-MM-DD date for the record filename (default latest run's date)")
+
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if opts.WindowID == "" {
+		fmt.Fprintln(os.Stderr, "error: --window is required")
+		return 1
+	}
+	if when != "" {
+		parsed, err := time.Parse("2006-01-02", when)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid --date: %v\n", err)
+			return 1
+		}
+		opts.When = parsed
+	}
+
+	res, err := dfwindow.Closeout(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("closeout record: %s\n", res.Path)
+	fmt.Printf("promotion: %s\n", res.Promotion)
+	return 0
+}
+
+// runLifecycle moves a window through open, frozen and closed, backfills a
+// manifest for a finished window, or verifies it against its manifest.
+// verify exits 2 when the window no longer matches.
+func runLifecycle(cmd string, args []string) int {
+	fs := flag.NewFlagSet("dfwindowv01 "+cmd, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	var opts dfwindow.LifecycleOptions
+	var at string
+	var output string
+	fs.StringVar(&opts.WindowID, "window", "", "window id (required)")
+	fs.StringVar(&opts.RunsPath, "runs", "", "runs NDJSON path (default runs/<window>.ndjson)")
+	if cmd != "backfill" {
+		fs.StringVar(&at, "at", "", "RFC3339 time of the transition (default now UTC)")
+	}
+	if cmd == "open" || cmd == "backfill" {
+		fs.StringVar(&opts.BaselineCriteria, "baseline", "profiles/level4-gate-v0.1-baseline.json", "baseline criteria path")
+		fs.StringVar(&opts.AdversarialCriteria, "adversarial", "profiles/level4-gate-v0.1-adversarial.json", "adversarial criteria path")
+	}
+	if cmd == "verify" {
+		fs.StringVar(&output, "output", "text", "output format: text|json")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if opts.WindowID == "" {
+		fmt.Fprintln(os.Stderr, "error: --window is required")
+		return 1
+	}
+	if at != "" {
+		parsed, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid --at: %v\n", err)
+			return 1
+		}
+		opts.At = parsed
+	}
+
+	if cmd == "verify" {
+		if output != "text" && output != "json" {
+			fmt.Fprintln(os.Stderr, "error: --output must be text|json")
+			return 1
+		}
+		res, err := dfwindow.VerifyWindow(opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		if output == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(res); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return 1
+			}
+		} else {
+			fmt.Printf("window: %s state=%s\n", res.Manifest.WindowID, res.Manifest.State)
+			fmt.Printf("runs: %d sha256=%s\n", res.RunCount, res.SHA256)
+			fmt.Printf("intact: %v\n", len(res.Problems) == 0)
+			for _, p := range res.Problems {
+				fmt.Printf("- %s\n", p)
+			}
+		}
+		if len(res.Problems) > 0 {
+			return 2
+		}
+		return 0
+	}
+
+	transitions := map[string]func(dfwindow.LifecycleOptions) (dfwindow.Manifest, error){
+		"open":     dfwindow.OpenWindow,
+		"freeze":   dfwindow.FreezeWindow,
+		"close":    dfwindow.CloseWindow,
+		"backfill": dfwindow.BackfillWindow,
+	}
+	m, err := transitions[cmd](opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("window %s: %s\n", m.WindowID, m.State)
+	if m.ContentSHA256 != "" {
+		fmt.Printf("runs: %d sha256=%s\n", m.RunCount, m.ContentSHA256)
+	}
+	return 0
+}
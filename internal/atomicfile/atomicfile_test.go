@@ -0,0 +1,29 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteReplacesFileAndLeavesNoTemp(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "runs.ndjson")
+	if err := os.WriteFile(path, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(path, []byte("new\n"), 0o640); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil || string(b) != "new\n" {
+		t.Fatalf("unexpected content %q: %v", b, err)
+	}
+	if st, _ := os.Stat(path); st.Mode().Perm() != 0o640 {
+		t.Fatalf("expected mode 0640, got %v", st.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("expected only the target file, found %d entries", len(entries))
+	}
+}
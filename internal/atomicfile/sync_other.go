@@ -0,0 +1,8 @@
+//go:build !unix
+
+package atomicfile
+
+// syncDir is a no-op where directories cannot be opened for syncing.
+func syncDir(string) error {
+	return nil
+}
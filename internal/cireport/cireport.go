@@ -0,0 +1,205 @@
+// Package cireport writes gate, bundle and shadow-pack results in the
+// formats CI systems read natively: JUnit XML, where each check is a
+// testcase, and SARIF 2.1.0, where each check is a result on the input
+// file, so failures surface as annotations without custom parsing.
+package cireport
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Check statuses. A warn check passes in JUnit and is a SARIF warning.
+const (
+	StatusPass = "pass"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// Check is one rule, bundle check or criterion.
+type Check struct {
+	ID      string
+	Status  string
+	Message string
+}
+
+// Suite is the result of one command run. Artifact is the input the checks
+// were run against; SARIF results point at it.
+type Suite struct {
+	Name     string
+	Artifact string
+	Checks   []Check
+}
+
+// Formats lists the values Write accepts.
+func Formats() []string {
+	return []string{"junit", "sarif"}
+}
+
+// Write writes s as junit or sarif.
+func Write(w io.Writer, format string, s Suite) error {
+	switch format {
+	case "junit":
+		return WriteJUnit(w, s)
+	case "sarif":
+		return WriteSARIF(w, s)
+	}
+	return fmt.Errorf("unknown CI report format %q (want %s)", format, strings.Join(Formats(), "|"))
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name       `xml:"testsuites"`
+	Name     string         `xml:"name,attr"`
+	Tests    int            `xml:"tests,attr"`
+	Failures int            `xml:"failures,attr"`
+	Suites   []junitTestSet `xml:"testsuite"`
+}
+
+type junitTestSet struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes s as a single JUnit testsuite. Warnings are passing
+// testcases with the message in system-out.
+func WriteJUnit(w io.Writer, s Suite) error {
+	set := junitTestSet{Name: s.Name, Tests: len(s.Checks)}
+	for _, c := range s.Checks {
+		tc := junitTestCase{Name: c.ID, Classname: s.Name, File: s.Artifact}
+		switch c.Status {
+		case StatusFail:
+			set.Failures++
+			tc.Failure = &junitFailure{Message: c.Message, Type: "gate", Text: c.Message}
+		case StatusWarn:
+			tc.SystemOut = "warning: " + c.Message
+		}
+		set.Cases = append(set.Cases, tc)
+	}
+	doc := junitTestSuites{Name: s.Name, Tests: set.Tests, Failures: set.Failures, Suites: []junitTestSet{set}}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Kind      string          `json:"kind"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// WriteSARIF writes s as one SARIF run. Every check is a result: passing
+// checks have kind "pass" and level "none", so the log records what was
+// checked as well as what failed.
+func WriteSARIF(w io.Writer, s Suite) error {
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: s.Name, Rules: []sarifRule{}}},
+		Results: []sarifResult{},
+	}
+	ruleIndex := map[string]int{}
+	for _, c := range s.Checks {
+		idx, ok := ruleIndex[c.ID]
+		if !ok {
+			idx = len(run.Tool.Driver.Rules)
+			ruleIndex[c.ID] = idx
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: c.ID, ShortDescription: sarifMessage{Text: c.ID}})
+		}
+		res := sarifResult{RuleID: c.ID, RuleIndex: idx, Kind: "pass", Level: "none", Message: sarifMessage{Text: c.Message}}
+		switch c.Status {
+		case StatusFail:
+			res.Kind, res.Level = "fail", "error"
+		case StatusWarn:
+			res.Kind, res.Level = "fail", "warning"
+		}
+		if s.Artifact != "" {
+			res.Locations = []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: s.Artifact},
+				Region:           sarifRegion{StartLine: 1},
+			}}}
+		}
+		run.Results = append(run.Results, res)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
@@ -0,0 +1,139 @@
+package cireport
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rickhallett/darkfactorio/internal/factoryv05"
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+	"github.com/rickhallett/darkfactorio/internal/shadowpack"
+)
+
+func sampleSuite() Suite {
+	return Suite{
+		Name:     "dfgate",
+		Artifact: "runs/w.ndjson",
+		Checks: []Check{
+			{ID: "run_count", Status: StatusPass, Message: "run_count 20 >= 20"},
+			{ID: "mean_retries", Status: StatusWarn, Message: "mean_retries 1.90 <= 2.00 (within 0.20 of threshold)"},
+			{ID: "first_pass_rate", Status: StatusFail, Message: "first_pass_rate 50.00 < 60.00"},
+		},
+	}
+}
+
+func TestWriteJUnitMapsFailuresAndWarnings(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, sampleSuite()); err != nil {
+		t.Fatalf("WriteJUnit error: %v", err)
+	}
+	var doc junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not XML: %v\n%s", err, buf.String())
+	}
+	if doc.Tests != 3 || doc.Failures != 1 || len(doc.Suites) != 1 {
+		t.Fatalf("unexpected totals: tests=%d failures=%d suites=%d", doc.Tests, doc.Failures, len(doc.Suites))
+	}
+	cases := doc.Suites[0].Cases
+	if cases[0].Failure != nil || cases[0].SystemOut != "" {
+		t.Fatalf("passing case should be bare: %+v", cases[0])
+	}
+	if cases[1].Failure != nil || !strings.HasPrefix(cases[1].SystemOut, "warning: mean_retries") {
+		t.Fatalf("warn case should pass with a warning: %+v", cases[1])
+	}
+	if cases[2].Failure == nil || cases[2].Failure.Message != "first_pass_rate 50.00 < 60.00" {
+		t.Fatalf("fail case should carry the failure: %+v", cases[2])
+	}
+	if cases[2].File != "runs/w.ndjson" {
+		t.Fatalf("expected file attribute, got %q", cases[2].File)
+	}
+}
+
+func TestWriteSARIFMapsKindsAndLevels(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, sampleSuite()); err != nil {
+		t.Fatalf("WriteSARIF error: %v", err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected log header: %+v", log)
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != 3 || len(run.Results) != 3 {
+		t.Fatalf("expected 3 rules and 3 results, got %d and %d", len(run.Tool.Driver.Rules), len(run.Results))
+	}
+	want := [][2]string{{"pass", "none"}, {"fail", "warning"}, {"fail", "error"}}
+	for i, res := range run.Results {
+		if res.Kind != want[i][0] || res.Level != want[i][1] {
+			t.Fatalf("result %d: got %s/%s, want %s/%s", i, res.Kind, res.Level, want[i][0], want[i][1])
+		}
+		if res.RuleIndex != i || run.Tool.Driver.Rules[i].ID != res.RuleID {
+			t.Fatalf("result %d does not point at its rule: %+v", i, res)
+		}
+		if len(res.Locations) != 1 || res.Locations[0].PhysicalLocation.ArtifactLocation.URI != "runs/w.ndjson" {
+			t.Fatalf("result %d has no artifact location: %+v", i, res.Locations)
+		}
+	}
+}
+
+func TestWriteRejectsUnknownFormat(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, "tap", sampleSuite()); err == nil {
+		t.Fatalf("expected unknown format error")
+	}
+}
+
+func TestFromGateMapsFindingSeverities(t *testing.T) {
+	r := level4gate.GateReport{Findings: []level4gate.Finding{
+		{RuleID: "run_count", Severity: level4gate.FindingInfo, Message: "ok"},
+		{RuleID: "mean_retries", Severity: level4gate.FindingWarn, Message: "close"},
+		{RuleID: "rule[cost]", Severity: level4gate.FindingBlock, Message: "violated"},
+	}}
+	s := FromGate("dfgate", "in.ndjson", r)
+	got := []string{}
+	for _, c := range s.Checks {
+		got = append(got, c.ID+"="+c.Status)
+	}
+	if strings.Join(got, ",") != "run_count=pass,mean_retries=warn,rule[cost]=fail" {
+		t.Fatalf("unexpected checks: %v", got)
+	}
+
+	legacy := FromGate("dfgate", "in.ndjson", level4gate.GateReport{Failures: []string{"run_count below minimum window (need >= 20)"}})
+	if len(legacy.Checks) != 1 || legacy.Checks[0].Status != StatusFail {
+		t.Fatalf("expected failures to map without findings: %+v", legacy.Checks)
+	}
+}
+
+func TestFromBundleAndShadowCoverEveryCheck(t *testing.T) {
+	root := filepath.Join("..", "..")
+	bundle, err := factoryv05.ValidateBundle(root, "factory/v0.5/examples/bundle.json")
+	if err != nil {
+		t.Fatalf("ValidateBundle error: %v", err)
+	}
+	bundle.Failures = append(bundle.Failures, "twin-drift: drift too high")
+	s := FromBundle("dffactoryv05", "bundle.json", bundle)
+	if len(s.Checks) != len(bundle.Checks)+1 {
+		t.Fatalf("expected %d checks, got %d", len(bundle.Checks)+1, len(s.Checks))
+	}
+	if last := s.Checks[len(s.Checks)-1]; last.ID != "twin-drift" || last.Status != StatusFail {
+		t.Fatalf("failure should map to its check: %+v", last)
+	}
+
+	shadow, err := shadowpack.Evaluate(root, "shadowpacks/examples/manifest.json")
+	if err != nil {
+		t.Fatalf("Evaluate error: %v", err)
+	}
+	shadow.Failures = append(shadow.Failures, "outcome_mismatch_rate 9.00% > 5.00%")
+	s = FromShadow("dfshadowv01", "manifest.json", shadow)
+	if len(s.Checks) != 5 {
+		t.Fatalf("expected 4 criteria plus the added failure, got %d", len(s.Checks))
+	}
+	if last := s.Checks[len(s.Checks)-1]; last.ID != "outcome_mismatch_rate" || last.Status != StatusFail {
+		t.Fatalf("failure should map to its criterion: %+v", last)
+	}
+}
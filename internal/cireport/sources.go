@@ -0,0 +1,63 @@
+package cireport
+
+import (
+	"strings"
+
+	"github.com/rickhallett/darkfactorio/internal/factoryv05"
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+	"github.com/rickhallett/darkfactorio/internal/shadowpack"
+)
+
+// FromGate maps every finding in a gate report to a check keyed by its rule
+// ID. A report saved before findings existed maps its failures and warnings
+// only, keyed by their message.
+func FromGate(name, artifact string, r level4gate.GateReport) Suite {
+	s := Suite{Name: name, Artifact: artifact}
+	for _, f := range r.Findings {
+		c := Check{ID: f.RuleID, Status: StatusPass, Message: f.Message}
+		switch f.Severity {
+		case level4gate.FindingBlock:
+			c.Status = StatusFail
+		case level4gate.FindingWarn:
+			c.Status = StatusWarn
+		}
+		s.Checks = append(s.Checks, c)
+	}
+	if r.Findings == nil {
+		for _, msg := range r.Failures {
+			s.Checks = append(s.Checks, Check{ID: msg, Status: StatusFail, Message: msg})
+		}
+		for _, msg := range r.Warnings {
+			s.Checks = append(s.Checks, Check{ID: msg, Status: StatusWarn, Message: msg})
+		}
+	}
+	return s
+}
+
+// FromBundle maps a factory bundle report: each passed check, then each
+// failure, whose "<check>: <reason>" prefix names the check.
+func FromBundle(name, artifact string, r factoryv05.Report) Suite {
+	s := Suite{Name: name, Artifact: artifact}
+	for _, id := range r.Checks {
+		s.Checks = append(s.Checks, Check{ID: id, Status: StatusPass, Message: id + " passed"})
+	}
+	for _, msg := range r.Failures {
+		id, _, _ := strings.Cut(msg, ": ")
+		s.Checks = append(s.Checks, Check{ID: id, Status: StatusFail, Message: msg})
+	}
+	return s
+}
+
+// FromShadow maps a shadow-pack report: each criterion that held, then each
+// failure, whose first word names the criterion.
+func FromShadow(name, artifact string, r shadowpack.Report) Suite {
+	s := Suite{Name: name, Artifact: artifact}
+	for _, id := range r.Checks {
+		s.Checks = append(s.Checks, Check{ID: id, Status: StatusPass, Message: id + " passed"})
+	}
+	for _, msg := range r.Failures {
+		id, _, _ := strings.Cut(msg, " ")
+		s.Checks = append(s.Checks, Check{ID: id, Status: StatusFail, Message: msg})
+	}
+	return s
+}
@@ -1,8 +1,12 @@
 package dfcorpus
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"time"
 
 	"github.com/rickhallett/darkfactorio/internal/level4gate"
 )
@@ -10,12 +14,34 @@ import (
 type ReplayOptions struct {
 	Inputs       []string
 	WindowFilter map[string]struct{}
-	Criteria     level4gate.Criteria
+	// From and To bound record timestamps to [From, To), across every
+	// input and window. A zero value leaves that side open.
+	From     time.Time
+	To       time.Time
+	Criteria level4gate.Criteria
+	// Duplicates is the policy for records sharing (window_id, run_id),
+	// within one input or across inputs; empty means error.
+	Duplicates string
+	// Reversals, when set, is joined against every record, so reversals
+	// made after a window closed apply to it.
+	Reversals *level4gate.ReversalLog
+	// Incidents, when set, is linked to every record.
+	Incidents *level4gate.IncidentLog
+	// KeepRecords returns the replayed records in ReplayResult.Records.
+	// It holds the whole corpus in memory, as Replay did before records
+	// were streamed.
+	KeepRecords bool
 }
 
+// ReplayResult reports the corpus verdict, the number of records replayed
+// and the repeats the duplicate policy dropped. Records is nil unless
+// ReplayOptions.KeepRecords is set.
 type ReplayResult struct {
-	Records []level4gate.EvalRecord
-	Report  level4gate.GateReport
+	Records           []level4gate.EvalRecord
+	RecordCount       int
+	DuplicatesDropped int
+	Duplicates        []level4gate.Duplicate
+	Report            level4gate.GateReport
 }
 
 func Replay(opts ReplayOptions) (ReplayResult, error) {
@@ -23,45 +49,120 @@ func Replay(opts ReplayOptions) (ReplayResult, error) {
 		return ReplayResult{}, fmt.Errorf("at least one input file is required")
 	}
 
-	all := make([]level4gate.EvalRecord, 0, 128)
-	for _, in := range opts.Inputs {
-		recs, err := loadFile(in, opts.WindowFilter)
-		if err != nil {
-			return ReplayResult{}, fmt.Errorf("%s: %w", in, err)
+	if !opts.From.IsZero() && !opts.To.IsZero() && !opts.From.Before(opts.To) {
+		return ReplayResult{}, fmt.Errorf("from %s must be before to %s", opts.From.Format(time.RFC3339), opts.To.Format(time.RFC3339))
+	}
+
+	acc := opts.newAccumulator()
+	var kept []level4gate.EvalRecord
+	dedupe, err := replayInputs(opts, func(r level4gate.EvalRecord, _ time.Time) {
+		acc.Add(r)
+		if opts.KeepRecords {
+			kept = append(kept, r)
 		}
-		all = append(all, recs...)
+	})
+	if err != nil {
+		return ReplayResult{}, err
 	}
-	if len(all) == 0 {
+	if acc.Count() == 0 {
 		return ReplayResult{}, fmt.Errorf("no records matched corpus filters")
 	}
 
-	report := level4gate.EvaluateWithCriteria(all, opts.Criteria, "corpus")
 	return ReplayResult{
-		Records: all,
-		Report:  report,
+		Records:           kept,
+		RecordCount:       acc.Count(),
+		DuplicatesDropped: dedupe.Dropped(),
+		Duplicates:        dedupe.Duplicates(),
+		Report:            acc.Report("corpus"),
 	}, nil
 }
 
-func loadFile(path string, windowFilter map[string]struct{}) ([]level4gate.EvalRecord, error) {
-	f, err := os.Open(path)
+func (opts ReplayOptions) newAccumulator() *level4gate.Accumulator {
+	acc := level4gate.NewAccumulator(opts.Criteria)
+	if opts.Reversals != nil {
+		acc.WithReversals(opts.Reversals)
+	}
+	if opts.Incidents != nil {
+		acc.WithIncidents(opts.Incidents)
+	}
+	return acc
+}
+
+// InputsInDir returns the NDJSON window files in dir, sorted by name.
+func InputsInDir(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.ndjson"))
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no .ndjson files in %s", dir)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
 
-	recs, err := level4gate.DecodeNDJSON(f, "")
+// replayInputs streams every input through the duplicate policy and passes
+// the records inside the window and time filters to add, with their parsed
+// timestamps. It returns the Deduper so callers can report what it dropped.
+func replayInputs(opts ReplayOptions, add func(level4gate.EvalRecord, time.Time)) (*level4gate.Deduper, error) {
+	dedupe, err := level4gate.NewDeduper(opts.Duplicates, func(r level4gate.EvalRecord) error {
+		at, _ := time.Parse(time.RFC3339, r.Timestamp)
+		add(r, at)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	if len(windowFilter) == 0 {
-		return recs, nil
+	for _, in := range opts.Inputs {
+		if err := replayFile(dedupe, in, opts); err != nil {
+			return nil, fmt.Errorf("%s: %w", in, err)
+		}
 	}
+	if err := dedupe.Flush(); err != nil {
+		return nil, err
+	}
+	return dedupe, nil
+}
+
+// replayFile streams one NDJSON file through dedupe. Every record is
+// validated, including those the filters drop, and a file without records
+// is an error.
+func replayFile(dedupe *level4gate.Deduper, path string, opts ReplayOptions) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 
-	out := make([]level4gate.EvalRecord, 0, len(recs))
-	for _, r := range recs {
-		if _, ok := windowFilter[r.WindowID]; ok {
-			out = append(out, r)
+	n, err := level4gate.DecodeNDJSONLines(f, level4gate.DecodeOptions{PipelineClasses: opts.Criteria.Classes()}, func(line int, r level4gate.EvalRecord) error {
+		if len(opts.WindowFilter) > 0 {
+			if _, ok := opts.WindowFilter[r.WindowID]; !ok {
+				return nil
+			}
 		}
+		if !inRange(r.Timestamp, opts.From, opts.To) {
+			return nil
+		}
+		return dedupe.Add(level4gate.RecordPosition{Source: path, Line: line}, r)
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("no records matched filter")
+	}
+	return nil
+}
+
+// inRange reports whether the RFC3339 timestamp ts lies in [from, to).
+// Records are validated before this runs, so ts parses.
+func inRange(ts string, from, to time.Time) bool {
+	if from.IsZero() && to.IsZero() {
+		return true
+	}
+	at, _ := time.Parse(time.RFC3339, ts)
+	if !from.IsZero() && at.Before(from) {
+		return false
 	}
-	return out, nil
+	return to.IsZero() || at.Before(to)
 }
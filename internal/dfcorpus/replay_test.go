@@ -3,6 +3,7 @@ package dfcorpus
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/rickhallett/darkfactorio/internal/level4gate"
@@ -23,14 +24,15 @@ func TestReplayAcrossFiles(t *testing.T) {
 	}
 
 	res, err := Replay(ReplayOptions{
-		Inputs:   []string{f1, f2},
-		Criteria: c,
+		Inputs:      []string{f1, f2},
+		Criteria:    c,
+		KeepRecords: true,
 	})
 	if err != nil {
 		t.Fatalf("Replay failed: %v", err)
 	}
-	if len(res.Records) != 2 {
-		t.Fatalf("expected 2 records, got %d", len(res.Records))
+	if len(res.Records) != 2 || res.RecordCount != 2 {
+		t.Fatalf("expected 2 records, got %d (count %d)", len(res.Records), res.RecordCount)
 	}
 	if !res.Report.Passed {
 		t.Fatalf("expected pass, got failures: %v", res.Report.Failures)
@@ -53,7 +55,8 @@ func TestReplayWithWindowFilter(t *testing.T) {
 		WindowFilter: map[string]struct{}{
 			"w1": {},
 		},
-		Criteria: c,
+		Criteria:    c,
+		KeepRecords: true,
 	})
 	if err != nil {
 		t.Fatalf("Replay failed: %v", err)
@@ -63,6 +66,29 @@ func TestReplayWithWindowFilter(t *testing.T) {
 	}
 }
 
+func TestReplayDetectsFilePassedTwice(t *testing.T) {
+	root := t.TempDir()
+	f := filepath.Join(root, "w1.ndjson")
+	mustWrite(t, f, `{"window_id":"w1","run_id":"run-001","pipeline_id":"p-low-001","pipeline_class":"low_risk_feature","scenario_total":10,"scenario_passed":10,"first_pass_success":true,"retries":1,"interventions":1,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"2026-02-19T00:00:00Z"}`+"\n")
+
+	c := level4gate.DefaultCriteria()
+	c.MinRuns = 1
+	c.RequiredClassMinimum = map[string]int{"low_risk_feature": 1}
+
+	_, err := Replay(ReplayOptions{Inputs: []string{f, f}, Criteria: c})
+	if err == nil || !strings.Contains(err.Error(), f+": line 1: duplicate of run_id \"run-001\" in window \"w1\" first seen at "+f+" line 1") {
+		t.Fatalf("expected duplicate error, got %v", err)
+	}
+
+	res, err := Replay(ReplayOptions{Inputs: []string{f, f}, Criteria: c, Duplicates: level4gate.DuplicateMergeIdentical})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if res.RecordCount != 1 || res.DuplicatesDropped != 1 {
+		t.Fatalf("expected 1 record and 1 dropped duplicate, got %d and %d", res.RecordCount, res.DuplicatesDropped)
+	}
+}
+
 func mustWrite(t *testing.T, path string, body string) {
 	t.Helper()
 	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
@@ -0,0 +1,120 @@
+package dfcorpus
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+)
+
+// maxRollingSteps bounds the series so a small step over a long range does
+// not allocate an accumulator per second.
+const maxRollingSteps = 10000
+
+// RollingOptions evaluates the corpus over a sliding time window. The
+// windows are [From + i*Step, From + i*Step + Width) for every i whose
+// window ends at or before To. From and To are required.
+type RollingOptions struct {
+	ReplayOptions
+	Width time.Duration
+	Step  time.Duration
+}
+
+// RollingPoint is the gate verdict for one step. Report is nil when no
+// record falls in the window; such a step counts as not passed.
+type RollingPoint struct {
+	From        time.Time              `json:"from"`
+	To          time.Time              `json:"to"`
+	RecordCount int                    `json:"record_count"`
+	Passed      bool                   `json:"passed"`
+	Report      *level4gate.GateReport `json:"report,omitempty"`
+}
+
+// RollingResult is the series in time order. FirstPassed is the end of the
+// first passing window; StayedGreen is true when every window after it
+// passed as well.
+type RollingResult struct {
+	Points            []RollingPoint `json:"points"`
+	FirstPassed       *time.Time     `json:"first_passed,omitempty"`
+	StayedGreen       bool           `json:"stayed_green"`
+	DuplicatesDropped int            `json:"duplicates_dropped"`
+}
+
+// Rolling reads the inputs once and feeds each record to the accumulator of
+// every window that covers it.
+func Rolling(opts RollingOptions) (RollingResult, error) {
+	if len(opts.Inputs) == 0 {
+		return RollingResult{}, fmt.Errorf("at least one input file is required")
+	}
+	if opts.From.IsZero() || opts.To.IsZero() {
+		return RollingResult{}, errors.New("rolling evaluation needs both from and to")
+	}
+	if opts.Width <= 0 || opts.Step <= 0 {
+		return RollingResult{}, errors.New("rolling width and step must be positive")
+	}
+	span := opts.To.Sub(opts.From)
+	if span < opts.Width {
+		return RollingResult{}, fmt.Errorf("rolling width %s is longer than the range %s", opts.Width, span)
+	}
+	steps := int((span-opts.Width)/opts.Step) + 1
+	if steps > maxRollingSteps {
+		return RollingResult{}, fmt.Errorf("rolling series would have %d steps (max %d); use a larger step", steps, maxRollingSteps)
+	}
+
+	accs := make([]*level4gate.Accumulator, steps)
+	dedupe, err := replayInputs(opts.ReplayOptions, func(r level4gate.EvalRecord, at time.Time) {
+		first, last := coveringSteps(at.Sub(opts.From), opts.Width, opts.Step, steps)
+		for i := first; i <= last; i++ {
+			if accs[i] == nil {
+				accs[i] = opts.newAccumulator()
+			}
+			accs[i].Add(r)
+		}
+	})
+	if err != nil {
+		return RollingResult{}, err
+	}
+
+	res := RollingResult{
+		Points:            make([]RollingPoint, steps),
+		DuplicatesDropped: dedupe.Dropped(),
+	}
+	for i := range res.Points {
+		from := opts.From.Add(time.Duration(i) * opts.Step)
+		p := RollingPoint{From: from, To: from.Add(opts.Width)}
+		if accs[i] != nil {
+			report := accs[i].Report(from.Format(time.RFC3339) + "/" + p.To.Format(time.RFC3339))
+			p.RecordCount = accs[i].Count()
+			p.Passed = report.Passed
+			p.Report = &report
+		}
+		res.Points[i] = p
+		if p.Passed && res.FirstPassed == nil {
+			to := p.To
+			res.FirstPassed = &to
+			res.StayedGreen = true
+		}
+		if !p.Passed && res.FirstPassed != nil {
+			res.StayedGreen = false
+		}
+	}
+	return res, nil
+}
+
+// coveringSteps returns the range of step indexes whose window
+// [i*step, i*step+width) contains offset. last < first when none does.
+func coveringSteps(offset, width, step time.Duration, steps int) (int, int) {
+	if offset < 0 {
+		return 0, -1
+	}
+	first := 0
+	if offset >= width {
+		first = int((offset-width)/step) + 1
+	}
+	last := int(offset / step)
+	if last >= steps {
+		last = steps - 1
+	}
+	return first, last
+}
@@ -0,0 +1,102 @@
+package dfcorpus
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+)
+
+// dailyRuns writes one run per hour for each day. Days listed in failing
+// have a failed first pass on every run.
+func dailyRuns(t *testing.T, path string, days int, failing map[int]bool) {
+	t.Helper()
+	var b strings.Builder
+	base := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for d := 0; d < days; d++ {
+		for h := 0; h < 24; h++ {
+			fmt.Fprintf(&b, `{"window_id":"w","run_id":"run-%d-%d","pipeline_id":"p","pipeline_class":"low_risk_feature","scenario_total":10,"scenario_passed":10,"first_pass_success":%v,"retries":0,"interventions":0,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"%s"}`+"\n",
+				d, h, !failing[d], base.Add(time.Duration(d*24+h)*time.Hour).Format(time.RFC3339))
+		}
+	}
+	mustWrite(t, path, b.String())
+}
+
+func rollingCriteria() level4gate.Criteria {
+	c := level4gate.DefaultCriteria()
+	c.MinRuns = 24
+	c.RequiredClassMinimum = map[string]int{"low_risk_feature": 1}
+	return c
+}
+
+func TestReplayHonoursTimeRange(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "w.ndjson")
+	dailyRuns(t, f, 5, nil)
+	res, err := Replay(ReplayOptions{
+		Inputs:   []string{f},
+		From:     time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC),
+		Criteria: rollingCriteria(),
+	})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if res.RecordCount != 48 {
+		t.Fatalf("expected 48 records in [03-02, 03-04), got %d", res.RecordCount)
+	}
+}
+
+func TestRollingReportsWhenGateWentGreen(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "w.ndjson")
+	dailyRuns(t, f, 6, map[int]bool{0: true, 1: true})
+	res, err := Rolling(RollingOptions{
+		ReplayOptions: ReplayOptions{
+			Inputs:   []string{f},
+			From:     time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+			To:       time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC),
+			Criteria: rollingCriteria(),
+		},
+		Width: 48 * time.Hour,
+		Step:  24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Rolling failed: %v", err)
+	}
+	var got []string
+	for _, p := range res.Points {
+		got = append(got, fmt.Sprintf("%s:%d:%v", p.From.Format("01-02"), p.RecordCount, p.Passed))
+	}
+	want := "03-01:48:false 03-02:48:false 03-03:48:true 03-04:48:true 03-05:48:true 03-06:24:true"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("unexpected series:\n got %s\nwant %s", strings.Join(got, " "), want)
+	}
+	if res.FirstPassed == nil || !res.FirstPassed.Equal(time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)) || !res.StayedGreen {
+		t.Fatalf("unexpected first_passed=%v stayed_green=%v", res.FirstPassed, res.StayedGreen)
+	}
+}
+
+func TestCoveringSteps(t *testing.T) {
+	h := time.Hour
+	cases := []struct {
+		offset      time.Duration
+		first, last int
+	}{
+		{0, 0, 0},
+		{5 * h, 0, 0},
+		{6 * h, 0, 1},
+		{12 * h, 1, 2},
+		{29 * h, 3, 3},
+		{30 * h, 4, 3},
+	}
+	for _, c := range cases {
+		// width 12h, step 6h, 4 steps: windows end at 12h, 18h, 24h, 30h,
+		// so no window covers 30h.
+		first, last := coveringSteps(c.offset, 12*h, 6*h, 4)
+		if first != c.first || last != c.last {
+			t.Fatalf("coveringSteps(%s) = %d..%d, want %d..%d", c.offset, first, last, c.first, c.last)
+		}
+	}
+}
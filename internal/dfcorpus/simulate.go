@@ -0,0 +1,176 @@
+package dfcorpus
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+)
+
+// maxSimulationSettings bounds the grid of swept parameter combinations.
+const maxSimulationSettings = 10000
+
+// SimulateOptions replays the corpus once and judges every window under
+// each combination of the swept values, with every other criteria value
+// taken from ReplayOptions.Criteria.
+type SimulateOptions struct {
+	ReplayOptions
+	Sweeps []level4gate.Sweep
+}
+
+// SimulationSetting is one combination of swept values, aligned with
+// SimulationResult.Parameters, and the verdict of each window under it,
+// aligned with SimulationResult.Windows.
+type SimulationSetting struct {
+	Values        []float64 `json:"values"`
+	Passed        []bool    `json:"passed"`
+	FailedWindows int       `json:"failed_windows"`
+}
+
+// FlipPoint is where a window's verdict changes between two adjacent
+// values of one parameter, with the other parameters held at Fixed.
+type FlipPoint struct {
+	WindowID  string             `json:"window_id"`
+	Parameter string             `json:"parameter"`
+	From      float64            `json:"from"`
+	To        float64            `json:"to"`
+	PassedAt  bool               `json:"passed_at_from"`
+	Fixed     map[string]float64 `json:"fixed,omitempty"`
+}
+
+// SimulationResult is the verdict matrix. Settings enumerate the grid with
+// the last parameter varying fastest.
+type SimulationResult struct {
+	Parameters        []string            `json:"parameters"`
+	Windows           []string            `json:"windows"`
+	Settings          []SimulationSetting `json:"settings"`
+	FlipPoints        []FlipPoint         `json:"flip_points"`
+	DuplicatesDropped int                 `json:"duplicates_dropped"`
+}
+
+// Simulate groups the corpus by window_id and evaluates each window under
+// every setting of the swept parameters.
+func Simulate(opts SimulateOptions) (SimulationResult, error) {
+	if len(opts.Inputs) == 0 {
+		return SimulationResult{}, fmt.Errorf("at least one input file is required")
+	}
+	if len(opts.Sweeps) == 0 {
+		return SimulationResult{}, errors.New("at least one sweep is required")
+	}
+	settings := 1
+	seen := map[string]bool{}
+	for _, s := range opts.Sweeps {
+		if seen[s.Parameter] {
+			return SimulationResult{}, fmt.Errorf("parameter %s is swept twice", s.Parameter)
+		}
+		seen[s.Parameter] = true
+		if len(s.Values) == 0 {
+			return SimulationResult{}, fmt.Errorf("sweep of %s has no values", s.Parameter)
+		}
+		settings *= len(s.Values)
+		if settings > maxSimulationSettings {
+			return SimulationResult{}, fmt.Errorf("sweep grid exceeds %d settings; narrow a range or use a larger step", maxSimulationSettings)
+		}
+	}
+
+	accs := map[string]*level4gate.Accumulator{}
+	dedupe, err := replayInputs(opts.ReplayOptions, func(r level4gate.EvalRecord, _ time.Time) {
+		acc, ok := accs[r.WindowID]
+		if !ok {
+			acc = opts.newAccumulator()
+			accs[r.WindowID] = acc
+		}
+		acc.Add(r)
+	})
+	if err != nil {
+		return SimulationResult{}, err
+	}
+	if len(accs) == 0 {
+		return SimulationResult{}, fmt.Errorf("no records matched corpus filters")
+	}
+
+	res := SimulationResult{DuplicatesDropped: dedupe.Dropped()}
+	for _, s := range opts.Sweeps {
+		res.Parameters = append(res.Parameters, s.Parameter)
+	}
+	for id := range accs {
+		res.Windows = append(res.Windows, id)
+	}
+	sort.Strings(res.Windows)
+
+	for i := 0; i < settings; i++ {
+		values := gridValues(opts.Sweeps, i)
+		criteria := opts.Criteria
+		for p, v := range values {
+			criteria, err = criteria.WithParameter(res.Parameters[p], v)
+			if err != nil {
+				return SimulationResult{}, err
+			}
+		}
+		setting := SimulationSetting{Values: values, Passed: make([]bool, len(res.Windows))}
+		for w, id := range res.Windows {
+			setting.Passed[w] = accs[id].ReportWith(id, criteria).Passed
+			if !setting.Passed[w] {
+				setting.FailedWindows++
+			}
+		}
+		res.Settings = append(res.Settings, setting)
+	}
+	res.FlipPoints = flipPoints(opts.Sweeps, res)
+	return res, nil
+}
+
+// gridValues returns the values of setting i, last sweep varying fastest.
+func gridValues(sweeps []level4gate.Sweep, i int) []float64 {
+	values := make([]float64, len(sweeps))
+	for p := len(sweeps) - 1; p >= 0; p-- {
+		n := len(sweeps[p].Values)
+		values[p] = sweeps[p].Values[i%n]
+		i /= n
+	}
+	return values
+}
+
+// flipPoints walks each parameter's axis for every window and every
+// combination of the other parameters, and records each verdict change.
+func flipPoints(sweeps []level4gate.Sweep, res SimulationResult) []FlipPoint {
+	// stride[p] is the distance in Settings between adjacent values of p.
+	stride := make([]int, len(sweeps))
+	s := 1
+	for p := len(sweeps) - 1; p >= 0; p-- {
+		stride[p] = s
+		s *= len(sweeps[p].Values)
+	}
+
+	out := []FlipPoint{}
+	for w, id := range res.Windows {
+		for p, sw := range sweeps {
+			for i, setting := range res.Settings {
+				// Start from settings where p is at its first value.
+				if (i/stride[p])%len(sw.Values) != 0 {
+					continue
+				}
+				for k := 1; k < len(sw.Values); k++ {
+					prev := res.Settings[i+(k-1)*stride[p]]
+					cur := res.Settings[i+k*stride[p]]
+					if prev.Passed[w] == cur.Passed[w] {
+						continue
+					}
+					fp := FlipPoint{WindowID: id, Parameter: sw.Parameter, From: sw.Values[k-1], To: sw.Values[k], PassedAt: prev.Passed[w]}
+					for q, v := range setting.Values {
+						if q != p {
+							if fp.Fixed == nil {
+								fp.Fixed = map[string]float64{}
+							}
+							fp.Fixed[res.Parameters[q]] = v
+						}
+					}
+					out = append(out, fp)
+				}
+			}
+		}
+	}
+	return out
+}
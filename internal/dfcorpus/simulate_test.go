@@ -0,0 +1,78 @@
+package dfcorpus
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+)
+
+func TestSimulateSweepsThresholdsPerWindow(t *testing.T) {
+	root := filepath.Join("..", "..")
+	criteria, err := level4gate.LoadCriteria(filepath.Join(root, "profiles/level4-gate-v0.1-adversarial.json"))
+	if err != nil {
+		t.Fatalf("LoadCriteria failed: %v", err)
+	}
+	inputs, err := InputsInDir(filepath.Join(root, "runs"))
+	if err != nil {
+		t.Fatalf("InputsInDir failed: %v", err)
+	}
+	scenario, _ := level4gate.ParseSweep("min_scenario_pass_rate_percent=94:98:2")
+	retries, _ := level4gate.ParseSweep("max_mean_retries=0.5,1")
+	res, err := Simulate(SimulateOptions{
+		ReplayOptions: ReplayOptions{Inputs: inputs, Criteria: criteria},
+		Sweeps:        []level4gate.Sweep{scenario, retries},
+	})
+	if err != nil {
+		t.Fatalf("Simulate failed: %v", err)
+	}
+	if len(res.Windows) != 2 || res.Windows[1] != "w-2026-02-l4-03" {
+		t.Fatalf("unexpected windows: %v", res.Windows)
+	}
+	if len(res.Settings) != 6 {
+		t.Fatalf("expected a 3x2 grid, got %d settings", len(res.Settings))
+	}
+	// The last parameter varies fastest.
+	if v := res.Settings[1].Values; v[0] != 94 || v[1] != 1 {
+		t.Fatalf("unexpected grid order: %v", v)
+	}
+
+	// w-2026-02-l4-03 has a 96.97% scenario pass rate and 1.0 mean
+	// retries, so it passes only at 94 and 96 with retries capped at 1.
+	for _, s := range res.Settings {
+		want := s.Values[0] <= 96 && s.Values[1] == 1
+		if s.Passed[1] != want {
+			t.Fatalf("setting %v: passed=%v, want %v", s.Values, s.Passed[1], want)
+		}
+		if s.Passed[0] {
+			t.Fatalf("w-2026-02-l4-02 is below min_runs and should never pass")
+		}
+	}
+
+	var scenarioFlips []FlipPoint
+	for _, fp := range res.FlipPoints {
+		if fp.WindowID == "w-2026-02-l4-02" {
+			t.Fatalf("unexpected flip for a window that never passes: %+v", fp)
+		}
+		if fp.Parameter == "min_scenario_pass_rate_percent" {
+			scenarioFlips = append(scenarioFlips, fp)
+		}
+	}
+	if len(scenarioFlips) != 1 {
+		t.Fatalf("expected one scenario flip, got %+v", scenarioFlips)
+	}
+	if fp := scenarioFlips[0]; fp.From != 96 || fp.To != 98 || !fp.PassedAt || fp.Fixed["max_mean_retries"] != 1 {
+		t.Fatalf("unexpected flip point: %+v", fp)
+	}
+}
+
+func TestSimulateRejectsRepeatedParameters(t *testing.T) {
+	s, _ := level4gate.ParseSweep("min_runs=10,20")
+	_, err := Simulate(SimulateOptions{
+		ReplayOptions: ReplayOptions{Inputs: []string{"unused.ndjson"}, Criteria: level4gate.DefaultCriteria()},
+		Sweeps:        []level4gate.Sweep{s, s},
+	})
+	if err == nil || err.Error() != "parameter min_runs is swept twice" {
+		t.Fatalf("expected repeated parameter error, got %v", err)
+	}
+}
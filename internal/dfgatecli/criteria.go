@@ -0,0 +1,82 @@
+package dfgatecli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+)
+
+func runCriteria(args []string) int {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintln(os.Stderr, "usage: dfgate criteria show -criteria <profile> [--resolved] [-output text|json]")
+		return 1
+	}
+
+	fs := flag.NewFlagSet("dfgate criteria show", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	var criteriaPath string
+	var resolved bool
+	var output string
+
+	fs.StringVar(&criteriaPath, "criteria", "", "criteria profile JSON path (required)")
+	fs.BoolVar(&resolved, "resolved", false, "apply the extends chain and show where each value came from")
+	fs.StringVar(&output, "output", "text", "output format: text|json")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return 1
+	}
+	if criteriaPath == "" {
+		fmt.Fprintln(os.Stderr, "error: -criteria is required")
+		return 1
+	}
+
+	if !resolved {
+		b, err := os.ReadFile(criteriaPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		os.Stdout.Write(b)
+		return 0
+	}
+
+	res, err := level4gate.ResolveCriteria(criteriaPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if _, err := res.Decode(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: resolved criteria: %v\n", err)
+		return 1
+	}
+
+	switch output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+	default:
+		b, err := json.MarshalIndent(res.Document, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(b))
+		fmt.Println("chain:")
+		for _, p := range res.Chain {
+			fmt.Printf("- %s\n", p)
+		}
+		fmt.Println("sources:")
+		for _, ptr := range res.SourcePaths() {
+			fmt.Printf("- %s: %s\n", ptr, res.Sources[ptr])
+		}
+	}
+	return 0
+}
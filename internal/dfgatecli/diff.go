@@ -0,0 +1,189 @@
+package dfgatecli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+)
+
+// diffSide names one report to compare: either a saved JSON GateReport or
+// an NDJSON input evaluated with an optional window filter and criteria.
+type diffSide struct {
+	report   string
+	input    string
+	window   string
+	criteria string
+}
+
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("dfgate diff", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	var before, after diffSide
+	var output string
+	var tolerance float64
+	var strict bool
+	var duplicates string
+
+	fs.StringVar(&before.report, "before-report", "", "saved JSON gate report for the before side")
+	fs.StringVar(&before.input, "before-input", "", "NDJSON metrics file for the before side")
+	fs.StringVar(&before.window, "before-window", "", "optional window_id filter for the before side")
+	fs.StringVar(&before.criteria, "before-criteria", "", "optional criteria profile for the before side")
+	fs.StringVar(&after.report, "after-report", "", "saved JSON gate report for the after side")
+	fs.StringVar(&after.input, "after-input", "", "NDJSON metrics file for the after side (default -before-input)")
+	fs.StringVar(&after.window, "after-window", "", "optional window_id filter for the after side (default -before-window)")
+	fs.StringVar(&after.criteria, "after-criteria", "", "optional criteria profile for the after side (default -before-criteria)")
+	fs.StringVar(&output, "output", "text", "output format: text|json|markdown")
+	fs.Float64Var(&tolerance, "tolerance", 0, "allowed worsening per metric before it counts as a regression")
+	fs.BoolVar(&strict, "strict", false, "reject record keys outside the record's schema version")
+	fs.StringVar(&duplicates, "duplicates", level4gate.DuplicateError, "policy for repeated (window_id, run_id): "+strings.Join(level4gate.DuplicatePolicies(), "|"))
+
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if tolerance < 0 {
+		fmt.Fprintln(os.Stderr, "error: -tolerance cannot be negative")
+		return 1
+	}
+	if after.report == "" {
+		if after.input == "" {
+			after.input = before.input
+		}
+		if after.window == "" {
+			after.window = before.window
+		}
+		if after.criteria == "" {
+			after.criteria = before.criteria
+		}
+	}
+
+	decode := level4gate.DecodeOptions{Strict: strict, Duplicates: duplicates}
+	a, err := loadDiffSide("before", before, decode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	b, err := loadDiffSide("after", after, decode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	d := level4gate.Diff(a, b)
+	regressions := d.Regressions(tolerance)
+
+	switch output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			level4gate.ReportDiff
+			Tolerance   float64  `json:"tolerance"`
+			Regressions []string `json:"regressions"`
+		}{d, tolerance, nonNil(regressions)}); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+	case "markdown":
+		printDiffMarkdown(d, before.label(), after.label(), regressions)
+	default:
+		printDiffText(d, before.label(), after.label(), regressions)
+	}
+
+	if len(regressions) > 0 {
+		return 2
+	}
+	return 0
+}
+
+// label names the side in text and markdown headers.
+func (s diffSide) label() string {
+	switch {
+	case s.report != "":
+		return s.report
+	case s.window != "":
+		return s.window
+	case s.criteria != "":
+		return s.input + " @ " + s.criteria
+	}
+	return s.input
+}
+
+func loadDiffSide(name string, s diffSide, decode level4gate.DecodeOptions) (level4gate.GateReport, error) {
+	if s.report != "" {
+		if s.input != "" {
+			return level4gate.GateReport{}, fmt.Errorf("-%s-report and -%s-input are mutually exclusive", name, name)
+		}
+		b, err := os.ReadFile(s.report)
+		if err != nil {
+			return level4gate.GateReport{}, err
+		}
+		var r level4gate.GateReport
+		if err := json.Unmarshal(b, &r); err != nil {
+			return level4gate.GateReport{}, fmt.Errorf("%s: %w", s.report, err)
+		}
+		return r, nil
+	}
+	if s.input == "" {
+		return level4gate.GateReport{}, fmt.Errorf("-%s-input or -%s-report is required", name, name)
+	}
+	return evaluateInput(s.input, s.window, s.criteria, decode, joinStreams{})
+}
+
+func printDiffText(d level4gate.ReportDiff, beforeLabel, afterLabel string, regressions []string) {
+	fmt.Printf("darkfactorio level4 gate diff before=%q after=%q\n", beforeLabel, afterLabel)
+	fmt.Printf("passed: %v -> %v\n", d.BeforePassed, d.AfterPassed)
+	for _, m := range d.Metrics {
+		fmt.Printf("%s: %.2f -> %.2f (%+.2f)\n", m.Name, m.Before, m.After, m.Delta)
+	}
+	printList("failures gained:", d.FailuresGained)
+	printList("failures lost:", d.FailuresLost)
+	printList("regressions:", regressions)
+}
+
+func printList(title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Println(title)
+	for _, s := range items {
+		fmt.Printf("- %s\n", s)
+	}
+}
+
+func printDiffMarkdown(d level4gate.ReportDiff, beforeLabel, afterLabel string, regressions []string) {
+	fmt.Printf("## Gate diff: `%s` → `%s`\n\n", beforeLabel, afterLabel)
+	fmt.Printf("Passed: %v → %v\n\n", d.BeforePassed, d.AfterPassed)
+	fmt.Println("| Metric | Before | After | Delta |")
+	fmt.Println("|---|---:|---:|---:|")
+	for _, m := range d.Metrics {
+		fmt.Printf("| %s | %.2f | %.2f | %+.2f |\n", m.Name, m.Before, m.After, m.Delta)
+	}
+	for _, section := range []struct {
+		title string
+		items []string
+	}{
+		{"Failures gained", d.FailuresGained},
+		{"Failures lost", d.FailuresLost},
+		{"Regressions", regressions},
+	} {
+		if len(section.items) == 0 {
+			continue
+		}
+		fmt.Printf("\n### %s\n\n", section.title)
+		for _, s := range section.items {
+			fmt.Printf("- %s\n", strings.ReplaceAll(s, "|", "\\|"))
+		}
+	}
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,73 @@
+package dfgatecli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rickhallett/darkfactorio/internal/atomicfile"
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+)
+
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("dfgate migrate", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	var input string
+	var outPath string
+	var inPlace bool
+
+	fs.StringVar(&input, "input", "", "path to NDJSON metrics file (required)")
+	fs.StringVar(&outPath, "out", "", "write migrated NDJSON to this path (default stdout)")
+	fs.BoolVar(&inPlace, "in-place", false, "rewrite -input in place")
+
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if input == "" {
+		fmt.Fprintln(os.Stderr, "error: -input is required")
+		return 1
+	}
+	if inPlace && outPath != "" {
+		fmt.Fprintln(os.Stderr, "error: -out and -in-place are mutually exclusive")
+		return 1
+	}
+
+	f, err := os.Open(input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	var buf bytes.Buffer
+	n, err := level4gate.MigrateNDJSON(f, &buf)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s: %v\n", input, err)
+		return 1
+	}
+
+	if inPlace {
+		outPath = input
+	}
+	if outPath == "" {
+		if _, err := io.Copy(os.Stdout, &buf); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+	} else {
+		// Keep the mode of a file being replaced.
+		mode := os.FileMode(0o644)
+		if st, err := os.Stat(outPath); err == nil {
+			mode = st.Mode().Perm()
+		}
+		if err := atomicfile.Write(outPath, buf.Bytes(), mode); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "migrated %d records to %s\n", n, level4gate.CurrentSchemaVersion)
+	return 0
+}
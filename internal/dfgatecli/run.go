@@ -2,15 +2,39 @@ package dfgatecli
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/rickhallett/darkfactorio/internal/cireport"
+	"github.com/rickhallett/darkfactorio/internal/gatereport"
 	"github.com/rickhallett/darkfactorio/internal/level4gate"
 )
 
+// Run dispatches dfgate subcommands. Without a subcommand the arguments are
+// evaluated as a gate run, which keeps the v0.1 flag-only invocation working.
 func Run(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			return runMigrate(args[1:])
+		case "validate":
+			return runValidate(args[1:])
+		case "diff":
+			return runDiff(args[1:])
+		case "criteria":
+			return runCriteria(args[1:])
+		case "simulate":
+			return runSimulate(args[1:])
+		}
+	}
+	return runGate(args)
+}
+
+func runGate(args []string) int {
 	fs := flag.NewFlagSet("dfgate", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
 
@@ -18,11 +42,20 @@ func Run(args []string) int {
 	var windowID string
 	var output string
 	var criteriaPath string
+	var strict bool
+	var duplicates string
+	var reversalsPath, reversalsAsOf string
+	var incidentsPath string
 
 	fs.StringVar(&input, "input", "", "path to NDJSON metrics file (required)")
 	fs.StringVar(&windowID, "window", "", "optional window_id filter")
-	fs.StringVar(&output, "output", "text", "output format: text|json")
+	fs.StringVar(&output, "output", "text", "output format: text|json|markdown|html|junit|sarif")
 	fs.StringVar(&criteriaPath, "criteria", "", "optional criteria profile JSON path")
+	fs.BoolVar(&strict, "strict", false, "reject record keys outside the record's schema version")
+	fs.StringVar(&duplicates, "duplicates", level4gate.DuplicateError, "policy for repeated (window_id, run_id): "+strings.Join(level4gate.DuplicatePolicies(), "|"))
+	fs.StringVar(&reversalsPath, "reversals", "", "optional NDJSON stream of decision reversal events to join against the records")
+	fs.StringVar(&reversalsAsOf, "reversals-as-of", "", "RFC3339 time; ignore reversal events made after it")
+	fs.StringVar(&incidentsPath, "incidents", "", "optional NDJSON incident file linking incidents to run IDs")
 
 	if err := fs.Parse(args); err != nil {
 		return 1
@@ -31,23 +64,24 @@ func Run(args []string) int {
 		fmt.Fprintln(os.Stderr, "error: -input is required")
 		return 1
 	}
-
-	records, err := level4gate.LoadNDJSON(input, windowID)
-	if err != nil {
+	streams := joinStreams{}
+	var err error
+	if streams.reversals, err = loadReversals(reversalsPath, reversalsAsOf); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		return 1
 	}
-
-	criteria := level4gate.DefaultCriteria()
-	if criteriaPath != "" {
-		loaded, err := loadCriteria(criteriaPath)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error: loading criteria: %v\n", err)
+	if incidentsPath != "" {
+		if streams.incidents, err = level4gate.LoadIncidents(incidentsPath); err != nil {
+			fmt.Fprintf(os.Stderr, "error: loading incidents: %v\n", err)
 			return 1
 		}
-		criteria = loaded
 	}
-	report := level4gate.EvaluateWithCriteria(records, criteria, windowID)
+
+	report, err := evaluateInput(input, windowID, criteriaPath, level4gate.DecodeOptions{Strict: strict, Duplicates: duplicates}, streams)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
 
 	switch output {
 	case "json":
@@ -57,6 +91,16 @@ func Run(args []string) int {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			return 1
 		}
+	case "markdown", "html":
+		if err := gatereport.Render(os.Stdout, output, report); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+	case "junit", "sarif":
+		if err := cireport.Write(os.Stdout, output, cireport.FromGate("dfgate", input, report)); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
 	default:
 		printText(report)
 	}
@@ -64,28 +108,81 @@ func Run(args []string) int {
 	if !report.Passed {
 		return 2
 	}
+	if len(report.Warnings) > 0 {
+		return 3
+	}
 	return 0
 }
 
-func loadCriteria(path string) (level4gate.Criteria, error) {
-	f, err := os.Open(path)
+// joinStreams holds the optional event streams joined against records.
+type joinStreams struct {
+	reversals *level4gate.ReversalLog
+	incidents *level4gate.IncidentLog
+}
+
+// loadReversals reads the reversal stream at path, keeping the events made
+// at or before asOf when it is set. It returns nil when path is empty.
+func loadReversals(path, asOf string) (*level4gate.ReversalLog, error) {
+	if path == "" {
+		if asOf != "" {
+			return nil, errors.New("-reversals-as-of needs -reversals")
+		}
+		return nil, nil
+	}
+	log, err := level4gate.LoadReversals(path)
 	if err != nil {
-		return level4gate.Criteria{}, err
+		return nil, fmt.Errorf("loading reversals: %w", err)
 	}
-	defer f.Close()
-	return decodeCriteria(f)
+	if asOf != "" {
+		t, err := time.Parse(time.RFC3339, asOf)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -reversals-as-of: %w", err)
+		}
+		log = log.AsOf(t)
+	}
+	return log, nil
 }
 
-func decodeCriteria(r io.Reader) (level4gate.Criteria, error) {
-	var c level4gate.Criteria
-	dec := json.NewDecoder(r)
-	if err := dec.Decode(&c); err != nil {
-		return level4gate.Criteria{}, err
+// evaluateInput loads criteria (defaults when criteriaPath is empty) and
+// streams the NDJSON records in input through an Accumulator. decode
+// supplies Strict and Duplicates; the window and classes come from the
+// other arguments. The streams that are set are joined against the records.
+func evaluateInput(input, windowID, criteriaPath string, decode level4gate.DecodeOptions, streams joinStreams) (level4gate.GateReport, error) {
+	criteria := level4gate.DefaultCriteria()
+	if criteriaPath != "" {
+		loaded, err := level4gate.LoadCriteria(criteriaPath)
+		if err != nil {
+			return level4gate.GateReport{}, fmt.Errorf("loading criteria: %w", err)
+		}
+		criteria = loaded
+	}
+
+	f, err := os.Open(input)
+	if err != nil {
+		return level4gate.GateReport{}, err
+	}
+	defer f.Close()
+
+	acc := level4gate.NewAccumulator(criteria)
+	if streams.reversals != nil {
+		acc.WithReversals(streams.reversals)
+	}
+	if streams.incidents != nil {
+		acc.WithIncidents(streams.incidents)
+	}
+	decode.WindowID = windowID
+	decode.PipelineClasses = criteria.Classes()
+	n, err := level4gate.DecodeNDJSONFunc(f, decode, func(r level4gate.EvalRecord) error {
+		acc.Add(r)
+		return nil
+	})
+	if err != nil {
+		return level4gate.GateReport{}, err
 	}
-	if c.MinRuns <= 0 {
-		return level4gate.Criteria{}, fmt.Errorf("min_runs must be > 0")
+	if n == 0 {
+		return level4gate.GateReport{}, errors.New("no records matched filter")
 	}
-	return c, nil
+	return acc.Report(windowID), nil
 }
 
 func printText(report level4gate.GateReport) {
@@ -97,13 +194,89 @@ func printText(report level4gate.GateReport) {
 	fmt.Printf("first_pass_rate: %.2f%%\n", report.Metrics.FirstPassRatePercent)
 	fmt.Printf("mean_retries: %.2f\n", report.Metrics.MeanRetries)
 	fmt.Printf(
-		"intervention_trend: first_half=%.2f second_half=%.2f stable_or_decreasing=%v\n",
+		"intervention_trend: method=%s slope=%.3f p_value=%s first_half=%.2f second_half=%.2f stable_or_decreasing=%v\n",
+		report.Metrics.InterventionTrendMethod,
+		report.Metrics.InterventionTrendSlope,
+		formatPValue(report.Metrics.InterventionTrendPValue),
 		report.Metrics.InterventionAvgFirstHalf,
 		report.Metrics.InterventionAvgSecondHalf,
 		report.Metrics.InterventionStableOrDecreasing,
 	)
 	fmt.Printf("decision_reversal_rate: %.2f%%\n", report.Metrics.DecisionReversalPercent)
+	if rv := report.Metrics.Reversals; rv != nil {
+		fmt.Printf(
+			"reversals: events=%d approved=%d/%d (%.2f%%) rejected=%d/%d (%.2f%%) latency_hours_mean=%.1f latency_hours_p95=%.1f conflicts=%d\n",
+			rv.Events,
+			rv.ApprovedReversed, rv.ApprovedRuns, rv.ApprovedReversalPercent,
+			rv.RejectedReversed, rv.RejectedRuns, rv.RejectedReversalPercent,
+			rv.LatencyHours.Mean, rv.LatencyHours.P95,
+			rv.Conflicts,
+		)
+	}
 	fmt.Printf("approved_run_critical_incidents: %d\n", report.Metrics.ApprovedRunCriticalIncidents)
+	if inc := report.Metrics.Incidents; inc != nil {
+		fmt.Printf(
+			"incidents: count=%d sev1=%d sev2=%d sev3=%d sev4=%d mean_time_to_detect_hours=%.1f mean_time_to_mitigate_minutes=%.1f unmitigated=%d conflicts=%d\n",
+			inc.Count,
+			inc.BySeverity[level4gate.IncidentSev1], inc.BySeverity[level4gate.IncidentSev2],
+			inc.BySeverity[level4gate.IncidentSev3], inc.BySeverity[level4gate.IncidentSev4],
+			inc.TimeToDetectHours.Mean, inc.TimeToMitigateMinutes.Mean,
+			inc.Unmitigated, inc.Conflicts,
+		)
+	}
+	fmt.Printf(
+		"confidence_intervals(%.0f%%): scenario_pass_rate=[%.2f, %.2f] first_pass_rate=[%.2f, %.2f] decision_reversal_rate=[%.2f, %.2f]\n",
+		report.Metrics.ConfidenceLevel*100,
+		report.Metrics.ScenarioPassRateCI.Lower, report.Metrics.ScenarioPassRateCI.Upper,
+		report.Metrics.FirstPassRateCI.Lower, report.Metrics.FirstPassRateCI.Upper,
+		report.Metrics.DecisionReversalCI.Lower, report.Metrics.DecisionReversalCI.Upper,
+	)
+	if e := report.Metrics.Economics; e != nil {
+		fmt.Printf(
+			"economics: tokens_in_mean=%.0f tokens_out_mean=%.0f cost_usd_total=%.2f cost_per_approved_run_usd=%s duration_seconds_mean=%.1f duration_seconds_p95=%.1f\n",
+			e.TokensIn.Mean,
+			e.TokensOut.Mean,
+			e.CostUSD.Total,
+			formatOptional(e.CostPerApprovedRunUSD, "%.2f"),
+			e.DurationSeconds.Mean,
+			e.DurationSeconds.P95,
+		)
+	}
+	if sm := report.Metrics.Scenarios; sm != nil {
+		fmt.Printf("weighted_scenario_pass_rate: %.2f%%\n", sm.WeightedPassRatePercent)
+		if sm.UnweightableRuns > 0 {
+			fmt.Printf("unweightable_runs: %d\n", sm.UnweightableRuns)
+		}
+		for _, name := range []string{level4gate.ScenarioCategoryHappyPath, level4gate.ScenarioCategoryError, level4gate.ScenarioCategoryEdge} {
+			if cm, ok := sm.Categories[name]; ok {
+				fmt.Printf("scenario_category[%s]: %d/%d (%.2f%%)\n", name, cm.Passed, cm.Total, cm.PassRatePercent)
+			}
+		}
+		fmt.Printf("failed_scenarios_by_severity: %v unattributed=%d\n", sm.FailedBySeverity, sm.UnattributedFailures)
+	}
+	for _, c := range report.Classes {
+		fmt.Printf(
+			"class[%s]: passed=%v run_count=%d scenario_pass_rate=%.2f%% first_pass_rate=%.2f%% mean_retries=%.2f\n",
+			c.PipelineClass,
+			c.Passed,
+			c.Metrics.RunCount,
+			c.Metrics.ScenarioPassRatePercent,
+			c.Metrics.FirstPassRatePercent,
+			c.Metrics.MeanRetries,
+		)
+	}
+
+	fmt.Printf("inconclusive: %v\n", report.Inconclusive)
+	for _, r := range report.InconclusiveReasons {
+		fmt.Printf("- %s\n", r)
+	}
+
+	if len(report.Warnings) > 0 {
+		fmt.Println("warnings:")
+		for _, w := range report.Warnings {
+			fmt.Printf("- %s\n", w)
+		}
+	}
 
 	if len(report.Failures) > 0 {
 		fmt.Println("failures:")
@@ -113,3 +286,13 @@ func printText(report level4gate.GateReport) {
 	}
 }
 
+func formatPValue(p *float64) string {
+	return formatOptional(p, "%.4f")
+}
+
+func formatOptional(v *float64, format string) string {
+	if v == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf(format, *v)
+}
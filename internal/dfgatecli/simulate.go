@@ -0,0 +1,188 @@
+package dfgatecli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rickhallett/darkfactorio/internal/dfcorpus"
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+)
+
+// runSimulate sweeps criteria thresholds over a corpus and prints which
+// windows pass under each setting. It exits 0 whenever the simulation
+// runs; the verdicts are data, not a gate.
+func runSimulate(args []string) int {
+	fs := flag.NewFlagSet("dfgate simulate", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	var inputs, runsDir, criteriaPath, windows, duplicates, output string
+	var sweeps []level4gate.Sweep
+
+	fs.StringVar(&inputs, "inputs", "", "comma-separated NDJSON files (required unless -runs-dir)")
+	fs.StringVar(&runsDir, "runs-dir", "", "simulate every *.ndjson window file in this directory")
+	fs.StringVar(&criteriaPath, "criteria", "", "optional criteria profile JSON path; swept values replace its thresholds")
+	fs.StringVar(&windows, "windows", "", "optional comma-separated window_id filter")
+	fs.StringVar(&duplicates, "duplicates", level4gate.DuplicateError, "policy for repeated (window_id, run_id): "+strings.Join(level4gate.DuplicatePolicies(), "|"))
+	fs.StringVar(&output, "output", "csv", "output format: csv (verdict matrix)|flips (flip points as CSV)|json")
+	fs.Func("sweep", "parameter range, name=start:end:step or name=v1,v2 (repeatable); parameters: "+strings.Join(level4gate.SweepParameters(), "|"), func(spec string) error {
+		s, err := level4gate.ParseSweep(spec)
+		if err != nil {
+			return err
+		}
+		sweeps = append(sweeps, s)
+		return nil
+	})
+
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	paths := splitList(inputs)
+	if runsDir != "" {
+		found, err := dfcorpus.InputsInDir(runsDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		paths = append(paths, found...)
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "error: -inputs or -runs-dir is required")
+		return 1
+	}
+	if len(sweeps) == 0 {
+		fmt.Fprintln(os.Stderr, "error: at least one -sweep is required")
+		return 1
+	}
+	switch output {
+	case "csv", "flips", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown -output %q (want csv|flips|json)\n", output)
+		return 1
+	}
+
+	criteria := level4gate.DefaultCriteria()
+	if criteriaPath != "" {
+		loaded, err := level4gate.LoadCriteria(criteriaPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: loading criteria: %v\n", err)
+			return 1
+		}
+		criteria = loaded
+	}
+	var filter map[string]struct{}
+	if ids := splitList(windows); len(ids) > 0 {
+		filter = map[string]struct{}{}
+		for _, id := range ids {
+			filter[id] = struct{}{}
+		}
+	}
+
+	res, err := dfcorpus.Simulate(dfcorpus.SimulateOptions{
+		ReplayOptions: dfcorpus.ReplayOptions{
+			Inputs:       paths,
+			WindowFilter: filter,
+			Criteria:     criteria,
+			Duplicates:   duplicates,
+		},
+		Sweeps: sweeps,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	switch output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(res)
+	case "flips":
+		err = writeFlipsCSV(os.Stdout, res)
+	default:
+		err = writeSimulationCSV(os.Stdout, res)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// writeSimulationCSV writes one row per setting: the swept values, then
+// pass or fail for each window, then the number of failed windows.
+func writeSimulationCSV(w io.Writer, res dfcorpus.SimulationResult) error {
+	cw := csv.NewWriter(w)
+	header := append(append(append([]string{}, res.Parameters...), res.Windows...), "failed_windows")
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, s := range res.Settings {
+		row := make([]string, 0, len(header))
+		for _, v := range s.Values {
+			row = append(row, formatValue(v))
+		}
+		for _, passed := range s.Passed {
+			row = append(row, verdict(passed))
+		}
+		row = append(row, strconv.Itoa(s.FailedWindows))
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeFlipsCSV writes one row per flip point. fixed lists the other swept
+// parameters as name=value pairs separated by semicolons.
+func writeFlipsCSV(w io.Writer, res dfcorpus.SimulationResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"window_id", "parameter", "from", "to", "verdict_at_from", "verdict_at_to", "fixed"}); err != nil {
+		return err
+	}
+	for _, fp := range res.FlipPoints {
+		names := make([]string, 0, len(fp.Fixed))
+		for name := range fp.Fixed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fixed := make([]string, 0, len(names))
+		for _, name := range names {
+			fixed = append(fixed, name+"="+formatValue(fp.Fixed[name]))
+		}
+		row := []string{fp.WindowID, fp.Parameter, formatValue(fp.From), formatValue(fp.To), verdict(fp.PassedAt), verdict(!fp.PassedAt), strings.Join(fixed, ";")}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func verdict(passed bool) string {
+	if passed {
+		return "pass"
+	}
+	return "fail"
+}
+
+func splitList(raw string) []string {
+	var out []string
+	for _, p := range strings.Split(raw, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
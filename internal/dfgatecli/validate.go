@@ -0,0 +1,224 @@
+package dfgatecli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/rickhallett/darkfactorio/internal/jsonschema"
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+	"github.com/rickhallett/darkfactorio/schemas"
+)
+
+type validationResult struct {
+	Kind   string   `json:"kind"`
+	Input  string   `json:"input"`
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors"`
+}
+
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("dfgate validate", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	var kind string
+	var input string
+	var schemasDir string
+	var output string
+
+	fs.StringVar(&kind, "kind", "record", "document kind: record|criteria|envelope|incident|reversal|manifest")
+	fs.StringVar(&input, "input", "", "path to the document (NDJSON for records, incidents and reversals) (required)")
+	fs.StringVar(&schemasDir, "schemas", "", "directory holding the JSON schemas (default the schemas built into dfgate)")
+	fs.StringVar(&output, "output", "text", "output format: text|json")
+
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if input == "" {
+		fmt.Fprintln(os.Stderr, "error: -input is required")
+		return 1
+	}
+
+	schemaFS := schemaSource(schemasDir)
+
+	var errs []string
+	var err error
+	switch kind {
+	case "record":
+		errs, err = validateNDJSON(schemaFS, input, recordSchemaFor)
+	case "criteria":
+		errs, err = validateCriteria(schemaFS, "level4-gate-criteria-v0.1.json", input)
+	case "envelope":
+		errs, err = validateDocument(schemaFS, "run-envelope-v0.1.json", input)
+	case "incident":
+		errs, err = validateNDJSON(schemaFS, input, fixedSchema("incident-v0.1.json"))
+	case "reversal":
+		errs, err = validateNDJSON(schemaFS, input, fixedSchema("decision-reversal-event-v0.1.json"))
+	case "manifest":
+		errs, err = validateDocument(schemaFS, "window-manifest-v0.1.json", input)
+	default:
+		fmt.Fprintln(os.Stderr, "error: -kind must be record|criteria|envelope|incident|reversal|manifest")
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	res := validationResult{Kind: kind, Input: input, Valid: len(errs) == 0, Errors: errs}
+	if res.Errors == nil {
+		res.Errors = []string{}
+	}
+	switch output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+	default:
+		fmt.Printf("%s %s valid: %v\n", res.Kind, res.Input, res.Valid)
+		for _, e := range res.Errors {
+			fmt.Printf("- %s\n", e)
+		}
+	}
+
+	if !res.Valid {
+		return 2
+	}
+	return 0
+}
+
+// schemaSource returns the schemas in dir, or the embedded schemas when dir
+// is empty.
+func schemaSource(dir string) fs.FS {
+	if dir == "" {
+		return schemas.FS
+	}
+	return os.DirFS(dir)
+}
+
+func validateDocument(schemaFS fs.FS, schemaName, input string) ([]string, error) {
+	schema, err := jsonschema.LoadFS(schemaFS, schemaName)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(input)
+	if err != nil {
+		return nil, err
+	}
+	verrs, err := schema.ValidateJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(verrs))
+	for _, e := range verrs {
+		out = append(out, e.Error())
+	}
+	return out, nil
+}
+
+// validateCriteria checks the profile after its extends chain is applied,
+// since a child profile on its own is usually partial.
+func validateCriteria(schemaFS fs.FS, schemaName, input string) ([]string, error) {
+	schema, err := jsonschema.LoadFS(schemaFS, schemaName)
+	if err != nil {
+		return nil, err
+	}
+	res, err := level4gate.ResolveCriteria(input)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(res.Document)
+	if err != nil {
+		return nil, err
+	}
+	verrs, err := schema.ValidateJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(verrs))
+	for _, e := range verrs {
+		out = append(out, e.Error())
+	}
+	return out, nil
+}
+
+// schemaFor picks the schema file for one NDJSON line. An error is reported
+// against the line rather than aborting the run.
+type schemaFor func(raw []byte) (string, error)
+
+func fixedSchema(name string) schemaFor {
+	return func([]byte) (string, error) { return name, nil }
+}
+
+// recordSchemaFor picks the schema file named by a record's schema_version,
+// defaulting to v0.1 for unversioned lines. The version is looked up in the
+// level4gate registry before it becomes part of a file name, so a line
+// cannot name an arbitrary file.
+func recordSchemaFor(raw []byte) (string, error) {
+	var head struct {
+		SchemaVersion *string `json:"schema_version"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return "", err
+	}
+	version := level4gate.SchemaVersionV01
+	if head.SchemaVersion != nil {
+		version = *head.SchemaVersion
+	}
+	if !level4gate.IsSchemaVersion(version) {
+		return "", fmt.Errorf("unsupported schema_version %q", version)
+	}
+	return version + ".json", nil
+}
+
+// validateNDJSON checks every non-blank line of input against the schema
+// in schemaFS that pick chooses for it.
+func validateNDJSON(schemaFS fs.FS, input string, pick schemaFor) ([]string, error) {
+	f, err := os.Open(input)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	compiled := map[string]*jsonschema.Schema{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	var out []string
+	line := 0
+	for sc.Scan() {
+		line++
+		raw := sc.Bytes()
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		name, err := pick(raw)
+		if err != nil {
+			out = append(out, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+		schema, ok := compiled[name]
+		if !ok {
+			schema, err = jsonschema.LoadFS(schemaFS, name)
+			if err != nil {
+				return nil, err
+			}
+			compiled[name] = schema
+		}
+		verrs, err := schema.ValidateJSON(raw)
+		if err != nil {
+			out = append(out, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+		for _, e := range verrs {
+			out = append(out, fmt.Sprintf("line %d: %s", line, e.Error()))
+		}
+	}
+	return out, sc.Err()
+}
@@ -0,0 +1,78 @@
+package dfwindow
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/rickhallett/darkfactorio/internal/atomicfile"
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+)
+
+// withRunsLock runs fn holding the advisory lock for a runs file. The lock
+// lives in a sibling <runs>.lock file, so replacing the runs file by rename
+// does not drop it. Advances and lifecycle transitions both take it.
+func withRunsLock(absRuns string, fn func() error) (err error) {
+	unlock, err := lockFile(absRuns + ".lock")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if uerr := unlock(); err == nil {
+			err = uerr
+		}
+	}()
+	return fn()
+}
+
+// AppendRecords appends recs to the NDJSON file at path under the window
+// lock, creating the file if needed.
+func AppendRecords(path string, recs []level4gate.EvalRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return withRunsLock(path, func() error {
+		if err := touchFile(path); err != nil {
+			return err
+		}
+		return appendRecords(path, recs)
+	})
+}
+
+// appendRecords rewrites path with recs appended, atomically. Readers see
+// the old file or the new one, never a partial line. A final line missing
+// its newline is terminated first. The caller holds the window lock.
+//
+// Each call reads and rewrites the whole file, so an append costs time and
+// I/O linear in the window size. Windows hold tens to hundreds of runs;
+// readers that do not take the lock are the reason appends are not done in
+// place.
+func appendRecords(path string, recs []level4gate.EvalRecord) error {
+	current, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.Write(current)
+	if len(current) > 0 && current[len(current)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	for _, r := range recs {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(b, '\n'))
+	}
+	return atomicfile.Write(path, buf.Bytes(), 0o644)
+}
+
+// touchFile creates path if it does not exist, leaving any content alone.
+func touchFile(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
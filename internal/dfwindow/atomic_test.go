@@ -0,0 +1,102 @@
+package dfwindow
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+)
+
+func TestParallelAdvancesAllocateUniqueRunIDs(t *testing.T) {
+	root := t.TempDir()
+	writeIngestProfiles(t, root)
+
+	const writers, each = 8, 3
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := Advance(AdvanceOptions{Root: root, WindowID: "w", Synthetic: true, AppendCount: each})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Advance failed: %v", err)
+		}
+	}
+	assertRunIDs(t, filepath.Join(root, "runs/w.ndjson"), writers*each)
+}
+
+func TestParallelAdvanceProcessesAllocateUniqueRunIDs(t *testing.T) {
+	if root := os.Getenv("DFWINDOW_ADVANCE_ROOT"); root != "" {
+		if _, err := Advance(AdvanceOptions{Root: root, WindowID: "w", Synthetic: true, AppendCount: 2}); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	root := t.TempDir()
+	writeIngestProfiles(t, root)
+
+	const procs = 6
+	cmds := make([]*exec.Cmd, procs)
+	for i := range cmds {
+		cmds[i] = exec.Command(os.Args[0], "-test.run=^TestParallelAdvanceProcessesAllocateUniqueRunIDs$")
+		cmds[i].Env = append(os.Environ(), "DFWINDOW_ADVANCE_ROOT="+root)
+		if err := cmds[i].Start(); err != nil {
+			t.Fatalf("start failed: %v", err)
+		}
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatalf("advancer process failed: %v", err)
+		}
+	}
+	assertRunIDs(t, filepath.Join(root, "runs/w.ndjson"), procs*2)
+}
+
+func TestAppendRecordsTerminatesPartialLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "w.ndjson")
+	mustWrite(t, path, `{"window_id":"w","run_id":"run-001","pipeline_id":"p","pipeline_class":"low_risk_feature","scenario_total":10,"scenario_passed":10,"first_pass_success":true,"retries":0,"interventions":0,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"2026-02-18T20:00:00Z"}`)
+	rec := level4gate.EvalRecord{WindowID: "w", RunID: "run-002", PipelineID: "p", PipelineClass: "low_risk_feature", ScenarioTotal: 10, ScenarioPassed: 9, Decision: "approved", Timestamp: "2026-02-18T20:15:00Z"}
+	if err := AppendRecords(path, []level4gate.EvalRecord{rec}); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+	assertRunIDs(t, path, 2)
+	if next := nextRunIndex([]level4gate.EvalRecord{{RunID: "run-007"}, {RunID: "pack-1"}}); next != 8 {
+		t.Fatalf("expected the next run after run-007 to be 8, got %d", next)
+	}
+}
+
+// assertRunIDs checks that path holds run-001..run-<n> once each.
+func assertRunIDs(t *testing.T, path string, n int) {
+	t.Helper()
+	recs, err := level4gate.LoadNDJSON(path, "w")
+	if err != nil {
+		t.Fatalf("LoadNDJSON failed: %v", err)
+	}
+	if len(recs) != n {
+		t.Fatalf("expected %d records, got %d", n, len(recs))
+	}
+	seen := map[string]bool{}
+	for _, r := range recs {
+		if seen[r.RunID] {
+			t.Fatalf("duplicate run_id %s", r.RunID)
+		}
+		seen[r.RunID] = true
+	}
+	for i := 1; i <= n; i++ {
+		if id := fmt.Sprintf("run-%03d", i); !seen[id] {
+			t.Fatalf("missing %s", id)
+		}
+	}
+}
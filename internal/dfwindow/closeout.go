@@ -0,0 +1,404 @@
+package dfwindow
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rickhallett/darkfactorio/internal/atomicfile"
+	"github.com/rickhallett/darkfactorio/internal/gatereport"
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+)
+
+// CloseoutOptions locates a window and its criteria as in AdvanceOptions.
+// When names the closeout day in the record's filename; it defaults to the
+// latest run's timestamp.
+type CloseoutOptions struct {
+	Root                string
+	WindowID            string
+	RunsPath            string
+	BaselineCriteria    string
+	AdversarialCriteria string
+	When                time.Time
+}
+
+// CloseoutResult is a written closeout record.
+type CloseoutResult struct {
+	Path              string
+	Promotion         string
+	BaselineReport    level4gate.GateReport
+	AdversarialReport level4gate.GateReport
+}
+
+// QualityUsage summarises a window's high-quality remediation runs.
+// Reasons counts runs per reason. LegacyRuns counts runs without
+// quality_mode, whose mode is unknown.
+type QualityUsage struct {
+	HighRuns   int
+	Reasons    map[string]int
+	LegacyRuns int
+}
+
+// ErrCloseoutExists reports that the window already has a closeout record
+// for the day.
+var ErrCloseoutExists = errors.New("closeout record already exists")
+
+// Closeout writes learning/decisions/<date>-window-<id>-closeout.md with
+// the sections the learning gate requires, plus class coverage, in-window
+// trend, quality-mode usage and both gate reports. An existing record is
+// never overwritten.
+func Closeout(opts CloseoutOptions) (CloseoutResult, error) {
+	lc := LifecycleOptions{
+		Root:                opts.Root,
+		WindowID:            opts.WindowID,
+		RunsPath:            opts.RunsPath,
+		BaselineCriteria:    opts.BaselineCriteria,
+		AdversarialCriteria: opts.AdversarialCriteria,
+	}
+	if err := lc.defaults(); err != nil {
+		return CloseoutResult{}, err
+	}
+	baseline, err := level4gate.LoadCriteria(filepath.Join(lc.Root, lc.BaselineCriteria))
+	if err != nil {
+		return CloseoutResult{}, err
+	}
+	adversarial, err := level4gate.LoadCriteria(filepath.Join(lc.Root, lc.AdversarialCriteria))
+	if err != nil {
+		return CloseoutResult{}, err
+	}
+	recs, err := level4gate.LoadNDJSONWithOptions(filepath.Join(lc.Root, lc.RunsPath), level4gate.DecodeOptions{
+		WindowID:        lc.WindowID,
+		PipelineClasses: baseline.Classes(),
+	})
+	if err != nil {
+		return CloseoutResult{}, err
+	}
+	// Order runs by instant: timestamps with different offsets do not sort
+	// as strings.
+	runs := byInstant{recs: recs, at: make([]time.Time, len(recs))}
+	for i, r := range recs {
+		t, err := time.Parse(time.RFC3339, r.Timestamp)
+		if err != nil {
+			return CloseoutResult{}, fmt.Errorf("run %s: timestamp must be RFC3339: %w", r.RunID, err)
+		}
+		runs.at[i] = t
+	}
+	sort.Stable(runs)
+
+	when := opts.When
+	if when.IsZero() {
+		when = runs.at[len(recs)-1]
+	}
+	rel := filepath.Join("learning", "decisions", fmt.Sprintf("%s-window-%s-closeout.md", when.UTC().Format("2006-01-02"), lc.WindowID))
+	path := filepath.Join(lc.Root, rel)
+	if _, err := os.Stat(path); err == nil {
+		return CloseoutResult{}, fmt.Errorf("%s: %w", rel, ErrCloseoutExists)
+	}
+
+	_, sum, err := hashRuns(lc.Root, lc.RunsPath)
+	if err != nil {
+		return CloseoutResult{}, err
+	}
+	res := CloseoutResult{
+		Path:              rel,
+		BaselineReport:    level4gate.EvaluateWithCriteria(recs, baseline, lc.WindowID),
+		AdversarialReport: level4gate.EvaluateWithCriteria(recs, adversarial, lc.WindowID),
+	}
+	usage := qualityUsage(res.BaselineReport.Metrics)
+	res.Promotion = promotion(res.BaselineReport, res.AdversarialReport, usage)
+
+	var b bytes.Buffer
+	w := func(format string, args ...any) { fmt.Fprintf(&b, format, args...) }
+	base, adv := res.BaselineReport, res.AdversarialReport
+
+	w("# Window Closeout: %s\n\n", lc.WindowID)
+	w("## Context\n\n")
+	w("Generated by `dfwindowv01` for %d runs (%s to %s). Judged against `%s` (baseline) and `%s` (adversarial). Runs file `%s`, sha256 `%s`.\n\n",
+		len(recs), recs[0].Timestamp, recs[len(recs)-1].Timestamp, baseline.Version, adversarial.Version, filepath.ToSlash(lc.RunsPath), sum)
+
+	w("## Decision\n\n")
+	w("- Baseline gate: %s.\n", passFail(base.Passed))
+	w("- Adversarial replay: %s.\n", passFail(adv.Passed))
+	w("- Promotion: %s.\n\n", res.Promotion)
+
+	m := base.Metrics
+	w("## Metrics Snapshot\n\n")
+	w("- Run count: %d\n", m.RunCount)
+	w("- Class mix: %s\n", classMix(m.RunCountByClass))
+	w("- Scenario pass rate: %.2f%%\n", m.ScenarioPassRatePercent)
+	w("- First-pass rate: %.2f%%\n", m.FirstPassRatePercent)
+	w("- Mean retries: %.2f\n", m.MeanRetries)
+	w("- Decision reversal rate: %.2f%%\n", m.DecisionReversalPercent)
+	w("- Approved critical incidents: %d\n\n", m.ApprovedRunCriticalIncidents)
+
+	w("## Class Coverage\n\n")
+	w("| Class | Runs | Baseline minimum | Adversarial minimum |\n|---|---:|---:|---:|\n")
+	for _, name := range baseline.ClassNames() {
+		w("| `%s` | %d | %d | %d |\n", name, m.RunCountByClass[name], baseline.RequiredClassMinimum[name], adversarial.RequiredClassMinimum[name])
+	}
+	w("\n")
+
+	first, second := halves(recs)
+	w("## Trend\n\n")
+	w("| Metric | Runs 1-%d | Runs %d-%d |\n|---|---:|---:|\n", len(first), len(first)+1, len(recs))
+	w("| Scenario pass rate | %.2f%% | %.2f%% |\n", scenarioRate(first), scenarioRate(second))
+	w("| First-pass rate | %.2f%% | %.2f%% |\n", firstPassRate(first), firstPassRate(second))
+	w("| Mean retries | %.2f | %.2f |\n", meanOf(first, func(r level4gate.EvalRecord) int { return r.Retries }), meanOf(second, func(r level4gate.EvalRecord) int { return r.Retries }))
+	w("| Mean interventions | %.2f | %.2f |\n\n", meanOf(first, func(r level4gate.EvalRecord) int { return r.Interventions }), meanOf(second, func(r level4gate.EvalRecord) int { return r.Interventions }))
+	w("Intervention trend (%s): slope %.3f per run", m.InterventionTrendMethod, m.InterventionTrendSlope)
+	if m.InterventionTrendPValue != nil {
+		w(", p=%.3f", *m.InterventionTrendPValue)
+	}
+	w(".\n\n")
+
+	w("## Quality Mode Usage\n\n")
+	if usage.LegacyRuns > 0 {
+		w("Unknown quality mode: %d legacy runs predate `quality_mode`; any of them may have been forced.\n\n", usage.LegacyRuns)
+	}
+	if usage.HighRuns == 0 {
+		w("- No high-quality remediation runs recorded for this window.\n\n")
+	} else {
+		w("High-quality remediation runs: %d of %d.\n\n", usage.HighRuns, len(recs))
+		w("| Reason | Runs |\n|---|---:|\n")
+		for _, reason := range sortedReasons(usage.Reasons) {
+			w("| %s | %d |\n", reason, usage.Reasons[reason])
+		}
+		w("\n")
+	}
+
+	blockers := topBlockers(base, adv, 3)
+	w("## Top 3 Blockers\n\n")
+	if len(blockers) == 0 {
+		w("1. None; both gates pass.\n")
+	}
+	for i, bl := range blockers {
+		w("%d. %s `%s`: %s.\n", i+1, bl.gate, bl.RuleID, bl.Message)
+	}
+	w("\n")
+
+	w("## Corrective Actions\n\n")
+	actions := correctiveActions(blockers)
+	if len(actions) == 0 {
+		actions = []string{"None required; record the promotion decision."}
+	}
+	for i, a := range actions {
+		w("%d. %s\n", i+1, a)
+	}
+	w("\n")
+
+	w("## Next Review\n\n")
+	if base.Passed && adv.Passed {
+		w("- Trigger: promotion decision record\n- Date: immediate\n\n")
+	} else {
+		w("- Trigger: next window reaches %d runs\n- Date: at the next window closeout\n\n", baseline.MinRuns)
+	}
+
+	w("## Gate Reports\n\n")
+	for _, gr := range []struct {
+		name   string
+		report level4gate.GateReport
+	}{{"Baseline", base}, {"Adversarial", adv}} {
+		w("### %s\n\n", gr.name)
+		var md bytes.Buffer
+		if err := gatereport.Markdown(&md, gr.report); err != nil {
+			return CloseoutResult{}, err
+		}
+		// Nest the report's headings under this section.
+		for _, line := range strings.Split(strings.TrimRight(md.String(), "\n"), "\n") {
+			if strings.HasPrefix(line, "#") {
+				line = "##" + line
+			}
+			w("%s\n", line)
+		}
+		w("\n")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return CloseoutResult{}, err
+	}
+	return res, atomicfile.Write(path, append(bytes.TrimRight(b.Bytes(), "\n"), '\n'), 0o644)
+}
+
+// promotion recommends a decision. A window that only passes adversarial
+// replay with remediation runs is flagged so the reviewer weighs them.
+func promotion(base, adv level4gate.GateReport, usage QualityUsage) string {
+	switch {
+	case !base.Passed:
+		return "not eligible; baseline gate failed"
+	case !adv.Passed:
+		return "not eligible; adversarial envelope still unmet"
+	case usage.HighRuns > 0 && usage.LegacyRuns > 0:
+		return fmt.Sprintf("eligible, with review of %d high-quality remediation runs and %d legacy runs of unknown quality mode", usage.HighRuns, usage.LegacyRuns)
+	case usage.HighRuns > 0:
+		return fmt.Sprintf("eligible, with review of %d high-quality remediation runs", usage.HighRuns)
+	case usage.LegacyRuns > 0:
+		return fmt.Sprintf("eligible, with review of %d legacy runs of unknown quality mode", usage.LegacyRuns)
+	}
+	return "eligible"
+}
+
+type blocker struct {
+	gate string
+	gatereport.Explanation
+}
+
+func topBlockers(base, adv level4gate.GateReport, n int) []blocker {
+	var out []blocker
+	for _, gr := range []struct {
+		gate   string
+		report level4gate.GateReport
+	}{{"Baseline", base}, {"Adversarial", adv}} {
+		for _, e := range gatereport.NewView(gr.report).Failures {
+			if len(out) == n {
+				return out
+			}
+			out = append(out, blocker{gate: gr.gate, Explanation: e})
+		}
+	}
+	return out
+}
+
+// correctiveActionsByRule maps a rule ID, without its class label, to the
+// usual corrective action.
+var correctiveActionsByRule = map[string]string{
+	"run_count":                       "Extend the window, or replay it in a corpus with neighbouring windows.",
+	"run_count_by_class":              "Route more runs of the under-represented classes into the next window.",
+	"scenario_pass_rate":              "Triage the failed scenarios and fix the most common failure before the next window.",
+	"weighted_scenario_pass_rate":     "Triage the failed scenarios and fix the most common failure before the next window.",
+	"first_pass_rate":                 "Inspect the runs that needed a retry and remove the cause of the first failure.",
+	"mean_retries":                    "Inspect the runs that needed a retry and remove the cause of the first failure.",
+	"decision_reversal_rate":          "Review the reversed approvals and tighten the checks they passed.",
+	"reversal_events":                 "Reconcile the reversal stream with the recorded decisions.",
+	"approved_run_critical_incidents": "Hold promotion until each linked incident has a post-incident review.",
+	"incident_links":                  "Reconcile the incident stream with the runs it names.",
+	"intervention_trend":              "Find what is driving rising interventions before extending autonomy.",
+	"cost_per_approved_run_usd":       "Profile the most expensive approved runs against the cost ceiling.",
+	"p95_duration_seconds":            "Profile the slowest runs against the duration ceiling.",
+	"remediation_share":               "Replace forced remediation runs with measured runs before the next review.",
+}
+
+var classLabel = regexp.MustCompile(`\[[^\]]*\]$`)
+
+func correctiveActions(blockers []blocker) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, b := range blockers {
+		id := classLabel.ReplaceAllString(b.RuleID, "")
+		action, ok := correctiveActionsByRule[id]
+		if !ok && strings.HasPrefix(id, "incidents_") {
+			action, ok = correctiveActionsByRule["approved_run_critical_incidents"], true
+		}
+		if !ok {
+			action = fmt.Sprintf("Resolve `%s` before the next review.", b.RuleID)
+		}
+		if !seen[action] {
+			seen[action] = true
+			out = append(out, action)
+		}
+	}
+	return out
+}
+
+// qualityUsage counts remediation runs from the records' quality_mode.
+// Runs that predate the field are counted as legacy runs of unknown mode
+// rather than inferred: any of them may have been forced.
+func qualityUsage(m level4gate.Metrics) QualityUsage {
+	usage := QualityUsage{Reasons: map[string]int{}, LegacyRuns: m.RunCount}
+	if r := m.Remediation; r != nil {
+		usage.HighRuns = r.HighRunCount
+		usage.LegacyRuns = m.RunCount - r.RecordedRunCount
+		for k, v := range r.HighRunsByReason {
+			usage.Reasons[k] = v
+		}
+	}
+	return usage
+}
+
+// byInstant sorts records and their parsed timestamps together.
+type byInstant struct {
+	recs []level4gate.EvalRecord
+	at   []time.Time
+}
+
+func (b byInstant) Len() int           { return len(b.recs) }
+func (b byInstant) Less(i, j int) bool { return b.at[i].Before(b.at[j]) }
+func (b byInstant) Swap(i, j int) {
+	b.recs[i], b.recs[j] = b.recs[j], b.recs[i]
+	b.at[i], b.at[j] = b.at[j], b.at[i]
+}
+
+func sortedReasons(reasons map[string]int) []string {
+	out := make([]string, 0, len(reasons))
+	for r := range reasons {
+		out = append(out, r)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func halves(recs []level4gate.EvalRecord) ([]level4gate.EvalRecord, []level4gate.EvalRecord) {
+	mid := (len(recs) + 1) / 2
+	return recs[:mid], recs[mid:]
+}
+
+func scenarioRate(recs []level4gate.EvalRecord) float64 {
+	total, passed := 0, 0
+	for _, r := range recs {
+		total += r.ScenarioTotal
+		passed += r.ScenarioPassed
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(passed) / float64(total) * 100
+}
+
+func firstPassRate(recs []level4gate.EvalRecord) float64 {
+	if len(recs) == 0 {
+		return 0
+	}
+	n := 0
+	for _, r := range recs {
+		if r.FirstPassSuccess {
+			n++
+		}
+	}
+	return float64(n) / float64(len(recs)) * 100
+}
+
+func meanOf(recs []level4gate.EvalRecord, field func(level4gate.EvalRecord) int) float64 {
+	if len(recs) == 0 {
+		return 0
+	}
+	sum := 0
+	for _, r := range recs {
+		sum += field(r)
+	}
+	return float64(sum) / float64(len(recs))
+}
+
+func classMix(byClass map[string]int) string {
+	names := make([]string, 0, len(byClass))
+	for name := range byClass {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%d", name, byClass[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func passFail(passed bool) string {
+	if passed {
+		return "pass"
+	}
+	return "fail"
+}
@@ -0,0 +1,172 @@
+package dfwindow
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickhallett/darkfactorio/internal/learning"
+)
+
+func TestAdvanceWritesCloseoutWhenWindowReachesTarget(t *testing.T) {
+	root := t.TempDir()
+	writeIngestProfiles(t, root)
+	opts := AdvanceOptions{
+		Root:        root,
+		WindowID:    "w",
+		Synthetic:   true,
+		AppendCount: 2,
+		StartTime:   time.Date(2026, 2, 19, 1, 0, 0, 0, time.UTC),
+		TargetRuns:  4,
+	}
+
+	res, err := Advance(opts)
+	if err != nil {
+		t.Fatalf("Advance failed: %v", err)
+	}
+	if res.CloseoutPath != "" {
+		t.Fatalf("expected no closeout below the target, got %s", res.CloseoutPath)
+	}
+
+	opts.QualityMode = "high"
+	opts.QualityReason = "flaky fixture"
+	opts.StartTime = opts.StartTime.Add(time.Hour)
+	if res, err = Advance(opts); err != nil {
+		t.Fatalf("Advance failed: %v", err)
+	}
+	if res.CloseoutPath != filepath.Join("learning", "decisions", "2026-02-19-window-w-closeout.md") {
+		t.Fatalf("expected a closeout at the target, got %q", res.CloseoutPath)
+	}
+	b, err := os.ReadFile(filepath.Join(root, res.CloseoutPath))
+	if err != nil {
+		t.Fatalf("reading closeout: %v", err)
+	}
+	body := string(b)
+	if missing := learning.MissingCloseoutSections(body); len(missing) != 0 {
+		t.Fatalf("closeout is missing sections %v:\n%s", missing, body)
+	}
+	for _, want := range []string{
+		"- Promotion: eligible, with review of 2 high-quality remediation runs.",
+		"| `low_risk_feature` |",
+		"## Trend",
+		"High-quality remediation runs: 2 of 4.",
+		"| flaky fixture | 2 |",
+		"### Baseline",
+		"#### Level 4 gate report: w",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("closeout missing %q:\n%s", want, body)
+		}
+	}
+
+	opts.StartTime = opts.StartTime.Add(time.Hour)
+	if res, err = Advance(opts); err != nil {
+		t.Fatalf("Advance past the target failed: %v", err)
+	}
+	if res.CloseoutPath != "" {
+		t.Fatalf("expected no second closeout past the target, got %s", res.CloseoutPath)
+	}
+	if _, err := Closeout(CloseoutOptions{Root: root, WindowID: "w"}); !errors.Is(err, ErrCloseoutExists) {
+		t.Fatalf("expected an existing record to be kept, got %v", err)
+	}
+}
+
+func TestCloseoutListsBlockersAndActions(t *testing.T) {
+	root := t.TempDir()
+	writeIngestProfiles(t, root)
+	mustWrite(t, filepath.Join(root, "profiles/level4-gate-v0.1-adversarial.json"), strings.Replace(ingestProfile, `"min_runs":1`, `"min_runs":5`, 1))
+	if _, err := Advance(AdvanceOptions{Root: root, WindowID: "w", Synthetic: true, AppendCount: 2}); err != nil {
+		t.Fatalf("Advance failed: %v", err)
+	}
+
+	res, err := Closeout(CloseoutOptions{Root: root, WindowID: "w", When: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("Closeout failed: %v", err)
+	}
+	if res.Path != filepath.Join("learning", "decisions", "2026-03-01-window-w-closeout.md") || res.Promotion != "not eligible; adversarial envelope still unmet" {
+		t.Fatalf("unexpected closeout: %+v", res)
+	}
+	b, err := os.ReadFile(filepath.Join(root, res.Path))
+	if err != nil {
+		t.Fatalf("reading closeout: %v", err)
+	}
+	body := string(b)
+	for _, want := range []string{
+		"1. Adversarial `run_count`",
+		"1. Extend the window, or replay it in a corpus with neighbouring windows.",
+		"- No high-quality remediation runs recorded for this window.",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("closeout missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestCloseoutCountsLegacyRunsAsUnknownQualityMode(t *testing.T) {
+	root := t.TempDir()
+	writeIngestProfiles(t, root)
+	mustWrite(t, filepath.Join(root, "runs/w.ndjson"), `{"window_id":"w","run_id":"run-001","pipeline_id":"p-low-001","pipeline_class":"low_risk_feature","scenario_total":10,"scenario_passed":10,"first_pass_success":true,"retries":1,"interventions":1,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"2026-02-19T01:00:00Z"}
+{"schema_version":"level4-eval-record-v0.3","window_id":"w","run_id":"run-002","pipeline_id":"p-med-001","pipeline_class":"medium_integration","scenario_total":10,"scenario_passed":10,"first_pass_success":true,"retries":1,"interventions":1,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"2026-02-19T01:15:00Z","quality_mode":"standard"}
+`)
+
+	res, err := Closeout(CloseoutOptions{Root: root, WindowID: "w"})
+	if err != nil {
+		t.Fatalf("Closeout failed: %v", err)
+	}
+	if res.Promotion != "eligible, with review of 1 legacy runs of unknown quality mode" {
+		t.Fatalf("unexpected promotion: %q", res.Promotion)
+	}
+	b, err := os.ReadFile(filepath.Join(root, res.Path))
+	if err != nil {
+		t.Fatalf("reading closeout: %v", err)
+	}
+	if !strings.Contains(string(b), "Unknown quality mode: 1 legacy runs predate `quality_mode`") {
+		t.Fatalf("expected legacy runs in the closeout:\n%s", b)
+	}
+}
+
+func TestAdvanceReportsCloseoutProblemsAfterAppending(t *testing.T) {
+	root := t.TempDir()
+	writeIngestProfiles(t, root)
+	// A file where the decisions directory belongs makes the closeout fail.
+	mustWrite(t, filepath.Join(root, "learning", "decisions"), "")
+
+	res, err := Advance(AdvanceOptions{Root: root, WindowID: "w", Synthetic: true, AppendCount: 2})
+	if err != nil {
+		t.Fatalf("Advance must not fail once runs are appended: %v", err)
+	}
+	if len(res.Warnings) != 1 || !strings.HasPrefix(res.Warnings[0], "closeout not written: ") || res.CloseoutPath != "" {
+		t.Fatalf("expected a closeout warning, got %+v", res.Warnings)
+	}
+	b, err := os.ReadFile(filepath.Join(root, "runs", "w.ndjson"))
+	if err != nil || strings.Count(string(b), "\n") != 2 {
+		t.Fatalf("expected 2 appended runs, got %q: %v", b, err)
+	}
+}
+
+func TestCloseoutOrdersRunsByInstant(t *testing.T) {
+	root := t.TempDir()
+	writeIngestProfiles(t, root)
+	// As strings run-002 sorts first; as instants run-001 is earlier.
+	mustWrite(t, filepath.Join(root, "runs/w.ndjson"), `{"schema_version":"level4-eval-record-v0.3","window_id":"w","run_id":"run-002","pipeline_id":"p-med-001","pipeline_class":"medium_integration","scenario_total":10,"scenario_passed":10,"first_pass_success":true,"retries":0,"interventions":0,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"2026-02-19T01:30:00Z","quality_mode":"standard"}
+{"schema_version":"level4-eval-record-v0.3","window_id":"w","run_id":"run-001","pipeline_id":"p-low-001","pipeline_class":"low_risk_feature","scenario_total":10,"scenario_passed":10,"first_pass_success":true,"retries":0,"interventions":0,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"2026-02-19T03:00:00+02:00","quality_mode":"standard"}
+`)
+
+	res, err := Closeout(CloseoutOptions{Root: root, WindowID: "w"})
+	if err != nil {
+		t.Fatalf("Closeout failed: %v", err)
+	}
+	if res.Path != filepath.Join("learning", "decisions", "2026-02-19-window-w-closeout.md") {
+		t.Fatalf("expected the closeout dated by the latest instant, got %s", res.Path)
+	}
+	b, err := os.ReadFile(filepath.Join(root, res.Path))
+	if err != nil {
+		t.Fatalf("reading closeout: %v", err)
+	}
+	if !strings.Contains(string(b), "for 2 runs (2026-02-19T03:00:00+02:00 to 2026-02-19T01:30:00Z)") {
+		t.Fatalf("expected runs ordered by instant:\n%s", b)
+	}
+}
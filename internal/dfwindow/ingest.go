@@ -0,0 +1,403 @@
+package dfwindow
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+	"github.com/rickhallett/darkfactorio/internal/shadowpack"
+)
+
+// Source kinds for ingesting real run outcomes.
+const (
+	// SourceEnvelopes reads a run envelope (schemas/run-envelope-v0.1.json)
+	// or a directory of *.json envelopes, one run each.
+	SourceEnvelopes = "envelopes"
+	// SourceShadowPack reads a shadow-pack manifest and records its
+	// candidate results as one run, approved when the pack passes.
+	SourceShadowPack = "shadowpack"
+)
+
+// scenarioResultsFile is where an envelope's scenario outputs live, relative
+// to its artifacts_root. It is read when the envelope's metrics do not carry
+// scenario counts.
+const scenarioResultsFile = "scenario-results.json"
+
+// Source names run artifacts to ingest. Path is relative to the advance
+// root. PipelineClass, Retries and Interventions are required for shadow
+// packs, which do not carry them; envelopes take their class from their
+// tags and the counts from their metrics.
+type Source struct {
+	Kind          string
+	Path          string
+	PipelineClass string
+	Retries       *int
+	Interventions *int
+}
+
+func (s Source) validate() error {
+	switch s.Kind {
+	case SourceEnvelopes:
+	case SourceShadowPack:
+		if s.PipelineClass == "" {
+			return errors.New("pipeline_class is required for shadowpack sources")
+		}
+		if s.Retries == nil || s.Interventions == nil {
+			return errors.New("retries and interventions are required for shadowpack sources; shadow packs do not record them")
+		}
+		if *s.Retries < 0 || *s.Interventions < 0 {
+			return errors.New("retries/interventions cannot be negative")
+		}
+	default:
+		return fmt.Errorf("source kind must be %s|%s", SourceEnvelopes, SourceShadowPack)
+	}
+	if s.Path == "" {
+		return fmt.Errorf("%s source path is required", s.Kind)
+	}
+	return nil
+}
+
+// SkippedRun is a run found in the source that was not appended.
+type SkippedRun struct {
+	RunID  string
+	Reason string
+}
+
+// RunEnvelope mirrors schemas/run-envelope-v0.1.json.
+type RunEnvelope struct {
+	RunID                string         `json:"run_id"`
+	PipelineID           string         `json:"pipeline_id"`
+	PipelineVersion      string         `json:"pipeline_version"`
+	ScenarioSuiteID      string         `json:"scenario_suite_id"`
+	ScenarioSuiteVersion string         `json:"scenario_suite_version"`
+	FactoryProfileID     string         `json:"factory_profile_id"`
+	Status               string         `json:"status"`
+	CreatedAt            string         `json:"created_at"`
+	UpdatedAt            string         `json:"updated_at"`
+	ArtifactsRoot        string         `json:"artifacts_root"`
+	ActiveStageID        *string        `json:"active_stage_id"`
+	CheckpointRef        *string        `json:"checkpoint_ref"`
+	FinalOutcome         *string        `json:"final_outcome"`
+	Metrics              map[string]any `json:"metrics"`
+	Tags                 []string       `json:"tags"`
+}
+
+// ingest builds records for windowID from src. Runs already in the window
+// with identical content and runs that have not finished are skipped, so a
+// directory can be ingested again as new envelopes land in it. A run whose
+// ID is in the window with different content is an error, since appending
+// or skipping it would lose one of the two records. The records are decoded the
+// way the window file will be before anything is appended.
+func ingest(root string, src Source, windowID string, at time.Time, classes map[string]level4gate.PipelineClass, existing []level4gate.EvalRecord) ([]level4gate.EvalRecord, []SkippedRun, error) {
+	var recs []level4gate.EvalRecord
+	var skipped []SkippedRun
+	switch src.Kind {
+	case SourceEnvelopes:
+		paths, err := envelopePaths(filepath.Join(root, src.Path))
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, p := range paths {
+			env, err := loadJSON[RunEnvelope](p)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", p, err)
+			}
+			rec, reason, err := envelopeRecord(root, env, windowID, classes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", p, err)
+			}
+			if reason != "" {
+				skipped = append(skipped, SkippedRun{RunID: env.RunID, Reason: reason})
+				continue
+			}
+			recs = append(recs, rec)
+		}
+	case SourceShadowPack:
+		rec, err := shadowPackRecord(root, src, windowID, at)
+		if err != nil {
+			return nil, nil, err
+		}
+		recs = append(recs, rec)
+	}
+
+	inWindow := make(map[string]level4gate.EvalRecord, len(existing))
+	for _, r := range existing {
+		inWindow[r.RunID] = r
+	}
+	inSource := make(map[string]bool, len(recs))
+	added := make([]level4gate.EvalRecord, 0, len(recs))
+	var buf bytes.Buffer
+	for _, r := range recs {
+		if inSource[r.RunID] {
+			return nil, nil, fmt.Errorf("run %s appears twice in %s", r.RunID, src.Path)
+		}
+		inSource[r.RunID] = true
+		b, err := json.Marshal(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		if prev, ok := inWindow[r.RunID]; ok {
+			same, err := level4gate.SameRecord(prev, r)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !same {
+				pb, err := json.Marshal(prev)
+				if err != nil {
+					return nil, nil, err
+				}
+				return nil, nil, fmt.Errorf("run %s is already in window %s with different content:\n  window: %s\n  source: %s", r.RunID, windowID, pb, b)
+			}
+			skipped = append(skipped, SkippedRun{RunID: r.RunID, Reason: "already in window"})
+			continue
+		}
+		buf.Write(append(b, '\n'))
+		added = append(added, r)
+	}
+	if len(added) > 0 {
+		opts := level4gate.DecodeOptions{WindowID: windowID, PipelineClasses: classes}
+		if _, err := level4gate.DecodeNDJSONWithOptions(&buf, opts); err != nil {
+			return nil, nil, fmt.Errorf("ingested records are invalid: %w", err)
+		}
+	}
+	return added, skipped, nil
+}
+
+func envelopePaths(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(path, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no *.json envelopes in %s", path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// envelopeRecord maps a finished run envelope onto an EvalRecord. The
+// pipeline class is the one tag naming a declared class. Scenario counts
+// come from metrics.scenario_total and metrics.scenario_passed, or else from
+// the scenario outputs in artifacts_root. metrics.retries,
+// metrics.interventions, metrics.decision_reversed and
+// metrics.critical_incident are required, so an envelope that does not
+// report them fails the ingest instead of passing those gates by default;
+// first_pass_success defaults to retries == 0. A non-empty reason means the
+// run is not finished and was skipped.
+func envelopeRecord(root string, env RunEnvelope, windowID string, classes map[string]level4gate.PipelineClass) (level4gate.EvalRecord, string, error) {
+	if env.RunID == "" || env.PipelineID == "" {
+		return level4gate.EvalRecord{}, "", errors.New("run_id and pipeline_id are required")
+	}
+	switch env.Status {
+	case "approved", "rejected", "failed":
+	case "canceled":
+		return level4gate.EvalRecord{}, "canceled", nil
+	default:
+		return level4gate.EvalRecord{}, "status " + env.Status + " is not final", nil
+	}
+	updated, err := time.Parse(time.RFC3339, env.UpdatedAt)
+	if err != nil {
+		return level4gate.EvalRecord{}, "", fmt.Errorf("updated_at must be RFC3339: %w", err)
+	}
+
+	var class string
+	for _, tag := range env.Tags {
+		if _, ok := classes[tag]; !ok {
+			continue
+		}
+		if class != "" && class != tag {
+			return level4gate.EvalRecord{}, "", fmt.Errorf("run %s is tagged with classes %s and %s", env.RunID, class, tag)
+		}
+		class = tag
+	}
+	if class == "" {
+		return level4gate.EvalRecord{}, "", fmt.Errorf("run %s has no tag naming a declared pipeline class", env.RunID)
+	}
+
+	rec := level4gate.EvalRecord{
+		SchemaVersion: level4gate.CurrentSchemaVersion,
+		WindowID:      windowID,
+		RunID:         env.RunID,
+		PipelineID:    env.PipelineID,
+		PipelineClass: class,
+		Decision:      env.Status,
+		Timestamp:     updated.UTC().Format(time.RFC3339),
+		QualityMode:   level4gate.QualityStandard,
+	}
+	m := envelopeMetrics(env.Metrics)
+	if rec.Retries, err = m.integer("retries"); err != nil {
+		return level4gate.EvalRecord{}, "", err
+	}
+	if rec.Interventions, err = m.integer("interventions"); err != nil {
+		return level4gate.EvalRecord{}, "", err
+	}
+	if rec.DecisionReversed, err = m.boolean("decision_reversed"); err != nil {
+		return level4gate.EvalRecord{}, "", err
+	}
+	if rec.CriticalIncident, err = m.boolean("critical_incident"); err != nil {
+		return level4gate.EvalRecord{}, "", err
+	}
+	rec.FirstPassSuccess = rec.Retries == 0
+	if v, ok := env.Metrics["first_pass_success"]; ok {
+		b, isBool := v.(bool)
+		if !isBool {
+			return level4gate.EvalRecord{}, "", errors.New("metrics.first_pass_success must be a boolean")
+		}
+		rec.FirstPassSuccess = b
+	}
+
+	if _, ok := env.Metrics["scenario_total"]; ok {
+		if rec.ScenarioTotal, err = m.integer("scenario_total"); err != nil {
+			return level4gate.EvalRecord{}, "", err
+		}
+		if rec.ScenarioPassed, err = m.integer("scenario_passed"); err != nil {
+			return level4gate.EvalRecord{}, "", err
+		}
+	} else {
+		path := filepath.Join(root, env.ArtifactsRoot, scenarioResultsFile)
+		results, err := loadJSON[[]shadowpack.ScenarioResult](path)
+		if err != nil {
+			return level4gate.EvalRecord{}, "", fmt.Errorf("run %s has no scenario counts in metrics and no scenario outputs: %w", env.RunID, err)
+		}
+		rec.ScenarioTotal, rec.ScenarioPassed = countScenarios(results)
+	}
+
+	if rec.CostUSD, err = m.number("cost_usd"); err != nil {
+		return level4gate.EvalRecord{}, "", err
+	}
+	if rec.DurationSeconds, err = m.number("duration_seconds"); err != nil {
+		return level4gate.EvalRecord{}, "", err
+	}
+	for key, dst := range map[string]**int64{"tokens_in": &rec.TokensIn, "tokens_out": &rec.TokensOut} {
+		if _, ok := env.Metrics[key]; !ok {
+			continue
+		}
+		n, err := m.integer(key)
+		if err != nil {
+			return level4gate.EvalRecord{}, "", err
+		}
+		v := int64(n)
+		*dst = &v
+	}
+	return rec, "", nil
+}
+
+// envelopeMetrics reads typed values out of an envelope's free-form
+// metrics object.
+type envelopeMetrics map[string]any
+
+func (m envelopeMetrics) integer(key string) (int, error) {
+	v, ok := m[key]
+	if !ok {
+		return 0, fmt.Errorf("metrics.%s is required", key)
+	}
+	f, isNum := v.(float64)
+	if !isNum || f != math.Trunc(f) {
+		return 0, fmt.Errorf("metrics.%s must be a whole number", key)
+	}
+	return int(f), nil
+}
+
+func (m envelopeMetrics) boolean(key string) (bool, error) {
+	v, ok := m[key]
+	if !ok {
+		return false, fmt.Errorf("metrics.%s is required", key)
+	}
+	b, isBool := v.(bool)
+	if !isBool {
+		return false, fmt.Errorf("metrics.%s must be a boolean", key)
+	}
+	return b, nil
+}
+
+func (m envelopeMetrics) number(key string) (*float64, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, nil
+	}
+	f, isNum := v.(float64)
+	if !isNum {
+		return nil, fmt.Errorf("metrics.%s must be a number", key)
+	}
+	return &f, nil
+}
+
+// shadowPackRecord records a shadow pack's candidate results as one run
+// named after the pack. The pack verdict is the decision. Retries and
+// interventions come from the source, since packs do not record them, and
+// first-pass success is retries == 0. The verdict is produced at ingest, so
+// the run is not yet reversed or tied to an incident; later outcomes come
+// from the reversal and incident streams joined at evaluation.
+func shadowPackRecord(root string, src Source, windowID string, at time.Time) (level4gate.EvalRecord, error) {
+	report, err := shadowpack.Evaluate(root, src.Path)
+	if err != nil {
+		return level4gate.EvalRecord{}, fmt.Errorf("shadow pack %s: %w", src.Path, err)
+	}
+	m, err := loadJSON[shadowpack.Manifest](filepath.Join(root, src.Path))
+	if err != nil {
+		return level4gate.EvalRecord{}, err
+	}
+	results, err := loadJSON[[]shadowpack.ScenarioResult](filepath.Join(root, m.CandidateResults))
+	if err != nil {
+		return level4gate.EvalRecord{}, err
+	}
+	total, passed := countScenarios(results)
+	decision := "rejected"
+	if report.Passed {
+		decision = "approved"
+	}
+	return level4gate.EvalRecord{
+		SchemaVersion:    level4gate.CurrentSchemaVersion,
+		WindowID:         windowID,
+		RunID:            m.PackID,
+		PipelineID:       m.CandidateProducer,
+		PipelineClass:    src.PipelineClass,
+		ScenarioTotal:    total,
+		ScenarioPassed:   passed,
+		FirstPassSuccess: *src.Retries == 0,
+		Retries:          *src.Retries,
+		Interventions:    *src.Interventions,
+		Decision:         decision,
+		Timestamp:        at.UTC().Format(time.RFC3339),
+		QualityMode:      level4gate.QualityStandard,
+	}, nil
+}
+
+func countScenarios(results []shadowpack.ScenarioResult) (total, passed int) {
+	for _, r := range results {
+		total++
+		if r.Outcome == "pass" {
+			passed++
+		}
+	}
+	return total, passed
+}
+
+func loadJSON[T any](path string) (T, error) {
+	var out T
+	f, err := os.Open(path)
+	if err != nil {
+		return out, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&out); err != nil {
+		return out, err
+	}
+	return out, nil
+}
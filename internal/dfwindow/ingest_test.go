@@ -0,0 +1,167 @@
+package dfwindow
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const ingestProfile = `{"version":"b","min_runs":1,"thresholds":{"min_scenario_pass_rate_percent":50,"min_first_pass_rate_percent":0,"max_mean_retries":2,"max_decision_reversal_percent":5,"max_approved_incidents":0},"required_class_minimum":{"low_risk_feature":0,"medium_integration":0}}`
+
+func writeIngestProfiles(t *testing.T, root string) {
+	t.Helper()
+	mustWrite(t, filepath.Join(root, "profiles/level4-gate-v0.1-baseline.json"), ingestProfile)
+	mustWrite(t, filepath.Join(root, "profiles/level4-gate-v0.1-adversarial.json"), ingestProfile)
+}
+
+func TestAdvanceIngestsRunEnvelopes(t *testing.T) {
+	root := t.TempDir()
+	writeIngestProfiles(t, root)
+	mustWrite(t, filepath.Join(root, "envelopes/run-001.json"), `{"run_id":"run-001","pipeline_id":"p-low-001","pipeline_version":"1","scenario_suite_id":"s","scenario_suite_version":"v3","factory_profile_id":"f","status":"approved","created_at":"2026-02-18T20:00:00Z","updated_at":"2026-02-18T20:42:00+01:00","artifacts_root":"artifacts/run-001","metrics":{"scenario_total":10,"scenario_passed":9,"retries":0,"interventions":2,"decision_reversed":false,"critical_incident":false,"cost_usd":0.4},"tags":["nightly","low_risk_feature"]}`)
+	mustWrite(t, filepath.Join(root, "envelopes/run-002.json"), `{"run_id":"run-002","pipeline_id":"p-med-001","pipeline_version":"1","scenario_suite_id":"s","scenario_suite_version":"v3","factory_profile_id":"f","status":"rejected","created_at":"2026-02-18T21:00:00Z","updated_at":"2026-02-18T21:30:00Z","artifacts_root":"artifacts/run-002","metrics":{"retries":2,"interventions":1,"decision_reversed":true,"critical_incident":false},"tags":["medium_integration"]}`)
+	mustWrite(t, filepath.Join(root, "artifacts/run-002/scenario-results.json"), `[{"scenario_id":"s-1","outcome":"pass","latency_ms":10},{"scenario_id":"s-2","outcome":"fail","latency_ms":12},{"scenario_id":"s-3","outcome":"error","latency_ms":30}]`)
+	mustWrite(t, filepath.Join(root, "envelopes/run-003.json"), `{"run_id":"run-003","pipeline_id":"p-low-002","pipeline_version":"1","scenario_suite_id":"s","scenario_suite_version":"v3","factory_profile_id":"f","status":"executing","created_at":"2026-02-18T22:00:00Z","updated_at":"2026-02-18T22:05:00Z","artifacts_root":"artifacts/run-003","tags":["low_risk_feature"]}`)
+
+	opts := AdvanceOptions{
+		Root:        root,
+		WindowID:    "w-real",
+		Source:      Source{Kind: SourceEnvelopes, Path: "envelopes"},
+		LogLearning: true,
+	}
+	res, err := Advance(opts)
+	if err != nil {
+		t.Fatalf("Advance failed: %v", err)
+	}
+	if len(res.Added) != 2 || len(res.Skipped) != 1 || res.Skipped[0].RunID != "run-003" {
+		t.Fatalf("expected 2 added and run-003 skipped, got %+v / %+v", res.Added, res.Skipped)
+	}
+	first, second := res.Added[0], res.Added[1]
+	if first.PipelineClass != "low_risk_feature" || first.ScenarioPassed != 9 || !first.FirstPassSuccess || first.Timestamp != "2026-02-18T19:42:00Z" || first.CostUSD == nil {
+		t.Fatalf("unexpected envelope record: %+v", first)
+	}
+	if second.Decision != "rejected" || !second.DecisionReversed || second.ScenarioTotal != 3 || second.ScenarioPassed != 1 || second.FirstPassSuccess {
+		t.Fatalf("expected scenario counts from artifacts, got %+v", second)
+	}
+	if res.BaselineReport.Metrics.RunCount != 2 {
+		t.Fatalf("expected 2 runs evaluated, got %d", res.BaselineReport.Metrics.RunCount)
+	}
+	entry, err := os.ReadFile(res.LearningEntryPath)
+	if err != nil {
+		t.Fatalf("reading learning entry: %v", err)
+	}
+	if !strings.Contains(string(entry), "Record source=envelopes envelopes") || strings.Contains(string(entry), "SYNTHETIC") {
+		t.Fatalf("expected an envelope-sourced learning entry, got:\n%s", entry)
+	}
+
+	// Re-ingesting skips what the window already holds.
+	mustWrite(t, filepath.Join(root, "envelopes/run-003.json"), `{"run_id":"run-003","pipeline_id":"p-low-002","pipeline_version":"1","scenario_suite_id":"s","scenario_suite_version":"v3","factory_profile_id":"f","status":"approved","created_at":"2026-02-18T22:00:00Z","updated_at":"2026-02-18T22:45:00Z","artifacts_root":"artifacts/run-003","metrics":{"scenario_total":4,"scenario_passed":4,"retries":0,"interventions":0,"decision_reversed":false,"critical_incident":false},"tags":["low_risk_feature"]}`)
+	opts.LogLearning = false
+	res, err = Advance(opts)
+	if err != nil {
+		t.Fatalf("second Advance failed: %v", err)
+	}
+	if len(res.Added) != 1 || res.Added[0].RunID != "run-003" || len(res.Skipped) != 2 {
+		t.Fatalf("expected only run-003 appended, got %+v / %+v", res.Added, res.Skipped)
+	}
+	if _, err := Advance(opts); err == nil || !strings.Contains(err.Error(), "no new finished runs") {
+		t.Fatalf("expected no new runs error, got %v", err)
+	}
+}
+
+func TestAdvanceRejectsRunIDInWindowWithDifferentContent(t *testing.T) {
+	root := t.TempDir()
+	writeIngestProfiles(t, root)
+	if _, err := Advance(AdvanceOptions{Root: root, WindowID: "w", Synthetic: true, AppendCount: 1}); err != nil {
+		t.Fatalf("synthetic Advance failed: %v", err)
+	}
+	mustWrite(t, filepath.Join(root, "envelopes/run-001.json"), `{"run_id":"run-001","pipeline_id":"p-low-009","pipeline_version":"1","scenario_suite_id":"s","scenario_suite_version":"v3","factory_profile_id":"f","status":"approved","created_at":"2026-02-18T20:00:00Z","updated_at":"2026-02-18T20:42:00Z","artifacts_root":"artifacts/run-001","metrics":{"scenario_total":10,"scenario_passed":9,"retries":0,"interventions":2,"decision_reversed":false,"critical_incident":false},"tags":["low_risk_feature"]}`)
+
+	_, err := Advance(AdvanceOptions{Root: root, WindowID: "w", Source: Source{Kind: SourceEnvelopes, Path: "envelopes"}})
+	if err == nil || !strings.Contains(err.Error(), "run run-001 is already in window w with different content") ||
+		!strings.Contains(err.Error(), `source: {"schema_version":"level4-eval-record-v0.3","window_id":"w","run_id":"run-001","pipeline_id":"p-low-009"`) {
+		t.Fatalf("expected a conflicting run error showing both records, got %v", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(root, "runs", "w.ndjson"))
+	if strings.Count(string(b), "\n") != 1 {
+		t.Fatalf("expected the window untouched, got %q", b)
+	}
+}
+
+func TestAdvanceRejectsEnvelopesItCannotMap(t *testing.T) {
+	cases := map[string]string{
+		`"metrics":{"scenario_total":10,"scenario_passed":9,"retries":0,"interventions":0,"decision_reversed":false,"critical_incident":false},"tags":["nightly"]`:                               "has no tag naming a declared pipeline class",
+		`"metrics":{"scenario_total":10,"scenario_passed":9,"interventions":0,"decision_reversed":false,"critical_incident":false},"tags":["low_risk_feature"]`:                                  "metrics.retries is required",
+		`"metrics":{"scenario_total":10,"scenario_passed":11,"retries":0,"interventions":0,"decision_reversed":false,"critical_incident":false},"tags":["low_risk_feature"]`:                     "invalid scenario counts",
+		`"metrics":{"scenario_total":10,"scenario_passed":9,"retries":0,"interventions":0,"decision_reversed":false,"critical_incident":false},"tags":["low_risk_feature","medium_integration"]`: "tagged with classes",
+		`"metrics":{"retries":0,"interventions":0,"decision_reversed":false,"critical_incident":false},"tags":["low_risk_feature"]`:                                                              "no scenario outputs",
+		`"metrics":{"scenario_total":10,"scenario_passed":9,"retries":0,"interventions":0,"critical_incident":false},"tags":["low_risk_feature"]`:                                                "metrics.decision_reversed is required",
+		`"metrics":{"scenario_total":10,"scenario_passed":9,"retries":0.5,"interventions":0,"decision_reversed":false,"critical_incident":false},"tags":["low_risk_feature"]`:                    "metrics.retries must be a whole number",
+	}
+	for tail, want := range cases {
+		root := t.TempDir()
+		writeIngestProfiles(t, root)
+		mustWrite(t, filepath.Join(root, "run.json"), `{"run_id":"run-001","pipeline_id":"p","pipeline_version":"1","scenario_suite_id":"s","scenario_suite_version":"v3","factory_profile_id":"f","status":"approved","created_at":"2026-02-18T20:00:00Z","updated_at":"2026-02-18T20:42:00Z","artifacts_root":"artifacts/run-001",`+tail+`}`)
+		_, err := Advance(AdvanceOptions{Root: root, WindowID: "w", Source: Source{Kind: SourceEnvelopes, Path: "run.json"}})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: error = %v, want %q", tail, err, want)
+		}
+		if b, _ := os.ReadFile(filepath.Join(root, "runs/w.ndjson")); len(b) != 0 {
+			t.Fatalf("%s: expected nothing appended, got %s", tail, b)
+		}
+	}
+}
+
+func TestAdvanceIngestsShadowPack(t *testing.T) {
+	root := t.TempDir()
+	writeIngestProfiles(t, root)
+	mustWrite(t, filepath.Join(root, "pack/manifest.json"), `{"pack_id":"pack-1","candidate_results":"pack/candidate.json","holdout_results":"pack/holdout.json","candidate_producer":"agent-loop","holdout_producer":"qa-holdout","criteria":{"min_overlap":2,"max_outcome_mismatch_rate_percent":50,"max_p95_latency_drift_percent":50}}`)
+	mustWrite(t, filepath.Join(root, "pack/candidate.json"), `[{"scenario_id":"s-1","outcome":"pass","latency_ms":10},{"scenario_id":"s-2","outcome":"fail","latency_ms":11}]`)
+	mustWrite(t, filepath.Join(root, "pack/holdout.json"), `[{"scenario_id":"s-1","outcome":"pass","latency_ms":10},{"scenario_id":"s-2","outcome":"fail","latency_ms":12}]`)
+
+	if _, err := Advance(AdvanceOptions{Root: root, WindowID: "w", Source: Source{Kind: SourceShadowPack, Path: "pack/manifest.json"}}); err == nil {
+		t.Fatalf("expected shadow pack without a class to fail")
+	}
+	src := Source{Kind: SourceShadowPack, Path: "pack/manifest.json", PipelineClass: "medium_integration"}
+	if _, err := Advance(AdvanceOptions{Root: root, WindowID: "w", Source: src}); err == nil || !strings.Contains(err.Error(), "retries and interventions are required") {
+		t.Fatalf("expected shadow pack without retries to fail, got %v", err)
+	}
+	retries, interventions := 1, 2
+	src.Retries, src.Interventions = &retries, &interventions
+	res, err := Advance(AdvanceOptions{Root: root, WindowID: "w", Source: src})
+	if err != nil {
+		t.Fatalf("Advance failed: %v", err)
+	}
+	rec := res.Added[0]
+	if rec.RunID != "pack-1" || rec.PipelineID != "agent-loop" || rec.Decision != "approved" || rec.ScenarioTotal != 2 || rec.ScenarioPassed != 1 || rec.Retries != 1 || rec.Interventions != 2 || rec.FirstPassSuccess {
+		t.Fatalf("unexpected shadow pack record: %+v", rec)
+	}
+}
+
+func TestAdvanceRequiresExplicitRecordSource(t *testing.T) {
+	root := t.TempDir()
+	writeIngestProfiles(t, root)
+	if _, err := Advance(AdvanceOptions{Root: root, WindowID: "w"}); err == nil {
+		t.Fatalf("expected an error without a source or synthetic")
+	}
+	src := Source{Kind: SourceEnvelopes, Path: "envelopes"}
+	if _, err := Advance(AdvanceOptions{Root: root, WindowID: "w", Source: src, Synthetic: true}); err == nil {
+		t.Fatalf("expected an error with both a source and synthetic")
+	}
+	_, err := Advance(AdvanceOptions{Root: root, WindowID: "w", Source: src, QualityMode: "high", QualityReason: "remediation"})
+	if err == nil || !strings.Contains(err.Error(), "only applies to synthetic records") {
+		t.Fatalf("expected quality mode to be rejected for ingest, got %v", err)
+	}
+
+	res, err := Advance(AdvanceOptions{Root: root, WindowID: "w", Synthetic: true, AppendCount: 1, LogLearning: true})
+	if err != nil {
+		t.Fatalf("synthetic Advance failed: %v", err)
+	}
+	entry, err := os.ReadFile(res.LearningEntryPath)
+	if err != nil {
+		t.Fatalf("reading learning entry: %v", err)
+	}
+	if !strings.Contains(string(entry), "SYNTHETIC window advance") || !strings.Contains(string(entry), "Record source=synthetic") {
+		t.Fatalf("expected the learning entry to be labelled synthetic, got:\n%s", entry)
+	}
+}
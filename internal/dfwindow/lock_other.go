@@ -0,0 +1,34 @@
+//go:build !unix
+
+package dfwindow
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockTimeout bounds how long lockFile waits for another writer.
+const lockTimeout = 30 * time.Second
+
+// lockFile takes the lock by creating path exclusively and retries until
+// the holder removes it. A writer that dies holding the lock leaves the
+// file behind; remove it by hand once no writer is running.
+func lockFile(path string) (func() error, error) {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() error { return os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package dfwindow
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive flock on path, creating it if needed, and
+// blocks until the lock is granted. flock locks belong to the open file,
+// so goroutines in one process exclude each other as processes do.
+func lockFile(path string) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() error {
+		defer f.Close()
+		return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	}, nil
+}
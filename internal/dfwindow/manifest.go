@@ -0,0 +1,448 @@
+package dfwindow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rickhallett/darkfactorio/internal/atomicfile"
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+)
+
+// ManifestSchemaVersion identifies schemas/window-manifest-v0.1.json.
+const ManifestSchemaVersion = "window-manifest-v0.1"
+
+// Window states. An open window accepts appends; a frozen window refuses
+// them while its closeout is prepared; a closed window is final and its
+// content hash is fixed.
+const (
+	StateOpen   = "open"
+	StateFrozen = "frozen"
+	StateClosed = "closed"
+)
+
+// Manifest records a window's lifecycle next to its NDJSON file. Windows
+// without a manifest predate lifecycle tracking and stay appendable.
+// ContentSHA256 and RunCount are taken when the window is frozen and again
+// when it is closed. Closed is the last state: there is no archive step, and
+// a closed window stays in place for replays and verification. A backfilled
+// manifest was written after the window finished; its times are the first
+// and last run timestamps, and it has no frozen_at.
+type Manifest struct {
+	SchemaVersion string            `json:"schema_version"`
+	WindowID      string            `json:"window_id"`
+	State         string            `json:"state"`
+	RunsPath      string            `json:"runs_path"`
+	Criteria      []CriteriaVersion `json:"criteria"`
+	OpenedAt      string            `json:"opened_at"`
+	FrozenAt      string            `json:"frozen_at,omitempty"`
+	ClosedAt      string            `json:"closed_at,omitempty"`
+	RunCount      int               `json:"run_count,omitempty"`
+	ContentSHA256 string            `json:"content_sha256,omitempty"`
+	Backfilled    bool              `json:"backfilled,omitempty"`
+}
+
+// CriteriaVersion pins a criteria profile the window is judged against.
+// SHA256 hashes the criteria as resolved (after extends), so an edit that
+// keeps the version string is still caught.
+type CriteriaVersion struct {
+	Role    string `json:"role"`
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	SHA256  string `json:"sha256"`
+}
+
+// LifecycleOptions locates a window. RunsPath and the criteria paths
+// default as in AdvanceOptions; At defaults to now.
+type LifecycleOptions struct {
+	Root                string
+	WindowID            string
+	RunsPath            string
+	BaselineCriteria    string
+	AdversarialCriteria string
+	At                  time.Time
+}
+
+func (o *LifecycleOptions) defaults() error {
+	if o.Root == "" {
+		o.Root = "."
+	}
+	if o.WindowID == "" {
+		return errors.New("window_id is required")
+	}
+	if o.RunsPath == "" {
+		o.RunsPath = filepath.Join("runs", o.WindowID+".ndjson")
+	}
+	if o.BaselineCriteria == "" {
+		o.BaselineCriteria = filepath.Join("profiles", "level4-gate-v0.1-baseline.json")
+	}
+	if o.AdversarialCriteria == "" {
+		o.AdversarialCriteria = filepath.Join("profiles", "level4-gate-v0.1-adversarial.json")
+	}
+	if o.At.IsZero() {
+		o.At = time.Now().UTC()
+	}
+	return nil
+}
+
+// ManifestPath returns the manifest path for a runs file:
+// runs/<window>.ndjson has runs/<window>.manifest.json.
+func ManifestPath(runsPath string) string {
+	return strings.TrimSuffix(runsPath, ".ndjson") + ".manifest.json"
+}
+
+// LoadManifest reads the manifest for runsPath. It returns nil and no error
+// when the window has none.
+func LoadManifest(root, runsPath string) (*Manifest, error) {
+	path := filepath.Join(root, ManifestPath(runsPath))
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	m, err := loadJSON[Manifest](path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// OpenWindow writes an open manifest pinning the current criteria versions
+// and creates the runs file when it does not exist yet.
+func OpenWindow(opts LifecycleOptions) (Manifest, error) {
+	if err := opts.defaults(); err != nil {
+		return Manifest{}, err
+	}
+	existing, err := LoadManifest(opts.Root, opts.RunsPath)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if existing != nil {
+		return Manifest{}, fmt.Errorf("window %s already has a manifest (state %s)", opts.WindowID, existing.State)
+	}
+	criteria, err := criteriaVersions(opts.Root, opts.BaselineCriteria, opts.AdversarialCriteria)
+	if err != nil {
+		return Manifest{}, err
+	}
+	absRuns := filepath.Join(opts.Root, opts.RunsPath)
+	if err := os.MkdirAll(filepath.Dir(absRuns), 0o755); err != nil {
+		return Manifest{}, err
+	}
+	m := Manifest{
+		SchemaVersion: ManifestSchemaVersion,
+		WindowID:      opts.WindowID,
+		State:         StateOpen,
+		RunsPath:      filepath.ToSlash(opts.RunsPath),
+		Criteria:      criteria,
+		OpenedAt:      opts.At.UTC().Format(time.RFC3339),
+	}
+	err = withRunsLock(absRuns, func() error {
+		existing, err := LoadManifest(opts.Root, opts.RunsPath)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return fmt.Errorf("window %s already has a manifest (state %s)", opts.WindowID, existing.State)
+		}
+		if err := touchFile(absRuns); err != nil {
+			return err
+		}
+		return writeManifest(opts.Root, opts.RunsPath, m)
+	})
+	if err != nil {
+		return Manifest{}, err
+	}
+	return m, nil
+}
+
+// FreezeWindow stops appends to an open window and records its content
+// hash, so changes made before closeout are caught by CloseWindow.
+func FreezeWindow(opts LifecycleOptions) (Manifest, error) {
+	if err := opts.defaults(); err != nil {
+		return Manifest{}, err
+	}
+	return transition(opts, []string{StateOpen}, func(m *Manifest) error {
+		var err error
+		if m.RunCount, m.ContentSHA256, err = hashRuns(opts.Root, opts.RunsPath); err != nil {
+			return err
+		}
+		m.State = StateFrozen
+		m.FrozenAt = opts.At.UTC().Format(time.RFC3339)
+		return nil
+	})
+}
+
+// CloseWindow makes an open or frozen window final. A frozen window whose
+// runs changed since it was frozen is not closed.
+func CloseWindow(opts LifecycleOptions) (Manifest, error) {
+	if err := opts.defaults(); err != nil {
+		return Manifest{}, err
+	}
+	return transition(opts, []string{StateOpen, StateFrozen}, func(m *Manifest) error {
+		count, sum, err := hashRuns(opts.Root, opts.RunsPath)
+		if err != nil {
+			return err
+		}
+		if m.State == StateFrozen && sum != m.ContentSHA256 {
+			return fmt.Errorf("window %s changed while frozen (sha256 %s, frozen as %s)", m.WindowID, sum, m.ContentSHA256)
+		}
+		if count == 0 {
+			return fmt.Errorf("window %s has no runs to close", m.WindowID)
+		}
+		m.State = StateClosed
+		m.ClosedAt = opts.At.UTC().Format(time.RFC3339)
+		m.RunCount = count
+		m.ContentSHA256 = sum
+		return nil
+	})
+}
+
+// BackfillWindow writes a closed manifest for a finished window that has
+// none. The window opens at its earliest run timestamp and closes at its
+// latest; there is no frozen_at, and the manifest is marked backfilled.
+func BackfillWindow(opts LifecycleOptions) (Manifest, error) {
+	if err := opts.defaults(); err != nil {
+		return Manifest{}, err
+	}
+	criteria, err := criteriaVersions(opts.Root, opts.BaselineCriteria, opts.AdversarialCriteria)
+	if err != nil {
+		return Manifest{}, err
+	}
+	var m Manifest
+	err = withRunsLock(filepath.Join(opts.Root, opts.RunsPath), func() error {
+		existing, err := LoadManifest(opts.Root, opts.RunsPath)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return fmt.Errorf("window %s already has a manifest (state %s)", opts.WindowID, existing.State)
+		}
+		first, last, err := runSpan(filepath.Join(opts.Root, opts.RunsPath), opts.WindowID)
+		if err != nil {
+			return err
+		}
+		count, sum, err := hashRuns(opts.Root, opts.RunsPath)
+		if err != nil {
+			return err
+		}
+		m = Manifest{
+			SchemaVersion: ManifestSchemaVersion,
+			WindowID:      opts.WindowID,
+			State:         StateClosed,
+			RunsPath:      filepath.ToSlash(opts.RunsPath),
+			Criteria:      criteria,
+			OpenedAt:      first.Format(time.RFC3339),
+			ClosedAt:      last.Format(time.RFC3339),
+			RunCount:      count,
+			ContentSHA256: sum,
+			Backfilled:    true,
+		}
+		return writeManifest(opts.Root, opts.RunsPath, m)
+	})
+	if err != nil {
+		return Manifest{}, err
+	}
+	return m, nil
+}
+
+// VerifyResult lists what no longer matches a window's manifest. A window
+// is intact when Problems is empty.
+type VerifyResult struct {
+	Manifest Manifest `json:"manifest"`
+	RunCount int      `json:"run_count"`
+	SHA256   string   `json:"sha256"`
+	Problems []string `json:"problems"`
+}
+
+// VerifyWindow checks a window against its manifest: the pinned criteria
+// must still load with the same version and hash, and a frozen or closed window's runs must hash
+// to the recorded content hash.
+func VerifyWindow(opts LifecycleOptions) (VerifyResult, error) {
+	if err := opts.defaults(); err != nil {
+		return VerifyResult{}, err
+	}
+	m, err := LoadManifest(opts.Root, opts.RunsPath)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+	if m == nil {
+		return VerifyResult{}, fmt.Errorf("window %s has no manifest", opts.WindowID)
+	}
+	res := VerifyResult{Manifest: *m, Problems: []string{}}
+	if m.WindowID != opts.WindowID {
+		res.Problems = append(res.Problems, fmt.Sprintf("manifest is for window %s", m.WindowID))
+	}
+	for _, c := range m.Criteria {
+		current, err := level4gate.LoadCriteria(filepath.Join(opts.Root, c.Path))
+		if err != nil {
+			res.Problems = append(res.Problems, fmt.Sprintf("%s criteria %s: %v", c.Role, c.Path, err))
+			continue
+		}
+		if current.Version != c.Version {
+			res.Problems = append(res.Problems, fmt.Sprintf("%s criteria %s is version %s, window pinned %s", c.Role, c.Path, current.Version, c.Version))
+			continue
+		}
+		sum, err := criteriaDigest(current)
+		if err != nil {
+			return VerifyResult{}, err
+		}
+		if sum != c.SHA256 {
+			res.Problems = append(res.Problems, fmt.Sprintf("%s criteria %s has sha256 %s, window pinned %s", c.Role, c.Path, sum, c.SHA256))
+		}
+	}
+	res.RunCount, res.SHA256, err = hashRuns(opts.Root, opts.RunsPath)
+	if err != nil {
+		res.Problems = append(res.Problems, err.Error())
+		return res, nil
+	}
+	if m.State == StateOpen {
+		return res, nil
+	}
+	if res.SHA256 != m.ContentSHA256 {
+		res.Problems = append(res.Problems, fmt.Sprintf("runs sha256 %s does not match %s recorded when %s", res.SHA256, m.ContentSHA256, m.State))
+	}
+	if res.RunCount != m.RunCount {
+		res.Problems = append(res.Problems, fmt.Sprintf("run_count %d does not match %d recorded when %s", res.RunCount, m.RunCount, m.State))
+	}
+	return res, nil
+}
+
+// checkAppendable refuses appends to frozen and closed windows and to
+// windows judged against different criteria versions or content than they
+// were opened with.
+func checkAppendable(root, runsPath, windowID string, loaded map[string]level4gate.Criteria) error {
+	m, err := LoadManifest(root, runsPath)
+	if err != nil || m == nil {
+		return err
+	}
+	if m.State != StateOpen {
+		return fmt.Errorf("window %s is %s; appends are refused", windowID, m.State)
+	}
+	for _, c := range m.Criteria {
+		current, ok := loaded[c.Role]
+		if !ok {
+			continue
+		}
+		if current.Version != c.Version {
+			return fmt.Errorf("window %s pins %s criteria %s, got %s", windowID, c.Role, c.Version, current.Version)
+		}
+		sum, err := criteriaDigest(current)
+		if err != nil {
+			return err
+		}
+		if sum != c.SHA256 {
+			return fmt.Errorf("window %s pins %s criteria %s with sha256 %s, got %s", windowID, c.Role, c.Version, c.SHA256, sum)
+		}
+	}
+	return nil
+}
+
+// transition applies fn to the window's manifest under the window lock,
+// provided the window is in one of the from states, and saves the result.
+// opts must already carry its defaults.
+func transition(opts LifecycleOptions, from []string, fn func(*Manifest) error) (Manifest, error) {
+	var out Manifest
+	err := withRunsLock(filepath.Join(opts.Root, opts.RunsPath), func() error {
+		m, err := LoadManifest(opts.Root, opts.RunsPath)
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			return fmt.Errorf("window %s has no manifest; open it first", opts.WindowID)
+		}
+		allowed := false
+		for _, s := range from {
+			allowed = allowed || m.State == s
+		}
+		if !allowed {
+			return fmt.Errorf("window %s is %s (want %s)", opts.WindowID, m.State, strings.Join(from, "|"))
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+		out = *m
+		return writeManifest(opts.Root, opts.RunsPath, out)
+	})
+	return out, err
+}
+
+func criteriaVersions(root, baseline, adversarial string) ([]CriteriaVersion, error) {
+	out := make([]CriteriaVersion, 0, 2)
+	for _, c := range []CriteriaVersion{{Role: "baseline", Path: baseline}, {Role: "adversarial", Path: adversarial}} {
+		loaded, err := level4gate.LoadCriteria(filepath.Join(root, c.Path))
+		if err != nil {
+			return nil, err
+		}
+		c.Path = filepath.ToSlash(c.Path)
+		c.Version = loaded.Version
+		if c.SHA256, err = criteriaDigest(loaded); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// criteriaDigest is the sha256 of the resolved criteria's JSON encoding.
+func criteriaDigest(c level4gate.Criteria) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// runSpan returns the earliest and latest run timestamps in a runs file.
+func runSpan(path, windowID string) (time.Time, time.Time, error) {
+	records, err := level4gate.LoadNDJSON(path, windowID)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if len(records) == 0 {
+		return time.Time{}, time.Time{}, fmt.Errorf("%s has no runs to backfill", path)
+	}
+	var first, last time.Time
+	for _, r := range records {
+		at, err := time.Parse(time.RFC3339, r.Timestamp)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%s: run %s: invalid timestamp %q", path, r.RunID, r.Timestamp)
+		}
+		if first.IsZero() || at.Before(first) {
+			first = at
+		}
+		if at.After(last) {
+			last = at
+		}
+	}
+	return first.UTC(), last.UTC(), nil
+}
+
+// hashRuns returns the number of non-blank lines in the runs file and the
+// sha256 of the whole file.
+func hashRuns(root, runsPath string) (int, string, error) {
+	b, err := os.ReadFile(filepath.Join(root, runsPath))
+	if err != nil {
+		return 0, "", err
+	}
+	sum := sha256.Sum256(b)
+	count := 0
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	return count, hex.EncodeToString(sum[:]), nil
+}
+
+func writeManifest(root, runsPath string, m Manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.Write(filepath.Join(root, ManifestPath(runsPath)), append(b, '\n'), 0o644)
+}
@@ -0,0 +1,150 @@
+package dfwindow
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWindowLifecycleRefusesAppendsAndDetectsTampering(t *testing.T) {
+	root := t.TempDir()
+	writeIngestProfiles(t, root)
+	lc := LifecycleOptions{Root: root, WindowID: "w", At: time.Date(2026, 2, 18, 20, 0, 0, 0, time.UTC)}
+	advance := AdvanceOptions{Root: root, WindowID: "w", Synthetic: true, AppendCount: 2}
+
+	m, err := OpenWindow(lc)
+	if err != nil {
+		t.Fatalf("OpenWindow failed: %v", err)
+	}
+	if m.State != StateOpen || m.OpenedAt != "2026-02-18T20:00:00Z" || len(m.Criteria) != 2 || m.Criteria[0].Version != "b" {
+		t.Fatalf("unexpected manifest: %+v", m)
+	}
+	if _, err := OpenWindow(lc); err == nil {
+		t.Fatalf("expected a second open to fail")
+	}
+	if _, err := Advance(advance); err != nil {
+		t.Fatalf("Advance on an open window failed: %v", err)
+	}
+
+	if m, err = FreezeWindow(lc); err != nil {
+		t.Fatalf("FreezeWindow failed: %v", err)
+	}
+	if m.RunCount != 2 || m.ContentSHA256 == "" {
+		t.Fatalf("expected the frozen manifest to pin 2 runs, got %+v", m)
+	}
+	if _, err := Advance(advance); err == nil || !strings.Contains(err.Error(), "window w is frozen; appends are refused") {
+		t.Fatalf("expected frozen window to refuse appends, got %v", err)
+	}
+
+	runs := filepath.Join(root, "runs/w.ndjson")
+	original, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	tampered := strings.Replace(string(original), `"scenario_passed":11`, `"scenario_passed":12`, 1)
+	if tampered == string(original) {
+		t.Fatalf("expected the fixture to contain scenario_passed 11:\n%s", original)
+	}
+	mustWrite(t, runs, tampered)
+	if _, err := CloseWindow(lc); err == nil || !strings.Contains(err.Error(), "changed while frozen") {
+		t.Fatalf("expected close to refuse a window changed while frozen, got %v", err)
+	}
+	mustWrite(t, runs, string(original))
+	if m, err = CloseWindow(lc); err != nil {
+		t.Fatalf("CloseWindow failed: %v", err)
+	}
+	if m.State != StateClosed || m.ClosedAt == "" {
+		t.Fatalf("unexpected closed manifest: %+v", m)
+	}
+	if _, err := Advance(advance); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Fatalf("expected closed window to refuse appends, got %v", err)
+	}
+
+	res, err := VerifyWindow(lc)
+	if err != nil {
+		t.Fatalf("VerifyWindow failed: %v", err)
+	}
+	if len(res.Problems) != 0 {
+		t.Fatalf("expected an intact window, got %v", res.Problems)
+	}
+
+	mustWrite(t, runs, tampered)
+	mustWrite(t, filepath.Join(root, "profiles/level4-gate-v0.1-baseline.json"), strings.Replace(ingestProfile, `"version":"b"`, `"version":"b2"`, 1))
+	res, err = VerifyWindow(lc)
+	if err != nil {
+		t.Fatalf("VerifyWindow failed: %v", err)
+	}
+	if len(res.Problems) != 2 || !strings.Contains(res.Problems[0], "is version b2, window pinned b") || !strings.Contains(res.Problems[1], "does not match") {
+		t.Fatalf("expected criteria and hash problems, got %v", res.Problems)
+	}
+}
+
+func TestAdvanceRefusesCriteriaVersionChangeOnOpenWindow(t *testing.T) {
+	root := t.TempDir()
+	writeIngestProfiles(t, root)
+	if _, err := OpenWindow(LifecycleOptions{Root: root, WindowID: "w"}); err != nil {
+		t.Fatalf("OpenWindow failed: %v", err)
+	}
+	mustWrite(t, filepath.Join(root, "profiles/level4-gate-v0.1-adversarial.json"), strings.Replace(ingestProfile, `"version":"b"`, `"version":"a2"`, 1))
+	_, err := Advance(AdvanceOptions{Root: root, WindowID: "w", Synthetic: true})
+	if err == nil || !strings.Contains(err.Error(), "pins adversarial criteria b, got a2") {
+		t.Fatalf("expected criteria version error, got %v", err)
+	}
+	if _, err := CloseWindow(LifecycleOptions{Root: root, WindowID: "w"}); err == nil || !strings.Contains(err.Error(), "no runs to close") {
+		t.Fatalf("expected an empty window to stay open, got %v", err)
+	}
+}
+
+func TestCriteriaEditKeepingVersionIsCaught(t *testing.T) {
+	root := t.TempDir()
+	writeIngestProfiles(t, root)
+	lc := LifecycleOptions{Root: root, WindowID: "w"}
+	if _, err := OpenWindow(lc); err != nil {
+		t.Fatalf("OpenWindow failed: %v", err)
+	}
+	edited := strings.Replace(ingestProfile, `"min_runs":1`, `"min_runs":2`, 1)
+	if edited == ingestProfile {
+		t.Fatalf("expected the fixture to contain min_runs 1:\n%s", ingestProfile)
+	}
+	mustWrite(t, filepath.Join(root, "profiles/level4-gate-v0.1-baseline.json"), edited)
+
+	_, err := Advance(AdvanceOptions{Root: root, WindowID: "w", Synthetic: true})
+	if err == nil || !strings.Contains(err.Error(), "pins baseline criteria b with sha256") {
+		t.Fatalf("expected a criteria hash error, got %v", err)
+	}
+	res, err := VerifyWindow(lc)
+	if err != nil {
+		t.Fatalf("VerifyWindow failed: %v", err)
+	}
+	if len(res.Problems) != 1 || !strings.Contains(res.Problems[0], "baseline criteria profiles/level4-gate-v0.1-baseline.json has sha256") {
+		t.Fatalf("expected one criteria hash problem, got %v", res.Problems)
+	}
+}
+
+func TestBackfillWindowTakesTimesFromRuns(t *testing.T) {
+	root := t.TempDir()
+	writeIngestProfiles(t, root)
+	mustWrite(t, filepath.Join(root, "runs/w.ndjson"), `{"window_id":"w","run_id":"run-001","pipeline_id":"p","pipeline_class":"low_risk_feature","scenario_total":1,"scenario_passed":1,"first_pass_success":true,"retries":0,"interventions":0,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"2026-02-19T10:00:00Z"}
+{"window_id":"w","run_id":"run-002","pipeline_id":"p","pipeline_class":"low_risk_feature","scenario_total":1,"scenario_passed":1,"first_pass_success":true,"retries":0,"interventions":0,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"2026-02-18T09:00:00Z"}
+`)
+	lc := LifecycleOptions{Root: root, WindowID: "w", At: time.Date(2026, 10, 18, 6, 0, 0, 0, time.UTC)}
+	m, err := BackfillWindow(lc)
+	if err != nil {
+		t.Fatalf("BackfillWindow failed: %v", err)
+	}
+	if !m.Backfilled || m.State != StateClosed || m.OpenedAt != "2026-02-18T09:00:00Z" || m.ClosedAt != "2026-02-19T10:00:00Z" || m.FrozenAt != "" || m.RunCount != 2 {
+		t.Fatalf("unexpected backfilled manifest: %+v", m)
+	}
+	if _, err := BackfillWindow(lc); err == nil || !strings.Contains(err.Error(), "already has a manifest") {
+		t.Fatalf("expected a second backfill to fail, got %v", err)
+	}
+	res, err := VerifyWindow(lc)
+	if err != nil {
+		t.Fatalf("VerifyWindow failed: %v", err)
+	}
+	if len(res.Problems) != 0 {
+		t.Fatalf("expected an intact window, got %v", res.Problems)
+	}
+}
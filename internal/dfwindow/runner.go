@@ -1,11 +1,11 @@
 package dfwindow
 
 import (
-	"bufio"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,10 +13,21 @@ import (
 	"github.com/rickhallett/darkfactorio/internal/level4gate"
 )
 
+// AdvanceOptions appends runs to a window and re-evaluates it. Records come
+// from Source, which ingests real run artifacts, or, when Synthetic is set,
+// from a generator that fabricates AppendCount runs. Exactly one of the two
+// must be chosen; QualityMode applies to synthetic records only.
+//
+// When the advance takes the window to TargetRuns, a closeout decision
+// record is written too, whether or not LogLearning is set. TargetRuns
+// defaults to the baseline profile's min_runs; a negative value turns the
+// record off.
 type AdvanceOptions struct {
 	Root                string
 	WindowID            string
 	RunsPath            string
+	Source              Source
+	Synthetic           bool
 	AppendCount         int
 	StartTime           time.Time
 	Interval            time.Duration
@@ -25,14 +36,21 @@ type AdvanceOptions struct {
 	LogLearning         bool
 	QualityMode         string
 	QualityReason       string
+	TargetRuns          int
 }
 
+// AdvanceResult describes a completed advance. Once runs are appended the
+// advance has happened, so a learning entry or closeout that cannot be
+// written is reported in Warnings rather than as an error.
 type AdvanceResult struct {
 	RunsPath          string
 	Added             []level4gate.EvalRecord
+	Skipped           []SkippedRun
 	BaselineReport    level4gate.GateReport
 	AdversarialReport level4gate.GateReport
 	LearningEntryPath string
+	CloseoutPath      string
+	Warnings          []string
 }
 
 func Advance(opts AdvanceOptions) (AdvanceResult, error) {
@@ -69,87 +87,73 @@ func Advance(opts AdvanceOptions) (AdvanceResult, error) {
 	if opts.QualityMode == "high" && strings.TrimSpace(opts.QualityReason) == "" {
 		return AdvanceResult{}, fmt.Errorf("quality_reason is required when quality_mode=high")
 	}
-
-	absRuns := filepath.Join(opts.Root, opts.RunsPath)
-	if err := os.MkdirAll(filepath.Dir(absRuns), 0o755); err != nil {
-		return AdvanceResult{}, err
+	if opts.Synthetic == (opts.Source.Kind != "") {
+		return AdvanceResult{}, fmt.Errorf("choose a run source or synthetic records, not both or neither")
 	}
-	if _, err := os.Stat(absRuns); os.IsNotExist(err) {
-		if err := os.WriteFile(absRuns, []byte(""), 0o644); err != nil {
+	if !opts.Synthetic {
+		if err := opts.Source.validate(); err != nil {
 			return AdvanceResult{}, err
 		}
+		if opts.QualityMode != "standard" {
+			return AdvanceResult{}, fmt.Errorf("quality_mode=%s only applies to synthetic records", opts.QualityMode)
+		}
 	}
 
-	existing, err := level4gate.LoadNDJSON(absRuns, opts.WindowID)
+	baseline, err := level4gate.LoadCriteria(filepath.Join(opts.Root, opts.BaselineCriteria))
 	if err != nil {
-		// allow empty file bootstrap
-		if err.Error() != "no records matched filter" {
-			return AdvanceResult{}, err
-		}
-		existing = nil
+		return AdvanceResult{}, err
 	}
-
-	classCounts := map[string]int{
-		"low_risk_feature":   0,
-		"medium_integration": 0,
+	adversarial, err := level4gate.LoadCriteria(filepath.Join(opts.Root, opts.AdversarialCriteria))
+	if err != nil {
+		return AdvanceResult{}, err
 	}
-	for _, r := range existing {
-		classCounts[r.PipelineClass]++
+	decodeOpts := level4gate.DecodeOptions{
+		WindowID:        opts.WindowID,
+		PipelineClasses: baseline.Classes(),
 	}
 
-	added := make([]level4gate.EvalRecord, 0, opts.AppendCount)
-	for i := 0; i < opts.AppendCount; i++ {
-		runIdx := len(existing) + i + 1
-		className := "low_risk_feature"
-		pipelinePrefix := "p-low"
-		if runIdx%2 == 0 {
-			className = "medium_integration"
-			pipelinePrefix = "p-med"
+	// Reading the window, numbering new runs and appending them happen
+	// under one lock so concurrent advancers never reuse a run ID.
+	absRuns := filepath.Join(opts.Root, opts.RunsPath)
+	if err := os.MkdirAll(filepath.Dir(absRuns), 0o755); err != nil {
+		return AdvanceResult{}, err
+	}
+	var added, all []level4gate.EvalRecord
+	var skipped []SkippedRun
+	err = withRunsLock(absRuns, func() error {
+		if err := touchFile(absRuns); err != nil {
+			return err
 		}
-		classCounts[className]++
-		scenarioTotal := 10 + (runIdx % 3) // 10,11,12 cycle
-		scenarioPassed := scenarioTotal
-		switch opts.QualityMode {
-		case "standard":
-			scenarioPassed = scenarioTotal - 1
-			if runIdx%5 == 0 {
-				scenarioPassed = scenarioTotal // occasional perfect pass
-			}
-		case "high":
-			// remediation mode: force perfect scenario outcomes.
-			scenarioPassed = scenarioTotal
+		if err := checkAppendable(opts.Root, opts.RunsPath, opts.WindowID, map[string]level4gate.Criteria{"baseline": baseline, "adversarial": adversarial}); err != nil {
+			return err
 		}
-		rec := level4gate.EvalRecord{
-			WindowID:         opts.WindowID,
-			RunID:            fmt.Sprintf("run-%03d", runIdx),
-			PipelineID:       fmt.Sprintf("%s-%03d", pipelinePrefix, classCounts[className]),
-			PipelineClass:    className,
-			ScenarioTotal:    scenarioTotal,
-			ScenarioPassed:   scenarioPassed,
-			FirstPassSuccess: true,
-			Retries:          1,
-			Interventions:    1,
-			Decision:         "approved",
-			DecisionReversed: false,
-			CriticalIncident: false,
-			Timestamp:        opts.StartTime.Add(time.Duration(i) * opts.Interval).UTC().Format(time.RFC3339),
+		existing, err := level4gate.LoadNDJSONWithOptions(absRuns, decodeOpts)
+		if err != nil {
+			// allow empty file bootstrap
+			if err.Error() != "no records matched filter" {
+				return err
+			}
+			existing = nil
 		}
-		added = append(added, rec)
-	}
 
-	if err := appendRecords(absRuns, added); err != nil {
-		return AdvanceResult{}, err
-	}
+		if opts.Synthetic {
+			added = synthesize(opts, baseline, existing)
+		} else {
+			added, skipped, err = ingest(opts.Root, opts.Source, opts.WindowID, opts.StartTime, baseline.Classes(), existing)
+			if err != nil {
+				return err
+			}
+			if len(added) == 0 {
+				return fmt.Errorf("%s %s has no new finished runs for window %s", opts.Source.Kind, opts.Source.Path, opts.WindowID)
+			}
+		}
 
-	all, err := level4gate.LoadNDJSON(absRuns, opts.WindowID)
-	if err != nil {
-		return AdvanceResult{}, err
-	}
-	baseline, err := loadCriteria(filepath.Join(opts.Root, opts.BaselineCriteria))
-	if err != nil {
-		return AdvanceResult{}, err
-	}
-	adversarial, err := loadCriteria(filepath.Join(opts.Root, opts.AdversarialCriteria))
+		if err := appendRecords(absRuns, added); err != nil {
+			return err
+		}
+		all, err = level4gate.LoadNDJSONWithOptions(absRuns, decodeOpts)
+		return err
+	})
 	if err != nil {
 		return AdvanceResult{}, err
 	}
@@ -159,13 +163,25 @@ func Advance(opts AdvanceOptions) (AdvanceResult, error) {
 	res := AdvanceResult{
 		RunsPath:          opts.RunsPath,
 		Added:             added,
+		Skipped:           skipped,
 		BaselineReport:    baseReport,
 		AdversarialReport: advReport,
 	}
 
 	if opts.LogLearning {
+		summary := fmt.Sprintf("Window ingest appended %d runs (%s..%s) from %s %s", len(added), added[0].RunID, added[len(added)-1].RunID, opts.Source.Kind, opts.Source.Path)
 		decisions := []string{
-			fmt.Sprintf("Quality mode=%s", opts.QualityMode),
+			fmt.Sprintf("Record source=%s %s", opts.Source.Kind, opts.Source.Path),
+		}
+		if opts.Synthetic {
+			summary = fmt.Sprintf("SYNTHETIC window advance appended %d generated runs (%s..%s); not real run outcomes", len(added), added[0].RunID, added[len(added)-1].RunID)
+			decisions = []string{
+				"Record source=synthetic (generated outcomes, not measured factory runs)",
+				fmt.Sprintf("Quality mode=%s", opts.QualityMode),
+			}
+		}
+		if len(skipped) > 0 {
+			decisions = append(decisions, fmt.Sprintf("Skipped runs=%d", len(skipped)))
 		}
 		if strings.TrimSpace(opts.QualityReason) != "" {
 			decisions = append(decisions, fmt.Sprintf("Quality reason=%s", strings.TrimSpace(opts.QualityReason)))
@@ -179,7 +195,7 @@ func Advance(opts AdvanceOptions) (AdvanceResult, error) {
 			Root:          opts.Root,
 			SourceProject: "darkfactorio",
 			SourceRefs:    []string{"window:" + opts.WindowID},
-			Summary:       fmt.Sprintf("Autonomous window advance appended %d runs (%s..%s)", len(added), added[0].RunID, added[len(added)-1].RunID),
+			Summary:       summary,
 			Decisions:     decisions,
 			Evidence: []string{
 				opts.RunsPath,
@@ -191,42 +207,109 @@ func Advance(opts AdvanceOptions) (AdvanceResult, error) {
 			},
 		})
 		if err != nil {
-			return AdvanceResult{}, err
+			res.Warnings = append(res.Warnings, fmt.Sprintf("learning entry not written: %v", err))
+		} else {
+			res.LearningEntryPath = lp
+		}
+	}
+
+	target := opts.TargetRuns
+	if target == 0 {
+		target = baseline.MinRuns
+	}
+	if target > 0 && len(all) >= target && len(all)-len(added) < target {
+		co, err := Closeout(CloseoutOptions{
+			Root:                opts.Root,
+			WindowID:            opts.WindowID,
+			RunsPath:            opts.RunsPath,
+			BaselineCriteria:    opts.BaselineCriteria,
+			AdversarialCriteria: opts.AdversarialCriteria,
+		})
+		switch {
+		case errors.Is(err, ErrCloseoutExists):
+		case err != nil:
+			res.Warnings = append(res.Warnings, fmt.Sprintf("closeout not written: %v", err))
+		default:
+			res.CloseoutPath = co.Path
 		}
-		res.LearningEntryPath = lp
 	}
 
 	return res, nil
 }
 
-func appendRecords(path string, recs []level4gate.EvalRecord) error {
-	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
-	if err != nil {
-		return err
+// synthesize fabricates opts.AppendCount records that continue the window's
+// run numbering. The outcomes follow a fixed formula, so a window built from
+// them measures the generator, not the factory.
+func synthesize(opts AdvanceOptions, baseline level4gate.Criteria, existing []level4gate.EvalRecord) []level4gate.EvalRecord {
+	// Generated runs cycle through the baseline profile's declared classes
+	// in name order.
+	classNames := baseline.ClassNames()
+	classes := baseline.Classes()
+	classCounts := make(map[string]int, len(classNames))
+	for _, name := range classNames {
+		classCounts[name] = 0
 	}
-	defer f.Close()
-	w := bufio.NewWriter(f)
-	for _, r := range recs {
-		b, err := json.Marshal(r)
-		if err != nil {
-			return err
+	for _, r := range existing {
+		classCounts[r.PipelineClass]++
+	}
+
+	first := nextRunIndex(existing)
+	added := make([]level4gate.EvalRecord, 0, opts.AppendCount)
+	for i := 0; i < opts.AppendCount; i++ {
+		runIdx := first + i
+		className := classNames[(runIdx-1)%len(classNames)]
+		pipelinePrefix := classes[className].PipelinePrefix
+		if pipelinePrefix == "" {
+			pipelinePrefix = "p-" + className
 		}
-		if _, err := w.Write(append(b, '\n')); err != nil {
-			return err
+		classCounts[className]++
+		scenarioTotal := 10 + (runIdx % 3) // 10,11,12 cycle
+		scenarioPassed := scenarioTotal
+		switch opts.QualityMode {
+		case "standard":
+			scenarioPassed = scenarioTotal - 1
+			if runIdx%5 == 0 {
+				scenarioPassed = scenarioTotal // occasional perfect pass
+			}
+		case "high":
+			// remediation mode: force perfect scenario outcomes.
+			scenarioPassed = scenarioTotal
 		}
+		rec := level4gate.EvalRecord{
+			SchemaVersion:    level4gate.CurrentSchemaVersion,
+			WindowID:         opts.WindowID,
+			RunID:            fmt.Sprintf("run-%03d", runIdx),
+			PipelineID:       fmt.Sprintf("%s-%03d", pipelinePrefix, classCounts[className]),
+			PipelineClass:    className,
+			ScenarioTotal:    scenarioTotal,
+			ScenarioPassed:   scenarioPassed,
+			FirstPassSuccess: true,
+			Retries:          1,
+			Interventions:    1,
+			Decision:         "approved",
+			DecisionReversed: false,
+			CriticalIncident: false,
+			Timestamp:        opts.StartTime.Add(time.Duration(i) * opts.Interval).UTC().Format(time.RFC3339),
+			QualityMode:      opts.QualityMode,
+		}
+		if opts.QualityMode == "high" {
+			rec.QualityReason = strings.TrimSpace(opts.QualityReason)
+		}
+		added = append(added, rec)
 	}
-	return w.Flush()
+	return added
 }
 
-func loadCriteria(path string) (level4gate.Criteria, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return level4gate.Criteria{}, err
-	}
-	defer f.Close()
-	var c level4gate.Criteria
-	if err := json.NewDecoder(f).Decode(&c); err != nil {
-		return level4gate.Criteria{}, err
+// nextRunIndex returns the first run number past every record in the
+// window: past its length, and past the highest run-NNN ID, which ingested
+// runs or dropped lines can push beyond the length.
+func nextRunIndex(existing []level4gate.EvalRecord) int {
+	next := len(existing) + 1
+	for _, r := range existing {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.RunID, "run-"))
+		if err == nil && strings.HasPrefix(r.RunID, "run-") && n >= next {
+			next = n + 1
+		}
 	}
-	return c, nil
+	return next
 }
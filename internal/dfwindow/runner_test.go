@@ -16,6 +16,7 @@ func TestAdvanceAppendsRecordsAndEvaluates(t *testing.T) {
 	res, err := Advance(AdvanceOptions{
 		Root:          root,
 		WindowID:      "w-test",
+		Synthetic:     true,
 		AppendCount:   2,
 		RunsPath:      "runs/w-test.ndjson",
 		LogLearning:   true,
@@ -55,6 +56,7 @@ func TestAdvanceRejectsInvalidQualityMode(t *testing.T) {
 	_, err := Advance(AdvanceOptions{
 		Root:        root,
 		WindowID:    "w-test",
+		Synthetic:   true,
 		AppendCount: 1,
 		QualityMode: "bad",
 	})
@@ -71,6 +73,7 @@ func TestAdvanceRequiresReasonForHighQualityMode(t *testing.T) {
 	_, err := Advance(AdvanceOptions{
 		Root:        root,
 		WindowID:    "w-test",
+		Synthetic:   true,
 		AppendCount: 1,
 		QualityMode: "high",
 	})
@@ -79,6 +82,38 @@ func TestAdvanceRequiresReasonForHighQualityMode(t *testing.T) {
 	}
 }
 
+func TestAdvanceCyclesDeclaredPipelineClasses(t *testing.T) {
+	root := t.TempDir()
+	profile := `{"version":"b","min_runs":3,"pipeline_classes":{"docs_only":{"pipeline_prefix":"p-docs"},"high_risk_migration":{},"infra_change":{"pipeline_prefix":"p-infra"}},"thresholds":{"min_scenario_pass_rate_percent":90,"min_first_pass_rate_percent":70,"max_mean_retries":2,"max_decision_reversal_percent":5,"max_approved_incidents":0},"required_class_minimum":{"docs_only":1,"high_risk_migration":1,"infra_change":1}}`
+	mustWrite(t, filepath.Join(root, "profiles/level4-gate-v0.1-baseline.json"), profile)
+	mustWrite(t, filepath.Join(root, "profiles/level4-gate-v0.1-adversarial.json"), profile)
+
+	res, err := Advance(AdvanceOptions{
+		Root:          root,
+		WindowID:      "w-test",
+		Synthetic:     true,
+		AppendCount:   3,
+		QualityMode:   "high",
+		QualityReason: "class coverage",
+	})
+	if err != nil {
+		t.Fatalf("Advance failed: %v", err)
+	}
+	want := []struct{ class, pipeline string }{
+		{"docs_only", "p-docs-001"},
+		{"high_risk_migration", "p-high_risk_migration-001"},
+		{"infra_change", "p-infra-001"},
+	}
+	for i, w := range want {
+		if res.Added[i].PipelineClass != w.class || res.Added[i].PipelineID != w.pipeline {
+			t.Fatalf("record %d: got %s/%s, want %s/%s", i, res.Added[i].PipelineClass, res.Added[i].PipelineID, w.class, w.pipeline)
+		}
+	}
+	if !res.BaselineReport.Passed {
+		t.Fatalf("expected baseline pass, got failures: %v", res.BaselineReport.Failures)
+	}
+}
+
 func mustWrite(t *testing.T, path string, body string) {
 	t.Helper()
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
@@ -0,0 +1,65 @@
+package gatereport
+
+import (
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var markdownBadges = map[string]string{
+	StatusPass: "✅ pass",
+	StatusWarn: "⚠️ warn",
+	StatusFail: "❌ fail",
+}
+
+var markdownIcons = map[string]string{
+	StatusPass: "✅",
+	StatusWarn: "⚠️",
+	StatusFail: "❌",
+}
+
+var (
+	markdownTemplate = texttemplate.Must(texttemplate.New("report.md.tmpl").Funcs(texttemplate.FuncMap{
+		"badge": func(status string) string { return markdownBadges[status] },
+		"icon":  func(status string) string { return markdownIcons[status] },
+		"cell":  func(s string) string { return strings.ReplaceAll(s, "|", "\\|") },
+		"inc":   func(i int) int { return i + 1 },
+	}).ParseFS(templateFS, "templates/report.md.tmpl"))
+
+	htmlTemplate = htmltemplate.Must(htmltemplate.New("report.html.tmpl").ParseFS(templateFS, "templates/report.html.tmpl"))
+)
+
+// Formats lists the values Render accepts.
+func Formats() []string {
+	return []string{"markdown", "html"}
+}
+
+// Render writes r in the given format: markdown or html.
+func Render(w io.Writer, format string, r level4gate.GateReport) error {
+	switch format {
+	case "markdown":
+		return Markdown(w, r)
+	case "html":
+		return HTML(w, r)
+	}
+	return fmt.Errorf("unknown report format %q (want %s)", format, strings.Join(Formats(), "|"))
+}
+
+// Markdown writes r as a markdown section, starting at a level-two heading
+// so it can be pasted into a decision record or PR comment.
+func Markdown(w io.Writer, r level4gate.GateReport) error {
+	return markdownTemplate.Execute(w, NewView(r))
+}
+
+// HTML writes r as a standalone HTML page.
+func HTML(w io.Writer, r level4gate.GateReport) error {
+	return htmlTemplate.Execute(w, NewView(r))
+}
@@ -0,0 +1,79 @@
+package gatereport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+)
+
+func sampleReport() level4gate.GateReport {
+	var records []level4gate.EvalRecord
+	for i := 0; i < 10; i++ {
+		class := "low_risk_feature"
+		if i%2 == 1 {
+			class = "medium_integration"
+		}
+		records = append(records, level4gate.EvalRecord{
+			WindowID: "w-test", RunID: "r", PipelineID: "p", PipelineClass: class,
+			ScenarioTotal: 10, ScenarioPassed: 9, FirstPassSuccess: i != 0, Retries: 1, Interventions: 1,
+			Decision: "approved", Timestamp: "2026-02-19T00:00:00Z",
+		})
+	}
+	c := level4gate.DefaultCriteria()
+	c.ClassThresholds = map[string]level4gate.ThresholdOverrides{"medium_integration": {}}
+	c.Thresholds.MinScenarioPassRatePercent = 95
+	c.WarnBands = map[string]float64{"mean_retries": 1}
+	c.Rules = []level4gate.ExprRule{{Name: "<gap>", Expr: "first_pass_rate_percent > 95", Severity: level4gate.RuleBlock}}
+	return level4gate.EvaluateWithCriteria(records, c, "w-test")
+}
+
+func TestMarkdownCoversVerdictThresholdsClassesAndFailures(t *testing.T) {
+	var b bytes.Buffer
+	if err := Markdown(&b, sampleReport()); err != nil {
+		t.Fatalf("Markdown failed: %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"## Level 4 gate report: w-test\n",
+		"**Verdict:** ❌ FAIL",
+		"| `scenario_pass_rate` | 90 | ≥ 95 | -5.00 | ❌ fail |",
+		"| `mean_retries` | 1 | ≤ 2 | +1.00 | ⚠️ warn |",
+		"| `low_risk_feature` | 5 | 90.00% | 80.00% | 1.00 | not gated |",
+		"| `medium_integration` | 5 | 90.00% | 100.00% | 1.00 | ❌ fail |",
+		"1. `scenario_pass_rate`: scenario_pass_rate 90.00 < 95.00. Too many holdout scenarios failed across the window.",
+		"`rule[<gap>]`: rule[<gap>] violated (first_pass_rate_percent > 95). A custom rule",
+		"- `mean_retries`: mean_retries 1.00 <= 2.00 (within 1.00 of threshold). The rule passed, but only just",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("markdown missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestHTMLEscapesReportText(t *testing.T) {
+	var b bytes.Buffer
+	if err := Render(&b, "html", sampleReport()); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	out := b.String()
+	if strings.Contains(out, "rule[<gap>]") || !strings.Contains(out, "rule[&lt;gap&gt;]") {
+		t.Fatalf("expected rule name to be escaped:\n%s", out)
+	}
+	if !strings.Contains(out, `<span class="badge fail">FAIL</span>`) {
+		t.Fatalf("expected fail badge:\n%s", out)
+	}
+	if err := Render(&b, "pdf", sampleReport()); err == nil {
+		t.Fatal("expected unknown format error")
+	}
+}
+
+func TestViewListsFailuresOfReportsWithoutFindings(t *testing.T) {
+	r := sampleReport()
+	r.Findings = nil
+	v := NewView(r)
+	if v.Thresholds != nil || len(v.Failures) != len(r.Failures) || v.Failures[0].Message != r.Failures[0] {
+		t.Fatalf("unexpected view for a report without findings: %+v", v)
+	}
+}
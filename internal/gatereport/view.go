@@ -0,0 +1,293 @@
+// Package gatereport renders a level4gate.GateReport for people: markdown
+// for decision records and PR comments, and a standalone HTML page. Both
+// formats are filled from the same View.
+package gatereport
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+)
+
+// Status values for rows, classes and the overall verdict.
+const (
+	StatusPass = "pass"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// View is the template model shared by the markdown and HTML renderers.
+type View struct {
+	Title               string
+	WindowID            string
+	Status              string
+	Verdict             string
+	Inconclusive        bool
+	InconclusiveReasons []string
+	Metrics             []MetricRow
+	Thresholds          []ThresholdRow
+	Classes             []ClassRow
+	Warnings            []Explanation
+	Failures            []Explanation
+}
+
+type MetricRow struct {
+	Name  string
+	Value string
+}
+
+// ThresholdRow is one finding. Threshold carries the comparison, e.g.
+// "≥ 95". Observed, Threshold and Margin are "-" for rules without a
+// numeric comparison.
+type ThresholdRow struct {
+	RuleID    string
+	Observed  string
+	Threshold string
+	Margin    string
+	Status    string
+}
+
+type ClassRow struct {
+	Name             string
+	RunCount         int
+	ScenarioPassRate string
+	FirstPassRate    string
+	MeanRetries      string
+	// Gated is false for classes without class_thresholds; they cannot fail.
+	Gated  bool
+	Status string
+}
+
+// Explanation pairs a failure or warning with what the rule protects.
+type Explanation struct {
+	RuleID  string
+	Message string
+	Why     string
+}
+
+// ruleExplanations says what each built-in rule guards, keyed by the rule
+// ID without its class label.
+var ruleExplanations = map[string]string{
+	"run_count":                       "The window is too small to judge; add runs before deciding.",
+	"run_count_by_class":              "A pipeline class is under-represented, so its behaviour is not evidenced.",
+	"scenario_pass_rate":              "Too many holdout scenarios failed across the window.",
+	"first_pass_rate":                 "Too few runs succeeded without a retry.",
+	"mean_retries":                    "Runs needed too many retries on average.",
+	"decision_reversal_rate":          "Too many approved runs were later reversed.",
+	"approved_run_critical_incidents": "An approved run caused a critical incident.",
+	"intervention_trend":              "Human interventions are trending up over the window.",
+	"reversal_events":                 "Reversal events contradict the recorded decisions, so reversal rates would be understated.",
+	"incident_links":                  "Incidents are linked to runs that were not approved or ran after detection, so the links are wrong.",
+	"cost_per_approved_run_usd":       "Each approved run costs more than the ceiling.",
+	"p95_duration_seconds":            "Slow runs exceed the p95 duration ceiling.",
+	"weighted_scenario_pass_rate":     "The category-weighted scenario pass rate is below the floor.",
+	"remediation_share":               "Too many runs had forced outcomes in high-quality remediation mode, so the window's pass rates overstate the factory.",
+}
+
+// NewView builds the template model. Reports saved before findings existed
+// have no threshold table; their failures are still listed.
+func NewView(r level4gate.GateReport) View {
+	v := View{
+		Title:               fmt.Sprintf("Level 4 gate report: %s", displayWindow(r.WindowID)),
+		WindowID:            r.WindowID,
+		Inconclusive:        r.Inconclusive,
+		InconclusiveReasons: r.InconclusiveReasons,
+		Metrics:             metricRows(r.Metrics),
+	}
+	switch {
+	case !r.Passed:
+		v.Status, v.Verdict = StatusFail, "FAIL"
+	case len(r.Warnings) > 0:
+		v.Status, v.Verdict = StatusWarn, "PASS WITH WARNINGS"
+	default:
+		v.Status, v.Verdict = StatusPass, "PASS"
+	}
+
+	for _, f := range r.Findings {
+		v.Thresholds = append(v.Thresholds, thresholdRow(f))
+	}
+	if r.Findings == nil {
+		for _, msg := range r.Failures {
+			v.Failures = append(v.Failures, Explanation{Message: msg})
+		}
+		for _, msg := range r.Warnings {
+			v.Warnings = append(v.Warnings, Explanation{Message: msg})
+		}
+	}
+	for _, f := range r.Findings {
+		switch f.Severity {
+		case level4gate.FindingBlock:
+			v.Failures = append(v.Failures, explain(f))
+		case level4gate.FindingWarn:
+			v.Warnings = append(v.Warnings, explain(f))
+		}
+	}
+
+	for _, c := range r.Classes {
+		row := ClassRow{
+			Name:             c.PipelineClass,
+			RunCount:         c.Metrics.RunCount,
+			ScenarioPassRate: percent(c.Metrics.ScenarioPassRatePercent),
+			FirstPassRate:    percent(c.Metrics.FirstPassRatePercent),
+			MeanRetries:      fmt.Sprintf("%.2f", c.Metrics.MeanRetries),
+			Gated:            c.Thresholds != nil,
+			Status:           StatusPass,
+		}
+		if !c.Passed {
+			row.Status = StatusFail
+		}
+		v.Classes = append(v.Classes, row)
+	}
+	return v
+}
+
+func displayWindow(id string) string {
+	if id == "" {
+		return "all records"
+	}
+	return id
+}
+
+func metricRows(m level4gate.Metrics) []MetricRow {
+	level := m.ConfidenceLevel * 100
+	rows := []MetricRow{
+		{"Run count", fmt.Sprintf("%d", m.RunCount)},
+		{"Class mix", classMix(m.RunCountByClass)},
+		{"Scenario pass rate", fmt.Sprintf("%s (%.0f%% CI %s)", percent(m.ScenarioPassRatePercent), level, interval(m.ScenarioPassRateCI))},
+		{"First-pass rate", fmt.Sprintf("%s (%.0f%% CI %s)", percent(m.FirstPassRatePercent), level, interval(m.FirstPassRateCI))},
+		{"Mean retries", fmt.Sprintf("%.2f", m.MeanRetries)},
+		{"Decision reversal rate", fmt.Sprintf("%s (%.0f%% CI %s)", percent(m.DecisionReversalPercent), level, interval(m.DecisionReversalCI))},
+		{"Approved critical incidents", fmt.Sprintf("%d", m.ApprovedRunCriticalIncidents)},
+		{"Intervention trend", trend(m)},
+	}
+	if rv := m.Reversals; rv != nil {
+		rows = append(rows,
+			MetricRow{"Approved runs reversed", fmt.Sprintf("%d/%d (%s)", rv.ApprovedReversed, rv.ApprovedRuns, percent(rv.ApprovedReversalPercent))},
+			MetricRow{"Rejected runs reversed", fmt.Sprintf("%d/%d (%s)", rv.RejectedReversed, rv.RejectedRuns, percent(rv.RejectedReversalPercent))},
+			MetricRow{"Reversal latency", fmt.Sprintf("mean %.1fh, p95 %.1fh", rv.LatencyHours.Mean, rv.LatencyHours.P95)},
+		)
+	}
+	if inc := m.Incidents; inc != nil {
+		rows = append(rows,
+			MetricRow{"Incidents by severity", classMix(inc.BySeverity)},
+			MetricRow{"Mean time to detect", fmt.Sprintf("%.1fh", inc.TimeToDetectHours.Mean)},
+			MetricRow{"Mean time to mitigate", fmt.Sprintf("%.0f min (%d unmitigated)", inc.TimeToMitigateMinutes.Mean, inc.Unmitigated)},
+		)
+	}
+	if s := m.Scenarios; s != nil {
+		rows = append(rows, MetricRow{"Weighted scenario pass rate", percent(s.WeightedPassRatePercent)})
+	}
+	if r := m.Remediation; r != nil {
+		rows = append(rows, MetricRow{"Remediation runs", fmt.Sprintf("%d/%d (%s)", r.HighRunCount, m.RunCount, percent(r.SharePercent))})
+	}
+	if e := m.Economics; e != nil {
+		cost := "-"
+		if e.CostPerApprovedRunUSD != nil {
+			cost = fmt.Sprintf("$%.2f", *e.CostPerApprovedRunUSD)
+		}
+		rows = append(rows,
+			MetricRow{"Cost per approved run", cost},
+			MetricRow{"p95 duration", fmt.Sprintf("%.1fs", e.DurationSeconds.P95)},
+		)
+	}
+	return rows
+}
+
+func classMix(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%d", name, counts[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func trend(m level4gate.Metrics) string {
+	verdict := "stable or decreasing"
+	if !m.InterventionStableOrDecreasing {
+		verdict = "increasing"
+	}
+	if m.InterventionTrendPValue == nil {
+		return fmt.Sprintf("%s (%s, %.2f -> %.2f)", verdict, m.InterventionTrendMethod, m.InterventionAvgFirstHalf, m.InterventionAvgSecondHalf)
+	}
+	return fmt.Sprintf("%s (%s, slope %.3f, p=%.4f)", verdict, m.InterventionTrendMethod, m.InterventionTrendSlope, *m.InterventionTrendPValue)
+}
+
+func thresholdRow(f level4gate.Finding) ThresholdRow {
+	row := ThresholdRow{RuleID: f.RuleID, Observed: "-", Threshold: "-", Margin: "-", Status: findingStatus(f)}
+	if f.Observed != nil {
+		row.Observed = number(*f.Observed)
+	}
+	if f.Threshold != nil {
+		row.Threshold = number(*f.Threshold)
+		switch f.Comparison {
+		case ">=":
+			row.Threshold = "≥ " + row.Threshold
+		case "<=":
+			row.Threshold = "≤ " + row.Threshold
+		}
+	}
+	if f.Margin != nil {
+		row.Margin = fmt.Sprintf("%+.2f", *f.Margin)
+	}
+	return row
+}
+
+func findingStatus(f level4gate.Finding) string {
+	switch f.Severity {
+	case level4gate.FindingBlock:
+		return StatusFail
+	case level4gate.FindingWarn:
+		return StatusWarn
+	}
+	return StatusPass
+}
+
+func explain(f level4gate.Finding) Explanation {
+	e := Explanation{RuleID: f.RuleID, Message: f.Message}
+	base := f.RuleID
+	if i := strings.IndexByte(base, '['); i > 0 {
+		base = base[:i]
+	}
+	switch {
+	case strings.HasPrefix(f.RuleID, "rule["):
+		e.Why = "A custom rule from the criteria profile did not hold."
+	case strings.Contains(f.Message, "not measurable"):
+		e.Why = "The rule needs data the window's records do not carry, so it fails closed."
+	case strings.HasSuffix(base, "_scenario_pass_rate"):
+		e.Why = "Scenarios in this category failed too often."
+	case strings.HasPrefix(base, "failed_scenarios_"):
+		e.Why = "Too many scenarios of this severity failed."
+	case strings.HasPrefix(base, "incidents_"):
+		e.Why = "Approved runs caused too many incidents of this severity."
+	default:
+		e.Why = ruleExplanations[base]
+	}
+	if f.Severity == level4gate.FindingWarn && f.Margin != nil {
+		e.Why = "The rule passed, but only just; it is inside its warn band."
+	}
+	return e
+}
+
+func percent(v float64) string {
+	return fmt.Sprintf("%.2f%%", v)
+}
+
+func interval(i level4gate.Interval) string {
+	return fmt.Sprintf("[%.2f, %.2f]", i.Lower, i.Upper)
+}
+
+// number prints whole values without decimals, so counts read as counts.
+func number(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.2f", v)
+}
@@ -0,0 +1,467 @@
+// Package jsonschema implements the subset of JSON Schema draft 2020-12 used
+// by the checked-in files under schemas/: type, enum, const, required,
+// properties, additionalProperties, minProperties/maxProperties, items,
+// minItems/maxItems, minLength/maxLength, minimum/maximum (inclusive and
+// exclusive), format date-time, oneOf, anyOf, allOf, not and if/then/else.
+// Compile rejects any other keyword, so a schema cannot state a constraint
+// the validator would not check.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Schema struct {
+	root any
+}
+
+// ValidationError reports one violation. Path is a JSON pointer into the
+// validated document, written in URI fragment form ("#" is the root).
+type ValidationError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+func Load(path string) (*Schema, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Compile(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// LoadFS compiles the schema at name in fsys.
+func LoadFS(fsys fs.FS, name string) (*Schema, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Compile(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return s, nil
+}
+
+func Compile(data []byte) (*Schema, error) {
+	v, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	switch v.(type) {
+	case map[string]any, bool:
+	default:
+		return nil, fmt.Errorf("schema must be an object or boolean")
+	}
+	if err := checkKeywords(v, "#"); err != nil {
+		return nil, err
+	}
+	return &Schema{root: v}, nil
+}
+
+// annotations are keywords that do not constrain a document.
+var annotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true, "examples": true, "default": true,
+}
+
+// assertions are the keywords validate checks whose values are not schemas.
+var assertions = map[string]bool{
+	"type": true, "enum": true, "const": true, "required": true,
+	"minProperties": true, "maxProperties": true, "minItems": true, "maxItems": true,
+	"minLength": true, "maxLength": true, "minimum": true, "maximum": true,
+	"exclusiveMinimum": true, "exclusiveMaximum": true, "format": true,
+}
+
+// checkKeywords walks a schema and rejects keywords and formats validate
+// does not implement. path is a JSON pointer into the schema.
+func checkKeywords(schema any, path string) error {
+	sc, ok := schema.(map[string]any)
+	if !ok {
+		if _, isBool := schema.(bool); isBool {
+			return nil
+		}
+		return fmt.Errorf("%s: schema must be an object or boolean", path)
+	}
+	keys := make([]string, 0, len(sc))
+	for k := range sc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		child := path + "/" + escapePointer(k)
+		switch {
+		case annotations[k]:
+		case k == "format":
+			if sc[k] != "date-time" {
+				return fmt.Errorf("%s: unsupported format %s", child, render(sc[k]))
+			}
+		case assertions[k]:
+		case k == "properties":
+			props, ok := sc[k].(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: must be an object", child)
+			}
+			names := make([]string, 0, len(props))
+			for name := range props {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if err := checkKeywords(props[name], child+"/"+escapePointer(name)); err != nil {
+					return err
+				}
+			}
+		case k == "additionalProperties", k == "items", k == "not", k == "if", k == "then", k == "else":
+			if err := checkKeywords(sc[k], child); err != nil {
+				return err
+			}
+		case k == "allOf", k == "anyOf", k == "oneOf":
+			subs, ok := sc[k].([]any)
+			if !ok {
+				return fmt.Errorf("%s: must be an array", child)
+			}
+			for i, sub := range subs {
+				if err := checkKeywords(sub, fmt.Sprintf("%s/%d", child, i)); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("%s: unsupported keyword %q", child, k)
+		}
+	}
+	return nil
+}
+
+// ValidateJSON decodes data and validates it. A decode failure is returned
+// as an error rather than as a ValidationError.
+func (s *Schema) ValidateJSON(data []byte) ([]ValidationError, error) {
+	doc, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return s.Validate(doc), nil
+}
+
+// Validate checks a document decoded with json.Decoder.UseNumber. Plain
+// float64 numbers are accepted as well.
+func (s *Schema) Validate(doc any) []ValidationError {
+	var errs []ValidationError
+	validate(s.root, doc, "#", &errs)
+	return errs
+}
+
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func validate(schema any, doc any, path string, errs *[]ValidationError) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch sc := schema.(type) {
+	case bool:
+		if !sc {
+			fail("no value is allowed here")
+		}
+		return
+	case map[string]any:
+		if t, ok := sc["type"]; ok && !matchesType(t, doc) {
+			fail("expected type %s, got %s", describeType(t), typeName(doc))
+			return
+		}
+		if enum, ok := sc["enum"].([]any); ok {
+			found := false
+			for _, e := range enum {
+				if equal(e, doc) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				fail("value %s is not one of %s", render(doc), render(enum))
+			}
+		}
+		if c, ok := sc["const"]; ok && !equal(c, doc) {
+			fail("value %s must equal %s", render(doc), render(c))
+		}
+
+		switch d := doc.(type) {
+		case map[string]any:
+			validateObject(sc, d, path, errs)
+		case []any:
+			if n, ok := number(sc["minItems"]); ok && float64(len(d)) < n {
+				fail("expected at least %v items, got %d", n, len(d))
+			}
+			if n, ok := number(sc["maxItems"]); ok && float64(len(d)) > n {
+				fail("expected at most %v items, got %d", n, len(d))
+			}
+			if items, ok := sc["items"]; ok {
+				for i, item := range d {
+					validate(items, item, fmt.Sprintf("%s/%d", path, i), errs)
+				}
+			}
+		case string:
+			if n, ok := number(sc["minLength"]); ok && float64(len([]rune(d))) < n {
+				fail("length %d is shorter than minLength %v", len([]rune(d)), n)
+			}
+			if n, ok := number(sc["maxLength"]); ok && float64(len([]rune(d))) > n {
+				fail("length %d is longer than maxLength %v", len([]rune(d)), n)
+			}
+			if f, ok := sc["format"].(string); ok && f == "date-time" {
+				if _, err := time.Parse(time.RFC3339, d); err != nil {
+					fail("%q is not a valid date-time", d)
+				}
+			}
+		case json.Number, float64:
+			v, _ := number(d)
+			if n, ok := number(sc["minimum"]); ok && v < n {
+				fail("%v is less than minimum %v", v, n)
+			}
+			if n, ok := number(sc["maximum"]); ok && v > n {
+				fail("%v is greater than maximum %v", v, n)
+			}
+			if n, ok := number(sc["exclusiveMinimum"]); ok && v <= n {
+				fail("%v must be greater than %v", v, n)
+			}
+			if n, ok := number(sc["exclusiveMaximum"]); ok && v >= n {
+				fail("%v must be less than %v", v, n)
+			}
+		}
+
+		if subs, ok := sc["allOf"].([]any); ok {
+			for _, sub := range subs {
+				validate(sub, doc, path, errs)
+			}
+		}
+		if subs, ok := sc["anyOf"].([]any); ok {
+			if countMatches(subs, doc, path) == 0 {
+				fail("must match at least one schema in anyOf")
+			}
+		}
+		if subs, ok := sc["oneOf"].([]any); ok {
+			if n := countMatches(subs, doc, path); n != 1 {
+				fail("must match exactly one schema in oneOf (matched %d)", n)
+			}
+		}
+		if not, ok := sc["not"]; ok && countMatches([]any{not}, doc, path) == 1 {
+			fail("must not match the schema in not")
+		}
+		if cond, ok := sc["if"]; ok {
+			if countMatches([]any{cond}, doc, path) == 1 {
+				if then, ok := sc["then"]; ok {
+					validate(then, doc, path, errs)
+				}
+			} else if els, ok := sc["else"]; ok {
+				validate(els, doc, path, errs)
+			}
+		}
+	}
+}
+
+func validateObject(sc map[string]any, d map[string]any, path string, errs *[]ValidationError) {
+	if req, ok := sc["required"].([]any); ok {
+		for _, r := range req {
+			name, _ := r.(string)
+			if _, ok := d[name]; !ok {
+				*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf("missing required property %q", name)})
+			}
+		}
+	}
+	if n, ok := number(sc["minProperties"]); ok && float64(len(d)) < n {
+		*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf("expected at least %v properties, got %d", n, len(d))})
+	}
+	if n, ok := number(sc["maxProperties"]); ok && float64(len(d)) > n {
+		*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf("expected at most %v properties, got %d", n, len(d))})
+	}
+
+	props, _ := sc["properties"].(map[string]any)
+	additional, hasAdditional := sc["additionalProperties"]
+	keys := make([]string, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		child := path + "/" + escapePointer(k)
+		if p, ok := props[k]; ok {
+			validate(p, d[k], child, errs)
+			continue
+		}
+		if !hasAdditional {
+			continue
+		}
+		if allowed, ok := additional.(bool); ok && !allowed {
+			*errs = append(*errs, ValidationError{Path: child, Message: "property is not allowed (additionalProperties: false)"})
+			continue
+		}
+		validate(additional, d[k], child, errs)
+	}
+}
+
+func countMatches(subs []any, doc any, path string) int {
+	n := 0
+	for _, sub := range subs {
+		var errs []ValidationError
+		validate(sub, doc, path, &errs)
+		if len(errs) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func matchesType(t any, doc any) bool {
+	switch tt := t.(type) {
+	case string:
+		return isType(tt, doc)
+	case []any:
+		for _, x := range tt {
+			if s, ok := x.(string); ok && isType(s, doc) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isType(name string, doc any) bool {
+	switch name {
+	case "null":
+		return doc == nil
+	case "boolean":
+		_, ok := doc.(bool)
+		return ok
+	case "string":
+		_, ok := doc.(string)
+		return ok
+	case "object":
+		_, ok := doc.(map[string]any)
+		return ok
+	case "array":
+		_, ok := doc.([]any)
+		return ok
+	case "number":
+		_, ok := number(doc)
+		return ok
+	case "integer":
+		v, ok := number(doc)
+		return ok && v == math.Trunc(v) && !math.IsInf(v, 0)
+	}
+	return false
+}
+
+func typeName(doc any) string {
+	switch doc.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case json.Number, float64:
+		if isType("integer", doc) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", doc)
+}
+
+func describeType(t any) string {
+	if list, ok := t.([]any); ok {
+		names := make([]string, 0, len(list))
+		for _, x := range list {
+			names = append(names, fmt.Sprint(x))
+		}
+		return strings.Join(names, "|")
+	}
+	return fmt.Sprint(t)
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// equal compares decoded JSON values, treating numbers by value.
+func equal(a, b any) bool {
+	na, aNum := number(a)
+	nb, bNum := number(b)
+	if aNum || bNum {
+		return aNum && bNum && na == nb
+	}
+	switch av := a.(type) {
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !equal(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, x := range av {
+			y, ok := bv[k]
+			if !ok || !equal(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func render(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,240 @@
+package jsonschema
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rickhallett/darkfactorio/internal/level4gate"
+)
+
+func TestValidateReportsJSONPointerPaths(t *testing.T) {
+	s, err := Compile([]byte(`{
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["name", "items"],
+  "properties": {
+    "name": {"type": "string", "minLength": 1},
+    "items": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "a/b": {"type": "integer", "minimum": 0},
+          "at": {"type": "string", "format": "date-time"}
+        }
+      }
+    }
+  }
+}`))
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	errs, err := s.ValidateJSON([]byte(`{"name":"","items":[{"a/b":1},{"a/b":-1.5,"at":"yesterday"}],"extra":true}`))
+	if err != nil {
+		t.Fatalf("ValidateJSON failed: %v", err)
+	}
+	got := make([]string, 0, len(errs))
+	for _, e := range errs {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		"#/extra: property is not allowed (additionalProperties: false)",
+		"#/items/1/a~1b: expected type integer, got number",
+		`#/items/1/at: "yesterday" is not a valid date-time`,
+		"#/name: length 0 is shorter than minLength 1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected errors:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestValidateOneOfAndEnum(t *testing.T) {
+	s, err := Compile([]byte(`{
+  "oneOf": [
+    {"type": "string", "enum": ["low", "high"]},
+    {"type": "integer", "minimum": 1}
+  ]
+}`))
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	for _, ok := range []string{`"low"`, `3`} {
+		if errs, _ := s.ValidateJSON([]byte(ok)); len(errs) != 0 {
+			t.Fatalf("expected %s to validate, got %v", ok, errs)
+		}
+	}
+	for _, bad := range []string{`"medium"`, `0`, `true`} {
+		errs, _ := s.ValidateJSON([]byte(bad))
+		if len(errs) != 1 || !strings.Contains(errs[0].Message, "exactly one schema in oneOf (matched 0)") {
+			t.Fatalf("expected oneOf failure for %s, got %v", bad, errs)
+		}
+	}
+}
+
+func TestValidateArrayAndStringBounds(t *testing.T) {
+	s, err := Compile([]byte(`{
+  "type": "object",
+  "properties": {
+    "run_ids": {"type": "array", "minItems": 1, "maxItems": 2, "items": {"type": "string", "maxLength": 3}}
+  }
+}`))
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	cases := map[string]string{
+		`{"run_ids":[]}`:            "#/run_ids: expected at least 1 items, got 0",
+		`{"run_ids":["a","b","c"]}`: "#/run_ids: expected at most 2 items, got 3",
+		`{"run_ids":["run-001"]}`:   "#/run_ids/0: length 7 is longer than maxLength 3",
+		`{"run_ids":["r1"]}`:        "",
+	}
+	for doc, want := range cases {
+		errs, _ := s.ValidateJSON([]byte(doc))
+		got := ""
+		if len(errs) > 0 {
+			got = errs[0].Error()
+		}
+		if len(errs) > 1 || got != want {
+			t.Fatalf("%s: got %v, want %q", doc, errs, want)
+		}
+	}
+}
+
+func TestCompileRejectsUnsupportedKeywords(t *testing.T) {
+	for schema, want := range map[string]string{
+		`{"properties": {"id": {"type": "string", "pattern": "^r"}}}`: `#/properties/id/pattern: unsupported keyword "pattern"`,
+		`{"allOf": [{"uniqueItems": true}]}`:                          `#/allOf/0/uniqueItems: unsupported keyword "uniqueItems"`,
+		`{"type": "string", "format": "email"}`:                       `#/format: unsupported format "email"`,
+	} {
+		if _, err := Compile([]byte(schema)); err == nil || err.Error() != want {
+			t.Fatalf("%s: error = %v, want %q", schema, err, want)
+		}
+	}
+}
+
+func TestCheckedInArtifactsMatchSchemas(t *testing.T) {
+	root := filepath.Join("..", "..")
+	criteria, err := Load(filepath.Join(root, "schemas/level4-gate-criteria-v0.1.json"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	profiles, _ := filepath.Glob(filepath.Join(root, "profiles/*.json"))
+	for _, p := range profiles {
+		// Child profiles are partial; validate the effective profile.
+		res, err := level4gate.ResolveCriteria(p)
+		if err != nil {
+			t.Fatalf("ResolveCriteria(%s) failed: %v", p, err)
+		}
+		b, _ := json.Marshal(res.Document)
+		if errs, err := criteria.ValidateJSON(b); err != nil || len(errs) != 0 {
+			t.Errorf("%s: %v %v", p, err, errs)
+		}
+	}
+
+	envelope, err := Load(filepath.Join(root, "schemas/run-envelope-v0.1.json"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	envelopes, _ := filepath.Glob(filepath.Join(root, "runs/examples/envelopes/*.json"))
+	for _, p := range envelopes {
+		assertValidFile(t, envelope, p)
+	}
+
+	reversal, err := Load(filepath.Join(root, "schemas/decision-reversal-event-v0.1.json"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	assertValidLines(t, reversal, filepath.Join(root, "runs/examples/reversals-sample.ndjson"))
+
+	incident, err := Load(filepath.Join(root, "schemas/incident-v0.1.json"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	assertValidLines(t, incident, filepath.Join(root, "runs/examples/incidents-sample.ndjson"))
+
+	manifest, err := Load(filepath.Join(root, "schemas/window-manifest-v0.1.json"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	manifests, _ := filepath.Glob(filepath.Join(root, "runs/*.manifest.json"))
+	if len(manifests) == 0 {
+		t.Fatalf("expected a checked-in window manifest")
+	}
+	for _, p := range manifests {
+		assertValidFile(t, manifest, p)
+	}
+
+	// Every record line is checked against the schema its schema_version
+	// names; unversioned lines are v0.1.
+	records := map[string]*Schema{}
+	runs, _ := filepath.Glob(filepath.Join(root, "runs/*.ndjson"))
+	runs = append(runs, filepath.Join(root, "runs/examples/window-sample.ndjson"))
+	for _, p := range runs {
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatalf("open failed: %v", err)
+		}
+		sc := bufio.NewScanner(f)
+		line := 0
+		for sc.Scan() {
+			line++
+			var head struct {
+				SchemaVersion string `json:"schema_version"`
+			}
+			if err := json.Unmarshal(sc.Bytes(), &head); err != nil {
+				t.Fatalf("%s line %d: %v", p, line, err)
+			}
+			version := head.SchemaVersion
+			if version == "" {
+				version = level4gate.SchemaVersionV01
+			}
+			if !level4gate.IsSchemaVersion(version) {
+				t.Fatalf("%s line %d: unsupported schema_version %q", p, line, version)
+			}
+			record, ok := records[version]
+			if !ok {
+				if record, err = Load(filepath.Join(root, "schemas", version+".json")); err != nil {
+					t.Fatalf("Load failed: %v", err)
+				}
+				records[version] = record
+			}
+			errs, err := record.ValidateJSON(sc.Bytes())
+			if err != nil || len(errs) != 0 {
+				t.Errorf("%s line %d: %v %v", p, line, err, errs)
+			}
+		}
+		f.Close()
+	}
+}
+
+func assertValidFile(t *testing.T, s *Schema, path string) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	errs, err := s.ValidateJSON(b)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("%s: %v", path, errs)
+	}
+}
+
+func assertValidLines(t *testing.T, s *Schema, path string) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	for i, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		errs, err := s.ValidateJSON([]byte(line))
+		if err != nil || len(errs) != 0 {
+			t.Errorf("%s line %d: %v %v", path, i+1, err, errs)
+		}
+	}
+}
@@ -33,6 +33,20 @@ type CheckResult struct {
 	Passed             bool
 	SubstantiveChanged []string
 	LearningChanged    []string
+	// MalformedCloseouts lists changed closeout records missing a required
+	// section, as "path: missing ## Section".
+	MalformedCloseouts []string
+}
+
+// CloseoutSections are the level-two headings every window closeout record
+// (learning/decisions/*-closeout.md) must carry, hand-written or generated.
+var CloseoutSections = []string{
+	"Context",
+	"Decision",
+	"Metrics Snapshot",
+	"Top 3 Blockers",
+	"Corrective Actions",
+	"Next Review",
 }
 
 func Touch(opts TouchOptions) (string, error) {
@@ -117,6 +131,14 @@ func Check(opts CheckOptions) (CheckResult, error) {
 	sort.Strings(substantive)
 	sort.Strings(learningChanged)
 
+	malformed, err := malformedCloseouts(opts.Root, opts.Head, learningChanged)
+	if err != nil {
+		return CheckResult{}, err
+	}
+	if len(malformed) > 0 {
+		return CheckResult{SubstantiveChanged: substantive, LearningChanged: learningChanged, MalformedCloseouts: malformed}, nil
+	}
+
 	if len(substantive) == 0 {
 		return CheckResult{Passed: true, SubstantiveChanged: substantive, LearningChanged: learningChanged}, nil
 	}
@@ -136,6 +158,50 @@ func Check(opts CheckOptions) (CheckResult, error) {
 	}, nil
 }
 
+// malformedCloseouts checks the closeout records among changed as they
+// stand at head. Records deleted by the change are not checked.
+func malformedCloseouts(root, head string, changed []string) ([]string, error) {
+	var out []string
+	for _, p := range changed {
+		if !strings.HasPrefix(p, "learning/decisions/") || !strings.HasSuffix(p, "-closeout.md") {
+			continue
+		}
+		exists := exec.Command("git", "cat-file", "-e", head+":"+p)
+		exists.Dir = root
+		if exists.Run() != nil {
+			continue
+		}
+		show := exec.Command("git", "show", head+":"+p)
+		show.Dir = root
+		body, err := show.Output()
+		if err != nil {
+			return nil, fmt.Errorf("git show %s:%s failed: %v", head, p, err)
+		}
+		for _, missing := range MissingCloseoutSections(string(body)) {
+			out = append(out, fmt.Sprintf("%s: missing ## %s", p, missing))
+		}
+	}
+	return out, nil
+}
+
+// MissingCloseoutSections returns the CloseoutSections that body has no
+// "## <section>" heading for.
+func MissingCloseoutSections(body string) []string {
+	have := map[string]bool{}
+	for _, line := range strings.Split(body, "\n") {
+		if heading, ok := strings.CutPrefix(strings.TrimRight(line, " \r"), "## "); ok {
+			have[strings.TrimSpace(heading)] = true
+		}
+	}
+	var missing []string
+	for _, s := range CloseoutSections {
+		if !have[s] {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
 func buildEntry(opts TouchOptions) string {
 	var b strings.Builder
 	ts := opts.When.UTC().Format(time.RFC3339)
@@ -81,6 +81,42 @@ func TestCheckRequiresLearningUpdate(t *testing.T) {
 	}
 }
 
+func TestCheckRejectsCloseoutMissingSections(t *testing.T) {
+	root := t.TempDir()
+	runGit(t, root, "init")
+	runGit(t, root, "branch", "-M", "main")
+
+	mustWrite(t, filepath.Join(root, "README.md"), "start\n")
+	runGit(t, root, "add", "README.md")
+	runGitCommit(t, root, "init")
+	base := strings.TrimSpace(runGit(t, root, "rev-parse", "HEAD"))
+
+	closeout := filepath.Join(root, "learning/decisions/2026-02-19-window-w-closeout.md")
+	mustWrite(t, closeout, "# Window Closeout: w\n\n## Context\n\n## Decision\n\n## Metrics Snapshot\n")
+	runGit(t, root, "add", ".")
+	runGitCommit(t, root, "closeout")
+
+	result, err := Check(CheckOptions{Root: root, Base: base, Head: "HEAD"})
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if result.Passed || len(result.MalformedCloseouts) != 3 || !strings.Contains(result.MalformedCloseouts[0], "missing ## Top 3 Blockers") {
+		t.Fatalf("expected three missing sections, got %+v", result)
+	}
+
+	mustWrite(t, closeout, "# Window Closeout: w\n\n## Context\n\n## Decision\n\n## Metrics Snapshot\n\n## Top 3 Blockers\n\n## Corrective Actions\n\n## Next Review\n")
+	runGit(t, root, "add", ".")
+	runGitCommit(t, root, "closeout sections")
+
+	result, err = Check(CheckOptions{Root: root, Base: base, Head: "HEAD"})
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if !result.Passed {
+		t.Fatalf("expected a complete closeout to pass, got %+v", result)
+	}
+}
+
 func mustWrite(t *testing.T, path string, content string) {
 	t.Helper()
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
@@ -0,0 +1,294 @@
+package level4gate
+
+import (
+	"sort"
+	"time"
+)
+
+// Accumulator evaluates records one at a time without holding the records
+// themselves. Memory is still linear in the number of records: the trend
+// tests need every (timestamp, interventions) pair in time order, and the
+// p95 summaries need every cost and duration value, so each record leaves
+// a sample of a few dozen bytes behind. Deduplication adds a key per run
+// (see Deduper). EvaluateWithCriteria is a wrapper around it.
+type Accumulator struct {
+	criteria  Criteria
+	reversals *ReversalLog
+	incidents *IncidentLog
+	all       *metricAccumulator
+	classes   map[string]*metricAccumulator
+
+	// joinedRuns holds the runs that matched an attached stream, so the
+	// report can count stream entries for the window that matched none.
+	joinedRuns map[runKey]bool
+}
+
+func NewAccumulator(criteria Criteria) *Accumulator {
+	return &Accumulator{
+		criteria: criteria,
+		all:      newMetricAccumulator(),
+		classes:  map[string]*metricAccumulator{},
+	}
+}
+
+// WithReversals joins every record added afterwards against the reversal
+// events in l, and adds reversal metrics to the report. Call it before Add.
+func (a *Accumulator) WithReversals(l *ReversalLog) *Accumulator {
+	a.reversals = l
+	a.all.reversals = newReversalAccumulator()
+	return a
+}
+
+// WithIncidents links every record added afterwards to the incidents in l,
+// and adds incident metrics to the report. Call it before Add.
+func (a *Accumulator) WithIncidents(l *IncidentLog) *Accumulator {
+	a.incidents = l
+	a.all.incidents = newIncidentAccumulator()
+	return a
+}
+
+// Add folds one record into the window. Records are not validated; decode
+// them with DecodeNDJSONFunc or DecodeNDJSONWithOptions first.
+func (a *Accumulator) Add(r EvalRecord) {
+	j := joined{reversals: a.reversals.forRecord(r), incidents: a.incidents.forRecord(r)}
+	if len(j.reversals) > 0 || len(j.incidents) > 0 {
+		if a.joinedRuns == nil {
+			a.joinedRuns = map[runKey]bool{}
+		}
+		a.joinedRuns[runKey{window: r.WindowID, run: r.RunID}] = true
+	}
+	a.all.add(r, j)
+	c, ok := a.classes[r.PipelineClass]
+	if !ok {
+		c = newMetricAccumulator()
+		if a.all.reversals != nil {
+			c.reversals = newReversalAccumulator()
+		}
+		if a.all.incidents != nil {
+			c.incidents = newIncidentAccumulator()
+		}
+		a.classes[r.PipelineClass] = c
+	}
+	c.add(r, j)
+}
+
+// Count returns the number of records added so far.
+func (a *Accumulator) Count() int {
+	return a.all.runCount
+}
+
+// Report evaluates the records added so far. It can be called repeatedly.
+func (a *Accumulator) Report(windowID string) GateReport {
+	return a.ReportWith(windowID, a.criteria)
+}
+
+// ReportWith evaluates the records added so far against criteria instead
+// of the criteria the Accumulator was created with, so one pass over the
+// records can be judged under several threshold settings. Metrics still
+// use criteria's confidence, trend and scenario scoring settings.
+func (a *Accumulator) ReportWith(windowID string, criteria Criteria) GateReport {
+	m := a.all.metrics(criteria)
+	if m.Reversals != nil {
+		m.Reversals.Unmatched = a.reversals.unmatched(windowID, a.joinedRuns)
+	}
+	if m.Incidents != nil {
+		m.Incidents.UnmatchedLinks = a.incidents.unmatched(windowID, a.joinedRuns)
+	}
+	findings := windowFindings(m, criteria)
+	inconclusive := inconclusiveReasons(m, criteria.Thresholds, "")
+	classes, classFindings := a.classReports(criteria)
+	findings = append(findings, classFindings...)
+	for _, cr := range classes {
+		if cr.Thresholds != nil {
+			inconclusive = append(inconclusive, inconclusiveReasons(cr.Metrics, *cr.Thresholds, cr.PipelineClass)...)
+		}
+	}
+	findings = append(findings, evaluateRules(criteria.Rules, m, classes)...)
+	applyWarnBands(findings, criteria.WarnBands)
+	failures := findingMessages(findings, FindingBlock)
+	return GateReport{
+		WindowID:            windowID,
+		Thresholds:          criteria.Thresholds,
+		Metrics:             m,
+		Classes:             classes,
+		Passed:              len(failures) == 0,
+		Inconclusive:        len(inconclusive) > 0,
+		InconclusiveReasons: inconclusive,
+		Failures:            failures,
+		Warnings:            findingMessages(findings, FindingWarn),
+		Findings:            findings,
+	}
+}
+
+// classReports computes metrics for every pipeline class seen and checks
+// the classes that declare class_thresholds. Class findings are labelled
+// with the class name so they can sit in the aggregate findings list.
+func (a *Accumulator) classReports(criteria Criteria) ([]ClassReport, []Finding) {
+	gateOn := criteria.ConfidenceOptions().GateOn
+	names := make([]string, 0, len(a.classes))
+	for name := range a.classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make([]ClassReport, 0, len(names))
+	var findings []Finding
+	for _, name := range names {
+		cr := ClassReport{
+			PipelineClass: name,
+			Metrics:       a.classes[name].metrics(criteria),
+			Failures:      []string{},
+		}
+		if t, ok := criteria.ClassThresholdsFor(name); ok {
+			cr.Thresholds = &t
+			classFindings := thresholdFindings(cr.Metrics, t, gateOn, name)
+			cr.Failures = findingMessages(classFindings, FindingBlock)
+			findings = append(findings, classFindings...)
+		}
+		cr.Passed = len(cr.Failures) == 0
+		out = append(out, cr)
+	}
+	return out, findings
+}
+
+// untimed marks a trendSample without a usable timestamp; valid
+// nanoseconds are never negative.
+const untimed = -1
+
+// trendSample is the per-record state kept for the intervention trend. A
+// record whose timestamp does not parse has nsec untimed.
+type trendSample struct {
+	sec           int64
+	nsec          int32
+	interventions int32
+}
+
+type metricAccumulator struct {
+	runCount          int
+	scenarioTotal     int
+	scenarioPassed    int
+	firstPassCount    int
+	retriesTotal      int
+	reversalCount     int
+	approvedCount     int
+	approvedIncidents int
+	classCounts       map[string]int
+	trend             []trendSample
+	economics         economicsAccumulator
+	scenarios         scenarioAccumulator
+	remediation       remediationAccumulator
+	reversals         *reversalAccumulator
+	incidents         *incidentAccumulator
+}
+
+// joined holds the events from attached streams that belong to one record.
+type joined struct {
+	reversals []reversalAt
+	incidents []linkedIncident
+}
+
+func newMetricAccumulator() *metricAccumulator {
+	return &metricAccumulator{
+		classCounts: map[string]int{},
+		scenarios:   newScenarioAccumulator(),
+	}
+}
+
+func (a *metricAccumulator) add(r EvalRecord, j joined) {
+	a.runCount++
+	a.classCounts[r.PipelineClass]++
+	a.scenarioTotal += r.ScenarioTotal
+	a.scenarioPassed += r.ScenarioPassed
+	if r.FirstPassSuccess {
+		a.firstPassCount++
+	}
+	a.retriesTotal += r.Retries
+	reversed := r.DecisionReversed
+	if a.reversals != nil && a.reversals.add(r, j.reversals) {
+		reversed = true
+	}
+	if reversed {
+		a.reversalCount++
+	}
+	critical := r.CriticalIncident
+	if a.incidents != nil && a.incidents.add(r, j.incidents) {
+		critical = true
+	}
+	if r.Decision == "approved" {
+		a.approvedCount++
+		if critical {
+			a.approvedIncidents++
+		}
+	}
+
+	sample := trendSample{nsec: untimed, interventions: int32(r.Interventions)}
+	if at, err := time.Parse(time.RFC3339, r.Timestamp); err == nil {
+		sample.sec, sample.nsec = at.Unix(), int32(at.Nanosecond())
+	}
+	a.trend = append(a.trend, sample)
+	a.economics.add(r)
+	a.scenarios.add(r)
+	a.remediation.add(r)
+}
+
+func (a *metricAccumulator) metrics(c Criteria) Metrics {
+	level := c.ConfidenceOptions().Level
+	approvedDenominator := a.approvedCount
+	if approvedDenominator == 0 {
+		approvedDenominator = 1
+	}
+
+	scenarioPassRate := 0.0
+	if a.scenarioTotal > 0 {
+		scenarioPassRate = pct(float64(a.scenarioPassed), float64(a.scenarioTotal))
+	}
+
+	classCounts := make(map[string]int, len(a.classCounts))
+	for k, v := range a.classCounts {
+		classCounts[k] = v
+	}
+
+	m := Metrics{
+		RunCount:                     a.runCount,
+		RunCountByClass:              classCounts,
+		ScenarioPassRatePercent:      scenarioPassRate,
+		FirstPassRatePercent:         pct(float64(a.firstPassCount), float64(a.runCount)),
+		MeanRetries:                  float64(a.retriesTotal) / float64(a.runCount),
+		DecisionReversalPercent:      pct(float64(a.reversalCount), float64(approvedDenominator)),
+		ApprovedRunCriticalIncidents: a.approvedIncidents,
+		ConfidenceLevel:              level,
+		ScenarioPassRateCI:           wilsonInterval(a.scenarioPassed, a.scenarioTotal, level),
+		FirstPassRateCI:              wilsonInterval(a.firstPassCount, a.runCount, level),
+		DecisionReversalCI:           wilsonInterval(a.reversalCount, approvedDenominator, level),
+		Economics:                    a.economics.metrics(a.approvedCount),
+		Scenarios:                    a.scenarios.metrics(c.ScenarioScoring.weights()),
+		Reversals:                    a.reversals.metrics(),
+		Incidents:                    a.incidents.metrics(),
+		Remediation:                  a.remediation.metrics(a.runCount),
+	}
+	applyInterventionTrend(&m, a.chronologicalInterventions(), c.TrendRuleOptions())
+	return m
+}
+
+// chronologicalInterventions returns intervention counts ordered by record
+// timestamp, with records whose timestamp does not parse after the rest.
+// Records with equal or unparseable timestamps keep the order they were
+// added in.
+func (a *metricAccumulator) chronologicalInterventions() []float64 {
+	samples := make([]trendSample, len(a.trend))
+	copy(samples, a.trend)
+	sort.SliceStable(samples, func(i, j int) bool {
+		if ti, tj := samples[i].nsec != untimed, samples[j].nsec != untimed; ti != tj {
+			return ti
+		}
+		if samples[i].sec != samples[j].sec {
+			return samples[i].sec < samples[j].sec
+		}
+		return samples[i].nsec < samples[j].nsec
+	})
+	out := make([]float64, len(samples))
+	for i, s := range samples {
+		out[i] = float64(s.interventions)
+	}
+	return out
+}
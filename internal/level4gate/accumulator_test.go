@@ -0,0 +1,165 @@
+package level4gate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccumulatorReportIsRepeatable(t *testing.T) {
+	records := economicRecords()
+	start := time.Date(2026, 2, 18, 20, 0, 0, 0, time.UTC)
+	for i := range records {
+		// Reverse the timestamps so the trend sort has work to do.
+		records[i].Timestamp = start.Add(time.Duration(len(records)-i) * time.Minute).Format(time.RFC3339)
+		records[i].Interventions = i % 3
+	}
+	c := DefaultCriteria()
+	maxCost := 0.60
+	c.Thresholds.MaxCostPerApprovedRunUSD = &maxCost
+
+	acc := NewAccumulator(c)
+	for i, r := range records {
+		acc.Add(r)
+		got := acc.Report("w")
+		if again := acc.Report("w"); !reflect.DeepEqual(got, again) {
+			t.Fatalf("second report after %d records differs:\n got %+v\nwant %+v", i+1, again, got)
+		}
+		fresh := NewAccumulator(c)
+		for _, r := range records[:i+1] {
+			fresh.Add(r)
+		}
+		if want := fresh.Report("w"); !reflect.DeepEqual(got, want) {
+			t.Fatalf("report after %d records differs from a fresh accumulator:\n got %+v\nwant %+v", i+1, got, want)
+		}
+	}
+	if acc.Count() != len(records) {
+		t.Fatalf("Count = %d, want %d", acc.Count(), len(records))
+	}
+}
+
+// TestAccumulatorMatchesPreStreamingGoldens streams the checked-in windows
+// through an Accumulator and compares the report with the JSON the
+// evaluator produced before it was rebuilt on the Accumulator. The inputs
+// are frozen copies in testdata. Findings are cleared first: they were
+// added to GateReport later and have their own tests.
+func TestAccumulatorMatchesPreStreamingGoldens(t *testing.T) {
+	for _, tc := range []struct{ input, window, golden string }{
+		{"w-2026-02-l4-02.ndjson", "w-2026-02-l4-02", "w-2026-02-l4-02.report.json"},
+		{"w-2026-02-l4-03.ndjson", "w-2026-02-l4-03", "w-2026-02-l4-03.report.json"},
+		{"window-sample.ndjson", "w-2026-02-l4-01", "window-sample.report.json"},
+	} {
+		f, err := os.Open(filepath.Join("testdata", tc.input))
+		if err != nil {
+			t.Fatalf("open failed: %v", err)
+		}
+		acc := NewAccumulator(DefaultCriteria())
+		_, err = DecodeNDJSONFunc(f, DecodeOptions{WindowID: tc.window}, func(r EvalRecord) error {
+			acc.Add(r)
+			return nil
+		})
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: decode failed: %v", tc.input, err)
+		}
+		report := acc.Report(tc.window)
+		report.Findings = nil
+		got, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			t.Fatalf("marshal failed: %v", err)
+		}
+		want, err := os.ReadFile(filepath.Join("testdata", tc.golden))
+		if err != nil {
+			t.Fatalf("read golden failed: %v", err)
+		}
+		if !bytes.Equal(append(got, '\n'), want) {
+			t.Fatalf("%s: report differs from %s:\n%s", tc.input, tc.golden, got)
+		}
+	}
+}
+
+func TestChronologicalInterventionsPutsUntimedRunsLast(t *testing.T) {
+	a := newMetricAccumulator()
+	for _, r := range []struct {
+		ts            string
+		interventions int
+	}{
+		{"not a time", 7},
+		{"2026-02-18T22:00:00Z", 3},
+		{"", 8},
+		{"2026-02-18T20:00:00Z", 1},
+		{"2026-02-18T21:00:00Z", 2},
+		{"1969-12-31T23:00:00Z", 0},
+	} {
+		a.add(EvalRecord{PipelineClass: "low_risk_feature", ScenarioTotal: 1, Decision: "approved", Interventions: r.interventions, Timestamp: r.ts}, joined{})
+	}
+	got := a.chronologicalInterventions()
+	want := []float64{0, 1, 2, 3, 7, 8}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("chronologicalInterventions = %v, want %v", got, want)
+	}
+}
+
+func TestKendallSMatchesPairwiseCount(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	for trial := 0; trial < 50; trial++ {
+		ys := make([]float64, rng.Intn(60))
+		for i := range ys {
+			ys[i] = float64(rng.Intn(5))
+		}
+		want := 0
+		for i := range ys {
+			for j := i + 1; j < len(ys); j++ {
+				switch {
+				case ys[j] > ys[i]:
+					want++
+				case ys[j] < ys[i]:
+					want--
+				}
+			}
+		}
+		work := append([]float64(nil), ys...)
+		if got := kendallS(work, make([]float64, len(work))); got != want {
+			t.Fatalf("kendallS(%v) = %d, want %d", ys, got, want)
+		}
+	}
+}
+
+func TestDecodeNDJSONFuncStreamsRecords(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 5; i++ {
+		window := "w1"
+		if i%2 == 1 {
+			window = "w2"
+		}
+		fmt.Fprintf(&b, `{"window_id":%q,"run_id":"r%d","pipeline_id":"p1","pipeline_class":"low_risk_feature","scenario_total":10,"scenario_passed":10,"first_pass_success":true,"retries":0,"interventions":0,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"2026-02-18T20:00:00Z"}`+"\n", window, i)
+	}
+
+	var runs []string
+	n, err := DecodeNDJSONFunc(strings.NewReader(b.String()), DecodeOptions{WindowID: "w1"}, func(r EvalRecord) error {
+		runs = append(runs, r.RunID)
+		return nil
+	})
+	if err != nil || n != 3 || strings.Join(runs, ",") != "r0,r2,r4" {
+		t.Fatalf("unexpected stream: n=%d runs=%v err=%v", n, runs, err)
+	}
+
+	stop := errors.New("stop")
+	n, err = DecodeNDJSONFunc(strings.NewReader(b.String()), DecodeOptions{}, func(r EvalRecord) error {
+		if r.RunID == "r2" {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || n != 2 {
+		t.Fatalf("expected callback error after 2 records, got n=%d err=%v", n, err)
+	}
+}
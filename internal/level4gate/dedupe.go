@@ -0,0 +1,191 @@
+package level4gate
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Duplicate policies for records that share (window_id, run_id).
+//
+//   - error: any repeat is an error. This is the default.
+//   - keep-first: repeats are dropped.
+//   - keep-last: a repeat replaces the record seen before it.
+//   - merge-identical: repeats that decode to the same record are dropped;
+//     a repeat that differs is an error.
+const (
+	DuplicateError          = "error"
+	DuplicateKeepFirst      = "keep-first"
+	DuplicateKeepLast       = "keep-last"
+	DuplicateMergeIdentical = "merge-identical"
+)
+
+func DuplicatePolicies() []string {
+	return []string{DuplicateError, DuplicateKeepFirst, DuplicateKeepLast, DuplicateMergeIdentical}
+}
+
+// RecordPosition locates a record in its input. Source is empty when there
+// is a single unnamed input.
+type RecordPosition struct {
+	Source string `json:"source,omitempty"`
+	Line   int    `json:"line"`
+}
+
+func (p RecordPosition) String() string {
+	if p.Source == "" {
+		return fmt.Sprintf("line %d", p.Line)
+	}
+	return fmt.Sprintf("%s line %d", p.Source, p.Line)
+}
+
+// Duplicate is a record whose (window_id, run_id) had already been seen.
+// First is the occurrence held at the time: the earliest one, or for
+// keep-last the latest one kept so far.
+type Duplicate struct {
+	WindowID  string         `json:"window_id"`
+	RunID     string         `json:"run_id"`
+	First     RecordPosition `json:"first"`
+	Repeat    RecordPosition `json:"repeat"`
+	Identical bool           `json:"identical"`
+}
+
+// err names the repeat by line only, like other decode errors; callers that
+// read several inputs prefix the input's name. First keeps its source.
+func (d Duplicate) err() error {
+	kind := "conflicting duplicate"
+	if d.Identical {
+		kind = "duplicate"
+	}
+	return fmt.Errorf("line %d: %s of run_id %q in window %q first seen at %s", d.Repeat.Line, kind, d.RunID, d.WindowID, d.First)
+}
+
+// Deduper applies a duplicate policy to a stream of records before passing
+// them to emit. It can span several inputs, so a file replayed twice is
+// caught. keep-last holds every record until Flush, since a later line may
+// still replace it; the other policies pass records through as they arrive
+// and keep only a digest per run. Either way memory grows with the number
+// of distinct runs.
+type Deduper struct {
+	policy     string
+	emit       func(EvalRecord) error
+	seen       map[runKey]seenRun
+	held       []EvalRecord
+	duplicates []Duplicate
+}
+
+type runKey struct {
+	window string
+	run    string
+}
+
+type seenRun struct {
+	pos    RecordPosition
+	digest [sha256.Size]byte
+	// held indexes Deduper.held under keep-last.
+	held int
+}
+
+func NewDeduper(policy string, emit func(EvalRecord) error) (*Deduper, error) {
+	if policy == "" {
+		policy = DuplicateError
+	}
+	switch policy {
+	case DuplicateError, DuplicateKeepFirst, DuplicateKeepLast, DuplicateMergeIdentical:
+	default:
+		return nil, fmt.Errorf("duplicate policy must be %s", strings.Join(DuplicatePolicies(), "|"))
+	}
+	return &Deduper{policy: policy, emit: emit, seen: map[runKey]seenRun{}}, nil
+}
+
+// Add offers one record found at pos.
+func (d *Deduper) Add(pos RecordPosition, r EvalRecord) error {
+	key := runKey{window: r.WindowID, run: r.RunID}
+	digest, err := recordDigest(r)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", pos.Line, err)
+	}
+	prev, ok := d.seen[key]
+	if !ok {
+		s := seenRun{pos: pos, digest: digest}
+		if d.policy == DuplicateKeepLast {
+			s.held = len(d.held)
+			d.held = append(d.held, r)
+			d.seen[key] = s
+			return nil
+		}
+		d.seen[key] = s
+		return d.emit(r)
+	}
+
+	dup := Duplicate{
+		WindowID:  r.WindowID,
+		RunID:     r.RunID,
+		First:     prev.pos,
+		Repeat:    pos,
+		Identical: prev.digest == digest,
+	}
+	switch d.policy {
+	case DuplicateError:
+		return dup.err()
+	case DuplicateMergeIdentical:
+		if !dup.Identical {
+			return dup.err()
+		}
+	case DuplicateKeepLast:
+		d.held[prev.held] = r
+		prev.pos = pos
+		prev.digest = digest
+		d.seen[key] = prev
+	}
+	d.duplicates = append(d.duplicates, dup)
+	return nil
+}
+
+// Flush emits the records keep-last was holding, in the order their runs
+// were first seen. It is a no-op for the other policies. Call it once,
+// after the last Add.
+func (d *Deduper) Flush() error {
+	held := d.held
+	d.held = nil
+	for _, r := range held {
+		if err := d.emit(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dropped returns how many records the policy discarded.
+func (d *Deduper) Dropped() int {
+	return len(d.duplicates)
+}
+
+// Duplicates lists every repeat seen, in input order.
+func (d *Deduper) Duplicates() []Duplicate {
+	return append([]Duplicate(nil), d.duplicates...)
+}
+
+// recordDigest hashes the decoded record, so formatting and key order in
+// the source line do not make two equal records differ.
+// SameRecord reports whether a and b are identical by the comparison the
+// merge-identical policy uses.
+func SameRecord(a, b EvalRecord) (bool, error) {
+	da, err := recordDigest(a)
+	if err != nil {
+		return false, err
+	}
+	db, err := recordDigest(b)
+	if err != nil {
+		return false, err
+	}
+	return da == db, nil
+}
+
+func recordDigest(r EvalRecord) ([sha256.Size]byte, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(b), nil
+}
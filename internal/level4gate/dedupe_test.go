@@ -0,0 +1,72 @@
+package level4gate
+
+import (
+	"strings"
+	"testing"
+)
+
+func duplicateInput() string {
+	first := strings.Replace(v01Line, `"retries":0`, `"retries":1`, 1)
+	other := strings.Replace(v01Line, `"run_id":"r1"`, `"run_id":"r2"`, 1)
+	// Line 4 repeats line 1 exactly; line 5 repeats it with different
+	// retries.
+	return first + "\n" + other + "\n\n" + first + "\n" + v01Line + "\n"
+}
+
+func TestDecodeNDJSONDuplicatePolicies(t *testing.T) {
+	_, err := DecodeNDJSONWithOptions(strings.NewReader(duplicateInput()), DecodeOptions{})
+	want := `line 4: duplicate of run_id "r1" in window "w" first seen at line 1`
+	if err == nil || err.Error() != want {
+		t.Fatalf("default policy: error = %v, want %q", err, want)
+	}
+
+	_, err = DecodeNDJSONWithOptions(strings.NewReader(duplicateInput()), DecodeOptions{Duplicates: DuplicateMergeIdentical})
+	want = `line 5: conflicting duplicate of run_id "r1" in window "w" first seen at line 1`
+	if err == nil || err.Error() != want {
+		t.Fatalf("merge-identical: error = %v, want %q", err, want)
+	}
+
+	for policy, retries := range map[string]int{DuplicateKeepFirst: 1, DuplicateKeepLast: 0} {
+		recs, err := DecodeNDJSONWithOptions(strings.NewReader(duplicateInput()), DecodeOptions{Duplicates: policy})
+		if err != nil {
+			t.Fatalf("%s: %v", policy, err)
+		}
+		if len(recs) != 2 || recs[0].RunID != "r1" || recs[1].RunID != "r2" {
+			t.Fatalf("%s: unexpected records %+v", policy, recs)
+		}
+		if recs[0].Retries != retries {
+			t.Fatalf("%s: expected retries=%d on r1, got %d", policy, retries, recs[0].Retries)
+		}
+	}
+
+	if _, err := DecodeNDJSONWithOptions(strings.NewReader(v01Line), DecodeOptions{Duplicates: "newest"}); err == nil || !strings.Contains(err.Error(), "duplicate policy must be") {
+		t.Fatalf("expected policy error, got %v", err)
+	}
+}
+
+func TestDeduperReportsDuplicatesAcrossSources(t *testing.T) {
+	recs, err := DecodeNDJSON(strings.NewReader(v01Line), "")
+	if err != nil {
+		t.Fatalf("DecodeNDJSON failed: %v", err)
+	}
+	var kept []EvalRecord
+	d, err := NewDeduper(DuplicateKeepFirst, func(r EvalRecord) error {
+		kept = append(kept, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("NewDeduper failed: %v", err)
+	}
+	for _, src := range []string{"a.ndjson", "b.ndjson"} {
+		if err := d.Add(RecordPosition{Source: src, Line: 1}, recs[0]); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if len(kept) != 1 || d.Dropped() != 1 {
+		t.Fatalf("expected 1 kept and 1 dropped, got %d and %d", len(kept), d.Dropped())
+	}
+	dup := d.Duplicates()[0]
+	if dup.First.String() != "a.ndjson line 1" || dup.Repeat.String() != "b.ndjson line 1" || !dup.Identical {
+		t.Fatalf("unexpected duplicate: %+v", dup)
+	}
+}
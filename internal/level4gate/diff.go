@@ -0,0 +1,182 @@
+package level4gate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Metric directions used by Diff to decide whether a delta is a regression.
+const (
+	HigherIsBetter = "higher_is_better"
+	LowerIsBetter  = "lower_is_better"
+	Neutral        = "neutral"
+)
+
+type MetricDelta struct {
+	Name      string  `json:"name"`
+	Direction string  `json:"direction"`
+	Before    float64 `json:"before"`
+	After     float64 `json:"after"`
+	Delta     float64 `json:"delta"`
+}
+
+// Worsened reports whether the delta moves against the metric's direction
+// by more than tolerance.
+func (d MetricDelta) Worsened(tolerance float64) bool {
+	switch d.Direction {
+	case HigherIsBetter:
+		return -d.Delta > tolerance
+	case LowerIsBetter:
+		return d.Delta > tolerance
+	}
+	return false
+}
+
+// ReportDiff compares two gate reports. Failures are matched by rule, so a
+// rule that fails in both reports with different observed values is neither
+// gained nor lost.
+type ReportDiff struct {
+	BeforeWindowID string        `json:"before_window_id"`
+	AfterWindowID  string        `json:"after_window_id"`
+	BeforePassed   bool          `json:"before_passed"`
+	AfterPassed    bool          `json:"after_passed"`
+	Metrics        []MetricDelta `json:"metrics"`
+	FailuresGained []string      `json:"failures_gained"`
+	FailuresLost   []string      `json:"failures_lost"`
+}
+
+// Diff compares report a (before) with report b (after). Optional metrics
+// are included only when both reports carry them.
+func Diff(a, b GateReport) ReportDiff {
+	d := ReportDiff{
+		BeforeWindowID: a.WindowID,
+		AfterWindowID:  b.WindowID,
+		BeforePassed:   a.Passed,
+		AfterPassed:    b.Passed,
+		FailuresGained: []string{},
+		FailuresLost:   []string{},
+	}
+	add := func(name, direction string, before, after float64) {
+		d.Metrics = append(d.Metrics, MetricDelta{
+			Name:      name,
+			Direction: direction,
+			Before:    before,
+			After:     after,
+			Delta:     after - before,
+		})
+	}
+
+	ma, mb := a.Metrics, b.Metrics
+	add("run_count", Neutral, float64(ma.RunCount), float64(mb.RunCount))
+	add("scenario_pass_rate_percent", HigherIsBetter, ma.ScenarioPassRatePercent, mb.ScenarioPassRatePercent)
+	add("first_pass_rate_percent", HigherIsBetter, ma.FirstPassRatePercent, mb.FirstPassRatePercent)
+	add("mean_retries", LowerIsBetter, ma.MeanRetries, mb.MeanRetries)
+	add("intervention_trend_slope", LowerIsBetter, ma.InterventionTrendSlope, mb.InterventionTrendSlope)
+	add("decision_reversal_percent", LowerIsBetter, ma.DecisionReversalPercent, mb.DecisionReversalPercent)
+	add("approved_run_critical_incidents", LowerIsBetter, float64(ma.ApprovedRunCriticalIncidents), float64(mb.ApprovedRunCriticalIncidents))
+	if ma.Scenarios != nil && mb.Scenarios != nil {
+		add("weighted_scenario_pass_rate_percent", HigherIsBetter, ma.Scenarios.WeightedPassRatePercent, mb.Scenarios.WeightedPassRatePercent)
+	}
+	if ma.Remediation != nil && mb.Remediation != nil {
+		add("remediation_share_percent", LowerIsBetter, ma.Remediation.SharePercent, mb.Remediation.SharePercent)
+	}
+	if ma.Economics != nil && mb.Economics != nil {
+		ea, eb := ma.Economics, mb.Economics
+		if ea.CostPerApprovedRunUSD != nil && eb.CostPerApprovedRunUSD != nil {
+			add("cost_per_approved_run_usd", LowerIsBetter, *ea.CostPerApprovedRunUSD, *eb.CostPerApprovedRunUSD)
+		}
+		if ea.DurationSeconds.Count > 0 && eb.DurationSeconds.Count > 0 {
+			add("p95_duration_seconds", LowerIsBetter, ea.DurationSeconds.P95, eb.DurationSeconds.P95)
+		}
+	}
+
+	before, after := blockingByRule(a, b)
+	for _, key := range sortedStringKeys(after) {
+		if _, ok := before[key]; !ok {
+			d.FailuresGained = append(d.FailuresGained, after[key])
+		}
+	}
+	for _, key := range sortedStringKeys(before) {
+		if _, ok := after[key]; !ok {
+			d.FailuresLost = append(d.FailuresLost, before[key])
+		}
+	}
+	return d
+}
+
+// Regressions lists why b is worse than a: the gate verdict flipped to
+// fail, a failure was gained, or a metric worsened beyond tolerance.
+func (d ReportDiff) Regressions(tolerance float64) []string {
+	var out []string
+	if d.BeforePassed && !d.AfterPassed {
+		out = append(out, "gate verdict changed from pass to fail")
+	}
+	for _, f := range d.FailuresGained {
+		out = append(out, "failure gained: "+f)
+	}
+	for _, m := range d.Metrics {
+		if m.Worsened(tolerance) {
+			out = append(out, fmt.Sprintf("%s worsened %.2f -> %.2f (tolerance %.2f)", m.Name, m.Before, m.After, tolerance))
+		}
+	}
+	return out
+}
+
+// blockingByRule keys the failures of both reports by rule. Reports with
+// findings are keyed by rule ID; when either report predates findings, both
+// fall back to parsing the rule out of the failure text.
+func blockingByRule(a, b GateReport) (map[string]string, map[string]string) {
+	if a.Findings == nil || b.Findings == nil {
+		return failuresByRule(a.Failures), failuresByRule(b.Failures)
+	}
+	return findingsByRule(a.Findings, FindingBlock), findingsByRule(b.Findings, FindingBlock)
+}
+
+func findingsByRule(findings []Finding, severity string) map[string]string {
+	out := map[string]string{}
+	for _, f := range findings {
+		if f.Severity == severity {
+			out[f.RuleID] = f.Message
+		}
+	}
+	return out
+}
+
+// failuresByRule keys failures by their rule: the text before the first
+// parenthesis, "not measurable" note or numeric value.
+func failuresByRule(failures []string) map[string]string {
+	out := make(map[string]string, len(failures))
+	for _, f := range failures {
+		out[failureRule(f)] = f
+	}
+	return out
+}
+
+func failureRule(f string) string {
+	fields := strings.Fields(f)
+	var key []string
+	for _, w := range fields {
+		if strings.HasPrefix(w, "(") || w == "not" {
+			break
+		}
+		if r := []rune(w)[0]; unicode.IsDigit(r) || r == '-' {
+			break
+		}
+		key = append(key, w)
+	}
+	if len(key) == 0 {
+		return f
+	}
+	return strings.Join(key, " ")
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
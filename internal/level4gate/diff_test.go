@@ -0,0 +1,64 @@
+package level4gate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffMatchesFailuresByRule(t *testing.T) {
+	a := GateReport{
+		WindowID: "w1",
+		Passed:   false,
+		Metrics:  Metrics{RunCount: 10, ScenarioPassRatePercent: 92, MeanRetries: 2.1},
+		Failures: []string{
+			"mean_retries 2.10 > 2.00",
+			"run_count_by_class[medium_integration] 3 < 4",
+		},
+	}
+	b := GateReport{
+		WindowID: "w2",
+		Passed:   false,
+		Metrics:  Metrics{RunCount: 12, ScenarioPassRatePercent: 89.5, MeanRetries: 2.4},
+		Failures: []string{
+			"mean_retries 2.40 > 2.00",
+			"scenario_pass_rate 89.50 < 90.00",
+		},
+	}
+
+	d := Diff(a, b)
+	if len(d.FailuresGained) != 1 || d.FailuresGained[0] != "scenario_pass_rate 89.50 < 90.00" {
+		t.Fatalf("unexpected gained failures: %v", d.FailuresGained)
+	}
+	if len(d.FailuresLost) != 1 || d.FailuresLost[0] != "run_count_by_class[medium_integration] 3 < 4" {
+		t.Fatalf("unexpected lost failures: %v", d.FailuresLost)
+	}
+
+	got := d.Regressions(0.5)
+	want := []string{
+		"failure gained: scenario_pass_rate 89.50 < 90.00",
+		"scenario_pass_rate_percent worsened 92.00 -> 89.50 (tolerance 0.50)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected regressions: %v", got)
+	}
+}
+
+func TestDiffRegressionsHonourTolerance(t *testing.T) {
+	a := GateReport{Passed: true, Metrics: Metrics{ScenarioPassRatePercent: 95, MeanRetries: 1.0, RunCount: 20}}
+	b := GateReport{Passed: true, Metrics: Metrics{ScenarioPassRatePercent: 94.5, MeanRetries: 1.2, RunCount: 10}}
+
+	d := Diff(a, b)
+	if r := d.Regressions(0.5); len(r) != 0 {
+		t.Fatalf("expected no regressions within tolerance, got %v", r)
+	}
+	if r := d.Regressions(0.1); len(r) != 2 {
+		t.Fatalf("expected two regressions, got %v", r)
+	}
+
+	b.Passed = false
+	b.Failures = []string{"run_count below minimum window (need >= 12)"}
+	r := Diff(a, b).Regressions(1)
+	if len(r) != 2 || r[0] != "gate verdict changed from pass to fail" {
+		t.Fatalf("unexpected regressions: %v", r)
+	}
+}
@@ -0,0 +1,136 @@
+package level4gate
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Summary aggregates one optional numeric field over the runs that carry
+// it. Count is the number of runs with the field set.
+type Summary struct {
+	Count int     `json:"count"`
+	Total float64 `json:"total"`
+	Mean  float64 `json:"mean"`
+	P95   float64 `json:"p95"`
+}
+
+// EconomicMetrics aggregates token, cost and wall-clock fields. Cost per
+// approved run divides the cost of every run in the window, rejected and
+// failed runs included, by the number of approved runs; it is nil when the
+// window has no approved runs or no recorded cost.
+type EconomicMetrics struct {
+	TokensIn              Summary  `json:"tokens_in"`
+	TokensOut             Summary  `json:"tokens_out"`
+	CostUSD               Summary  `json:"cost_usd"`
+	DurationSeconds       Summary  `json:"duration_seconds"`
+	CostPerApprovedRunUSD *float64 `json:"cost_per_approved_run_usd,omitempty"`
+}
+
+// economicsAccumulator keeps every value it sees so the p95 is exact;
+// its memory grows with the number of records carrying the fields.
+type economicsAccumulator struct {
+	tokensIn, tokensOut, cost, duration []float64
+}
+
+func (a *economicsAccumulator) add(r EvalRecord) {
+	if r.TokensIn != nil {
+		a.tokensIn = append(a.tokensIn, float64(*r.TokensIn))
+	}
+	if r.TokensOut != nil {
+		a.tokensOut = append(a.tokensOut, float64(*r.TokensOut))
+	}
+	if r.CostUSD != nil {
+		a.cost = append(a.cost, *r.CostUSD)
+	}
+	if r.DurationSeconds != nil {
+		a.duration = append(a.duration, *r.DurationSeconds)
+	}
+}
+
+func (a *economicsAccumulator) metrics(approvedCount int) *EconomicMetrics {
+	if len(a.tokensIn)+len(a.tokensOut)+len(a.cost)+len(a.duration) == 0 {
+		return nil
+	}
+
+	e := &EconomicMetrics{
+		TokensIn:        summarize(a.tokensIn),
+		TokensOut:       summarize(a.tokensOut),
+		CostUSD:         summarize(a.cost),
+		DurationSeconds: summarize(a.duration),
+	}
+	if approvedCount > 0 && e.CostUSD.Count > 0 {
+		v := e.CostUSD.Total / float64(approvedCount)
+		e.CostPerApprovedRunUSD = &v
+	}
+	return e
+}
+
+func summarize(values []float64) Summary {
+	if len(values) == 0 {
+		return Summary{}
+	}
+	var total float64
+	for _, v := range values {
+		total += v
+	}
+	return Summary{
+		Count: len(values),
+		Total: total,
+		Mean:  total / float64(len(values)),
+		P95:   percentile(append([]float64(nil), values...), 95),
+	}
+}
+
+// economicFindings checks the optional economic ceilings. A ceiling fails
+// closed: if any run lacks the field it depends on, the rule cannot be
+// evaluated and is reported as a block finding rather than skipped.
+func economicFindings(m Metrics, t Thresholds, label func(string) string) []Finding {
+	var findings []Finding
+	e := m.Economics
+	if e == nil {
+		e = &EconomicMetrics{}
+	}
+	if t.MaxCostPerApprovedRunUSD != nil {
+		id := label("cost_per_approved_run_usd")
+		switch {
+		case e.CostUSD.Count < m.RunCount:
+			findings = append(findings, notMeasurable(id, "cost_usd missing on %d of %d runs", m.RunCount-e.CostUSD.Count, m.RunCount))
+		case e.CostPerApprovedRunUSD == nil:
+			findings = append(findings, notMeasurable(id, "no approved runs"))
+		default:
+			findings = append(findings, limit{id: id, observed: *e.CostPerApprovedRunUSD, threshold: *t.MaxCostPerApprovedRunUSD}.finding())
+		}
+	}
+	if t.MaxP95DurationSeconds != nil {
+		id := label("p95_duration_seconds")
+		if e.DurationSeconds.Count < m.RunCount {
+			findings = append(findings, notMeasurable(id, "duration_seconds missing on %d of %d runs", m.RunCount-e.DurationSeconds.Count, m.RunCount))
+		} else {
+			findings = append(findings, limit{id: id, observed: e.DurationSeconds.P95, threshold: *t.MaxP95DurationSeconds}.finding())
+		}
+	}
+	return findings
+}
+
+func validateEconomicThresholds(field string, t Thresholds) error {
+	if t.MaxCostPerApprovedRunUSD != nil && *t.MaxCostPerApprovedRunUSD < 0 {
+		return fmt.Errorf("%s.max_cost_per_approved_run_usd cannot be negative", field)
+	}
+	if t.MaxP95DurationSeconds != nil && *t.MaxP95DurationSeconds < 0 {
+		return fmt.Errorf("%s.max_p95_duration_seconds cannot be negative", field)
+	}
+	return nil
+}
+
+func validateRecordEconomics(r EvalRecord) error {
+	if (r.TokensIn != nil && *r.TokensIn < 0) || (r.TokensOut != nil && *r.TokensOut < 0) {
+		return errors.New("tokens_in/tokens_out cannot be negative")
+	}
+	if r.CostUSD != nil && *r.CostUSD < 0 {
+		return errors.New("cost_usd cannot be negative")
+	}
+	if r.DurationSeconds != nil && *r.DurationSeconds < 0 {
+		return errors.New("duration_seconds cannot be negative")
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package level4gate
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func economicRecords() []EvalRecord {
+	var records []EvalRecord
+	for i := 0; i < 10; i++ {
+		class := "low_risk_feature"
+		if i%2 == 1 {
+			class = "medium_integration"
+		}
+		decision := "approved"
+		if i >= 8 {
+			decision = "rejected"
+		}
+		tokensIn := int64(1000 * (i + 1))
+		tokensOut := int64(200)
+		cost := 0.5
+		duration := float64(60 * (i + 1))
+		records = append(records, EvalRecord{
+			RunID: "r", PipelineID: "p", PipelineClass: class,
+			ScenarioTotal: 10, ScenarioPassed: 10, FirstPassSuccess: true, Retries: 1, Interventions: 1, Decision: decision,
+			TokensIn: &tokensIn, TokensOut: &tokensOut, CostUSD: &cost, DurationSeconds: &duration,
+		})
+	}
+	return records
+}
+
+func TestComputeEconomics(t *testing.T) {
+	report := EvaluateWithCriteria(economicRecords(), DefaultCriteria(), "w")
+	e := report.Metrics.Economics
+	if e == nil {
+		t.Fatalf("expected economics metrics")
+	}
+	if e.TokensIn.Count != 10 || e.TokensIn.Mean != 5500 || e.TokensIn.P95 != 10000 {
+		t.Fatalf("unexpected tokens_in summary: %+v", e.TokensIn)
+	}
+	if e.DurationSeconds.P95 != 600 {
+		t.Fatalf("unexpected duration p95: %+v", e.DurationSeconds)
+	}
+	// Ten runs at $0.50 over eight approved runs.
+	if e.CostPerApprovedRunUSD == nil || math.Abs(*e.CostPerApprovedRunUSD-0.625) > 1e-9 {
+		t.Fatalf("unexpected cost per approved run: %v", e.CostPerApprovedRunUSD)
+	}
+
+	plain := economicRecords()
+	for i := range plain {
+		plain[i].TokensIn, plain[i].TokensOut, plain[i].CostUSD, plain[i].DurationSeconds = nil, nil, nil, nil
+	}
+	if report := EvaluateWithCriteria(plain, DefaultCriteria(), "w"); report.Metrics.Economics != nil {
+		t.Fatalf("expected nil economics without economic fields")
+	}
+}
+
+func TestEvaluateWithCriteriaAppliesEconomicThresholds(t *testing.T) {
+	c := DefaultCriteria()
+	maxCost := 0.60
+	maxP95 := 900.0
+	c.Thresholds.MaxCostPerApprovedRunUSD = &maxCost
+	c.Thresholds.MaxP95DurationSeconds = &maxP95
+
+	report := EvaluateWithCriteria(economicRecords(), c, "w")
+	want := "cost_per_approved_run_usd 0.62 > 0.60"
+	if report.Passed || len(report.Failures) != 1 || report.Failures[0] != want {
+		t.Fatalf("expected %q, got %v", want, report.Failures)
+	}
+
+	records := economicRecords()
+	records[3].DurationSeconds = nil
+	maxCost = 1.0
+	report = EvaluateWithCriteria(records, c, "w")
+	want = "p95_duration_seconds not measurable: duration_seconds missing on 1 of 10 runs"
+	if report.Passed || len(report.Failures) != 1 || report.Failures[0] != want {
+		t.Fatalf("expected %q, got %v", want, report.Failures)
+	}
+}
+
+func TestDecodeNDJSONAcceptsEconomicFieldsOnV03(t *testing.T) {
+	base := `"window_id":"w","run_id":"r1","pipeline_id":"p1","pipeline_class":"low_risk_feature","scenario_total":10,"scenario_passed":10,"first_pass_success":true,"retries":0,"interventions":0,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"2026-02-18T20:00:00Z","tokens_in":1200,"tokens_out":300,"cost_usd":0.42,"duration_seconds":95.5`
+	records, err := DecodeNDJSONWithOptions(strings.NewReader(`{"schema_version":"level4-eval-record-v0.3",`+base+`}`), DecodeOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r := records[0]; r.TokensIn == nil || *r.TokensIn != 1200 || r.CostUSD == nil || *r.CostUSD != 0.42 {
+		t.Fatalf("economic fields not decoded: %+v", r)
+	}
+
+	_, err = DecodeNDJSONWithOptions(strings.NewReader(`{`+base+`}`), DecodeOptions{Strict: true})
+	if err == nil || !strings.Contains(err.Error(), `unknown field "cost_usd"`) {
+		t.Fatalf("expected v0.1 strict decode to reject economic fields, got %v", err)
+	}
+
+	neg := strings.Replace(base, `"cost_usd":0.42`, `"cost_usd":-1`, 1)
+	_, err = DecodeNDJSONWithOptions(strings.NewReader(`{"schema_version":"level4-eval-record-v0.3",`+neg+`}`), DecodeOptions{})
+	if err == nil || !strings.Contains(err.Error(), "cost_usd cannot be negative") {
+		t.Fatalf("expected negative cost error, got %v", err)
+	}
+}
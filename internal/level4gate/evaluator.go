@@ -8,10 +8,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
+	"strings"
 	"time"
 )
 
 type EvalRecord struct {
+	SchemaVersion    string `json:"schema_version,omitempty"`
 	WindowID         string `json:"window_id"`
 	RunID            string `json:"run_id"`
 	PipelineID       string `json:"pipeline_id"`
@@ -25,6 +28,23 @@ type EvalRecord struct {
 	DecisionReversed bool   `json:"decision_reversed"`
 	CriticalIncident bool   `json:"critical_incident"`
 	Timestamp        string `json:"timestamp"`
+
+	// Economic fields are optional; records that predate them leave them nil.
+	TokensIn        *int64   `json:"tokens_in,omitempty"`
+	TokensOut       *int64   `json:"tokens_out,omitempty"`
+	CostUSD         *float64 `json:"cost_usd,omitempty"`
+	DurationSeconds *float64 `json:"duration_seconds,omitempty"`
+
+	// Scenario detail is optional. ScenarioCategories splits the scenario
+	// counts by suite category; FailedScenarios lists each failed scenario.
+	ScenarioCategories map[string]ScenarioCategoryCount `json:"scenario_categories,omitempty"`
+	FailedScenarios    []FailedScenario                 `json:"failed_scenarios,omitempty"`
+
+	// QualityMode is standard or high. High-quality runs are remediation
+	// runs with forced scenario outcomes and must say why in QualityReason.
+	// Records that predate the field leave both empty.
+	QualityMode   string `json:"quality_mode,omitempty"`
+	QualityReason string `json:"quality_reason,omitempty"`
 }
 
 type Thresholds struct {
@@ -33,13 +53,116 @@ type Thresholds struct {
 	MaxMeanRetries             float64 `json:"max_mean_retries"`
 	MaxDecisionReversalPercent float64 `json:"max_decision_reversal_percent"`
 	MaxApprovedIncidents       int     `json:"max_approved_incidents"`
+
+	// Economic ceilings are disabled when nil. When set, every run in the
+	// window must carry the underlying field or the rule fails.
+	MaxCostPerApprovedRunUSD *float64 `json:"max_cost_per_approved_run_usd,omitempty"`
+	MaxP95DurationSeconds    *float64 `json:"max_p95_duration_seconds,omitempty"`
+
+	// Scenario rules are disabled when unset. Category floors and severity
+	// ceilings fail when the window does not carry the detail they need.
+	MinWeightedScenarioPassRatePercent *float64           `json:"min_weighted_scenario_pass_rate_percent,omitempty"`
+	MinCategoryPassRatePercent         map[string]float64 `json:"min_category_pass_rate_percent,omitempty"`
+	MaxFailedScenariosBySeverity       map[string]int     `json:"max_failed_scenarios_by_severity,omitempty"`
+
+	// MaxIncidentsBySeverity caps linked incidents per severity (sev1 to
+	// sev4). It needs an incident stream; without one each ceiling fails.
+	MaxIncidentsBySeverity map[string]int `json:"max_incidents_by_severity,omitempty"`
+
+	// MaxRemediationSharePercent caps the share of runs with
+	// quality_mode=high. It is disabled when nil and fails when any run
+	// lacks quality_mode.
+	MaxRemediationSharePercent *float64 `json:"max_remediation_share_percent,omitempty"`
+}
+
+// PipelineClass is the per-class metadata a criteria profile declares in its
+// pipeline_classes registry.
+type PipelineClass struct {
+	Description    string `json:"description,omitempty"`
+	PipelinePrefix string `json:"pipeline_prefix,omitempty"`
+}
+
+// ThresholdOverrides replaces individual Thresholds fields for one pipeline
+// class. Nil fields inherit the window-level value.
+type ThresholdOverrides struct {
+	MinScenarioPassRatePercent *float64 `json:"min_scenario_pass_rate_percent,omitempty"`
+	MinFirstPassRatePercent    *float64 `json:"min_first_pass_rate_percent,omitempty"`
+	MaxMeanRetries             *float64 `json:"max_mean_retries,omitempty"`
+	MaxDecisionReversalPercent *float64 `json:"max_decision_reversal_percent,omitempty"`
+	MaxApprovedIncidents       *int     `json:"max_approved_incidents,omitempty"`
+	MaxCostPerApprovedRunUSD   *float64 `json:"max_cost_per_approved_run_usd,omitempty"`
+	MaxP95DurationSeconds      *float64 `json:"max_p95_duration_seconds,omitempty"`
+
+	MinWeightedScenarioPassRatePercent *float64           `json:"min_weighted_scenario_pass_rate_percent,omitempty"`
+	MinCategoryPassRatePercent         map[string]float64 `json:"min_category_pass_rate_percent,omitempty"`
+	MaxFailedScenariosBySeverity       map[string]int     `json:"max_failed_scenarios_by_severity,omitempty"`
+	MaxIncidentsBySeverity             map[string]int     `json:"max_incidents_by_severity,omitempty"`
+	MaxRemediationSharePercent         *float64           `json:"max_remediation_share_percent,omitempty"`
+}
+
+// Confidence configures the confidence intervals reported on rate metrics
+// and whether the floor thresholds gate on the point estimate or on the
+// interval's lower bound.
+type Confidence struct {
+	Level  float64 `json:"level"`
+	GateOn string  `json:"gate_on"`
 }
 
+const (
+	GateOnPoint      = "point"
+	GateOnLowerBound = "lower_bound"
+)
+
+// TrendRule selects how the intervention trend is tested. Records are
+// ordered by timestamp before any method runs.
+//
+//   - halves: the v0.1 rule; fails when the second-half average exceeds the
+//     first-half average.
+//   - least_squares: fails when the least-squares slope is positive and its
+//     one-sided t-test p-value is below Alpha.
+//   - mann_kendall: fails when the Mann-Kendall test finds an increasing
+//     trend with one-sided p-value below Alpha.
+type TrendRule struct {
+	Method string  `json:"method"`
+	Alpha  float64 `json:"alpha"`
+}
+
+const (
+	TrendHalves       = "halves"
+	TrendLeastSquares = "least_squares"
+	TrendMannKendall  = "mann_kendall"
+)
+
 type Criteria struct {
-	Version              string         `json:"version"`
-	MinRuns              int            `json:"min_runs"`
-	Thresholds           Thresholds     `json:"thresholds"`
-	RequiredClassMinimum map[string]int `json:"required_class_minimum"`
+	Version              string                        `json:"version"`
+	MinRuns              int                           `json:"min_runs"`
+	PipelineClasses      map[string]PipelineClass      `json:"pipeline_classes,omitempty"`
+	Thresholds           Thresholds                    `json:"thresholds"`
+	ClassThresholds      map[string]ThresholdOverrides `json:"class_thresholds,omitempty"`
+	RequiredClassMinimum map[string]int                `json:"required_class_minimum"`
+	Confidence           *Confidence                   `json:"confidence,omitempty"`
+	InterventionTrend    *TrendRule                    `json:"intervention_trend,omitempty"`
+	ScenarioScoring      *ScenarioScoring              `json:"scenario_scoring,omitempty"`
+	Rules                []ExprRule                    `json:"rules,omitempty"`
+	// WarnBands maps a rule ID, or a metric name for the window and every
+	// class, to a margin. A threshold that passes by no more than the margin
+	// is reported as a warning.
+	WarnBands map[string]float64 `json:"warn_bands,omitempty"`
+}
+
+// DecodeOptions controls how NDJSON records are decoded and validated.
+type DecodeOptions struct {
+	WindowID string
+	// Strict rejects keys that are not part of the record's schema version.
+	// By default unknown keys are ignored so newer emitters do not break
+	// older readers.
+	Strict bool
+	// PipelineClasses is the registry pipeline_class values are checked
+	// against. Nil means DefaultPipelineClasses.
+	PipelineClasses map[string]PipelineClass
+	// Duplicates is the policy for records sharing (window_id, run_id);
+	// empty means DuplicateError. DecodeNDJSONLines ignores it.
+	Duplicates string
 }
 
 type Metrics struct {
@@ -50,17 +173,64 @@ type Metrics struct {
 	MeanRetries                    float64        `json:"mean_retries"`
 	InterventionAvgFirstHalf       float64        `json:"intervention_avg_first_half"`
 	InterventionAvgSecondHalf      float64        `json:"intervention_avg_second_half"`
+	InterventionTrendMethod        string         `json:"intervention_trend_method"`
+	InterventionTrendSlope         float64        `json:"intervention_trend_slope"`
+	InterventionTrendPValue        *float64       `json:"intervention_trend_p_value,omitempty"`
 	InterventionStableOrDecreasing bool           `json:"intervention_stable_or_decreasing"`
 	DecisionReversalPercent        float64        `json:"decision_reversal_percent"`
 	ApprovedRunCriticalIncidents   int            `json:"approved_run_critical_incidents"`
+	ConfidenceLevel                float64        `json:"confidence_level"`
+	ScenarioPassRateCI             Interval       `json:"scenario_pass_rate_ci"`
+	FirstPassRateCI                Interval       `json:"first_pass_rate_ci"`
+	DecisionReversalCI             Interval       `json:"decision_reversal_ci"`
+	// Economics is nil when no record in the window carries an economic field.
+	Economics *EconomicMetrics `json:"economics,omitempty"`
+	// Scenarios is nil when no record carries scenario_categories or
+	// failed_scenarios.
+	Scenarios *ScenarioMetrics `json:"scenarios,omitempty"`
+	// Reversals is nil unless the window was evaluated with a reversal
+	// event stream. DecisionReversalPercent keeps its v0.1 definition,
+	// every reversed run over approved runs, with joined events counting
+	// as reversed; Reversals has the per-decision rates.
+	Reversals *ReversalMetrics `json:"reversals,omitempty"`
+	// Incidents is nil unless the window was evaluated with an incident
+	// stream. Linked sev1 incidents also count in
+	// ApprovedRunCriticalIncidents.
+	Incidents *IncidentMetrics `json:"incidents,omitempty"`
+	// Remediation is nil when no record carries quality_mode.
+	Remediation *RemediationMetrics `json:"remediation,omitempty"`
+}
+
+// ClassReport holds the metrics of one pipeline class. Thresholds is set only
+// for classes with a class_thresholds block, and only those classes can fail.
+type ClassReport struct {
+	PipelineClass string      `json:"pipeline_class"`
+	Thresholds    *Thresholds `json:"thresholds,omitempty"`
+	Metrics       Metrics     `json:"metrics"`
+	Passed        bool        `json:"passed"`
+	Failures      []string    `json:"failures"`
 }
 
+// GateReport is the verdict for one window. Inconclusive is set when a
+// floor threshold lies inside the confidence interval of its metric, so the
+// window does not carry enough evidence to decide that rule either way.
 type GateReport struct {
-	WindowID   string     `json:"window_id"`
-	Thresholds Thresholds `json:"thresholds"`
-	Metrics    Metrics    `json:"metrics"`
-	Passed     bool       `json:"passed"`
-	Failures   []string   `json:"failures"`
+	WindowID            string        `json:"window_id"`
+	Thresholds          Thresholds    `json:"thresholds"`
+	Metrics             Metrics       `json:"metrics"`
+	Classes             []ClassReport `json:"classes,omitempty"`
+	Passed              bool          `json:"passed"`
+	Inconclusive        bool          `json:"inconclusive"`
+	InconclusiveReasons []string      `json:"inconclusive_reasons,omitempty"`
+	Failures            []string      `json:"failures"`
+	// Warnings lists the messages of warn findings: warn-severity rules that
+	// did not hold and thresholds passed within their warn band. They do
+	// not affect Passed.
+	Warnings []string `json:"warnings,omitempty"`
+	// Findings holds one entry per rule checked, in the order Failures and
+	// Warnings list them. Failures and Warnings are the block and warn
+	// messages.
+	Findings []Finding `json:"findings,omitempty"`
 }
 
 func DefaultThresholds() Thresholds {
@@ -73,11 +243,25 @@ func DefaultThresholds() Thresholds {
 	}
 }
 
+func DefaultPipelineClasses() map[string]PipelineClass {
+	return map[string]PipelineClass{
+		"low_risk_feature": {
+			Description:    "Low-risk feature work",
+			PipelinePrefix: "p-low",
+		},
+		"medium_integration": {
+			Description:    "Medium-risk integration work",
+			PipelinePrefix: "p-med",
+		},
+	}
+}
+
 func DefaultCriteria() Criteria {
 	return Criteria{
-		Version:    "level4-gate-v0.1",
-		MinRuns:    10,
-		Thresholds: DefaultThresholds(),
+		Version:         "level4-gate-v0.1",
+		MinRuns:         10,
+		PipelineClasses: DefaultPipelineClasses(),
+		Thresholds:      DefaultThresholds(),
 		RequiredClassMinimum: map[string]int{
 			"low_risk_feature":   4,
 			"medium_integration": 4,
@@ -85,21 +269,363 @@ func DefaultCriteria() Criteria {
 	}
 }
 
+// Apply returns base with every non-nil override substituted.
+func (o ThresholdOverrides) Apply(base Thresholds) Thresholds {
+	out := base
+	if o.MinScenarioPassRatePercent != nil {
+		out.MinScenarioPassRatePercent = *o.MinScenarioPassRatePercent
+	}
+	if o.MinFirstPassRatePercent != nil {
+		out.MinFirstPassRatePercent = *o.MinFirstPassRatePercent
+	}
+	if o.MaxMeanRetries != nil {
+		out.MaxMeanRetries = *o.MaxMeanRetries
+	}
+	if o.MaxDecisionReversalPercent != nil {
+		out.MaxDecisionReversalPercent = *o.MaxDecisionReversalPercent
+	}
+	if o.MaxApprovedIncidents != nil {
+		out.MaxApprovedIncidents = *o.MaxApprovedIncidents
+	}
+	if o.MaxCostPerApprovedRunUSD != nil {
+		out.MaxCostPerApprovedRunUSD = o.MaxCostPerApprovedRunUSD
+	}
+	if o.MaxP95DurationSeconds != nil {
+		out.MaxP95DurationSeconds = o.MaxP95DurationSeconds
+	}
+	if o.MinWeightedScenarioPassRatePercent != nil {
+		out.MinWeightedScenarioPassRatePercent = o.MinWeightedScenarioPassRatePercent
+	}
+	if o.MinCategoryPassRatePercent != nil {
+		out.MinCategoryPassRatePercent = o.MinCategoryPassRatePercent
+	}
+	if o.MaxFailedScenariosBySeverity != nil {
+		out.MaxFailedScenariosBySeverity = o.MaxFailedScenariosBySeverity
+	}
+	if o.MaxIncidentsBySeverity != nil {
+		out.MaxIncidentsBySeverity = o.MaxIncidentsBySeverity
+	}
+	if o.MaxRemediationSharePercent != nil {
+		out.MaxRemediationSharePercent = o.MaxRemediationSharePercent
+	}
+	return out
+}
+
+// ClassThresholdsFor returns the effective thresholds for className and
+// whether the criteria declares an override block for it.
+func (c Criteria) ClassThresholdsFor(className string) (Thresholds, bool) {
+	o, ok := c.ClassThresholds[className]
+	if !ok {
+		return c.Thresholds, false
+	}
+	return o.Apply(c.Thresholds), true
+}
+
+// ConfidenceOptions returns the confidence settings with defaults applied:
+// a 95% level, gating on the point estimate.
+func (c Criteria) ConfidenceOptions() Confidence {
+	out := Confidence{Level: 0.95, GateOn: GateOnPoint}
+	if c.Confidence != nil {
+		if c.Confidence.Level != 0 {
+			out.Level = c.Confidence.Level
+		}
+		if c.Confidence.GateOn != "" {
+			out.GateOn = c.Confidence.GateOn
+		}
+	}
+	return out
+}
+
+// TrendRuleOptions returns the intervention trend rule with defaults
+// applied: the v0.1 halves rule, so profiles that name no method keep their
+// v0.1 verdicts, and alpha 0.05 for the methods that use it. Mann-Kendall
+// and least squares are opt-in.
+func (c Criteria) TrendRuleOptions() TrendRule {
+	out := TrendRule{Method: TrendHalves, Alpha: 0.05}
+	if c.InterventionTrend != nil {
+		if c.InterventionTrend.Method != "" {
+			out.Method = c.InterventionTrend.Method
+		}
+		if c.InterventionTrend.Alpha != 0 {
+			out.Alpha = c.InterventionTrend.Alpha
+		}
+	}
+	return out
+}
+
+// Classes returns the declared pipeline class registry. Profiles written
+// before pipeline_classes existed fall back to DefaultPipelineClasses.
+func (c Criteria) Classes() map[string]PipelineClass {
+	if len(c.PipelineClasses) == 0 {
+		return DefaultPipelineClasses()
+	}
+	return c.PipelineClasses
+}
+
+// ClassNames returns the declared pipeline class names in sorted order.
+func (c Criteria) ClassNames() []string {
+	return classNames(c.Classes())
+}
+
+// Validate checks the criteria profile for internal consistency.
+func (c Criteria) Validate() error {
+	return c.validate()
+}
+
+// validate is Validate, and also replaces c.Rules with a copy that carries
+// each rule's compiled expression, so reports do not parse rules again.
+// DecodeCriteria and WithParameter use it; Validate works on a copy and
+// leaves the caller's rules alone.
+func (c *Criteria) validate() error {
+	if c.Version == "" {
+		return fmt.Errorf("version is required")
+	}
+	if c.MinRuns <= 0 {
+		return fmt.Errorf("min_runs must be > 0")
+	}
+	classes := c.Classes()
+	for name := range classes {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("pipeline_classes cannot contain an empty class name")
+		}
+	}
+	for _, name := range sortedKeys(c.RequiredClassMinimum) {
+		if _, ok := classes[name]; !ok {
+			return fmt.Errorf("required_class_minimum references undeclared pipeline_class %q", name)
+		}
+		if c.RequiredClassMinimum[name] < 0 {
+			return fmt.Errorf("required_class_minimum[%s] cannot be negative", name)
+		}
+	}
+	if err := validateCoreThresholds("thresholds", c.Thresholds); err != nil {
+		return err
+	}
+	if err := validateEconomicThresholds("thresholds", c.Thresholds); err != nil {
+		return err
+	}
+	if err := validateScenarioThresholds("thresholds", c.Thresholds); err != nil {
+		return err
+	}
+	if err := validateIncidentThresholds("thresholds", c.Thresholds); err != nil {
+		return err
+	}
+	if err := validateRemediationThresholds("thresholds", c.Thresholds); err != nil {
+		return err
+	}
+	if err := c.ScenarioScoring.validate(); err != nil {
+		return err
+	}
+	rules, err := compileRules(c.Rules, classes)
+	if err != nil {
+		return err
+	}
+	c.Rules = rules
+	if err := validateWarnBands(c.WarnBands, classes); err != nil {
+		return err
+	}
+	for name, o := range c.ClassThresholds {
+		if _, ok := classes[name]; !ok {
+			return fmt.Errorf("class_thresholds references undeclared pipeline_class %q", name)
+		}
+		if err := validateCoreThresholds("class_thresholds["+name+"]", o.Apply(Thresholds{})); err != nil {
+			return err
+		}
+		if err := validateEconomicThresholds("class_thresholds["+name+"]", o.Apply(Thresholds{})); err != nil {
+			return err
+		}
+		if err := validateScenarioThresholds("class_thresholds["+name+"]", o.Apply(Thresholds{})); err != nil {
+			return err
+		}
+		if err := validateIncidentThresholds("class_thresholds["+name+"]", o.Apply(Thresholds{})); err != nil {
+			return err
+		}
+		if err := validateRemediationThresholds("class_thresholds["+name+"]", o.Apply(Thresholds{})); err != nil {
+			return err
+		}
+	}
+	conf := c.ConfidenceOptions()
+	if conf.Level <= 0 || conf.Level >= 1 {
+		return fmt.Errorf("confidence.level must be between 0 and 1 exclusive")
+	}
+	if conf.GateOn != GateOnPoint && conf.GateOn != GateOnLowerBound {
+		return fmt.Errorf("confidence.gate_on must be %s|%s", GateOnPoint, GateOnLowerBound)
+	}
+	trend := c.TrendRuleOptions()
+	switch trend.Method {
+	case TrendHalves, TrendLeastSquares, TrendMannKendall:
+	default:
+		return fmt.Errorf("intervention_trend.method must be %s|%s|%s", TrendHalves, TrendLeastSquares, TrendMannKendall)
+	}
+	if trend.Alpha <= 0 || trend.Alpha >= 1 {
+		return fmt.Errorf("intervention_trend.alpha must be between 0 and 1 exclusive")
+	}
+	return nil
+}
+
+// LoadCriteria reads the profile at path, applies its extends chain and
+// validates the result.
+func LoadCriteria(path string) (Criteria, error) {
+	resolved, err := ResolveCriteria(path)
+	if err != nil {
+		return Criteria{}, err
+	}
+	return resolved.Decode()
+}
+
+// validateCoreThresholds checks the v0.1 thresholds against the ranges the
+// criteria schema allows.
+func validateCoreThresholds(field string, t Thresholds) error {
+	for _, p := range []struct {
+		name  string
+		value float64
+	}{
+		{"min_scenario_pass_rate_percent", t.MinScenarioPassRatePercent},
+		{"min_first_pass_rate_percent", t.MinFirstPassRatePercent},
+		{"max_decision_reversal_percent", t.MaxDecisionReversalPercent},
+	} {
+		if p.value < 0 || p.value > 100 {
+			return fmt.Errorf("%s.%s must be between 0 and 100", field, p.name)
+		}
+	}
+	if t.MaxMeanRetries < 0 {
+		return fmt.Errorf("%s.max_mean_retries cannot be negative", field)
+	}
+	if t.MaxApprovedIncidents < 0 {
+		return fmt.Errorf("%s.max_approved_incidents cannot be negative", field)
+	}
+	return nil
+}
+
+// DecodeCriteria decodes a self-contained profile. Profiles that use extends
+// must be loaded from a file with LoadCriteria so the parent can be found.
+// Unknown keys are rejected and the keys schemas/level4-gate-criteria-v0.1.json
+// requires must be present, so a missing threshold is not read as zero.
+func DecodeCriteria(r io.Reader) (Criteria, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return Criteria{}, err
+	}
+	var head struct {
+		Extends *json.RawMessage `json:"extends"`
+	}
+	if err := json.Unmarshal(raw, &head); err == nil && head.Extends != nil {
+		return Criteria{}, errors.New("extends is only supported when loading criteria from a file")
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var c Criteria
+	if err := dec.Decode(&c); err != nil {
+		return Criteria{}, err
+	}
+	if err := c.validate(); err != nil {
+		return Criteria{}, err
+	}
+	if err := requireKeys(raw, "", "version", "min_runs", "thresholds", "required_class_minimum"); err != nil {
+		return Criteria{}, err
+	}
+	if err := requireKeys(raw, "thresholds", "min_scenario_pass_rate_percent", "min_first_pass_rate_percent", "max_mean_retries", "max_decision_reversal_percent", "max_approved_incidents"); err != nil {
+		return Criteria{}, err
+	}
+	return c, nil
+}
+
+// requireKeys checks that the object at field (the document itself when
+// field is empty) has every key in keys.
+func requireKeys(raw json.RawMessage, field string, keys ...string) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return err
+	}
+	prefix := ""
+	if field != "" {
+		if err := json.Unmarshal(obj[field], &obj); err != nil {
+			return fmt.Errorf("%s must be an object", field)
+		}
+		prefix = field + "."
+	}
+	for _, k := range keys {
+		if _, ok := obj[k]; !ok {
+			return fmt.Errorf("%s%s is required", prefix, k)
+		}
+	}
+	return nil
+}
+
 func LoadNDJSON(path string, windowID string) ([]EvalRecord, error) {
+	return LoadNDJSONWithOptions(path, DecodeOptions{WindowID: windowID})
+}
+
+func LoadNDJSONWithOptions(path string, opts DecodeOptions) ([]EvalRecord, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	return DecodeNDJSON(f, windowID)
+	return DecodeNDJSONWithOptions(f, opts)
 }
 
 func DecodeNDJSON(r io.Reader, windowID string) ([]EvalRecord, error) {
+	return DecodeNDJSONWithOptions(r, DecodeOptions{WindowID: windowID})
+}
+
+func DecodeNDJSONWithOptions(r io.Reader, opts DecodeOptions) ([]EvalRecord, error) {
+	var out []EvalRecord
+	n, err := DecodeNDJSONFunc(r, opts, func(rec EvalRecord) error {
+		out = append(out, rec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, errors.New("no records matched filter")
+	}
+	return out, nil
+}
+
+// DecodeNDJSONFunc decodes and validates records one line at a time and
+// calls fn for each record that matches opts.WindowID, after applying
+// opts.Duplicates. Apart from keep-last, which holds the records until the
+// input ends, the input is not kept in memory. It returns the number of
+// records passed to fn. An error from fn stops decoding and is returned as
+// is.
+func DecodeNDJSONFunc(r io.Reader, opts DecodeOptions, fn func(EvalRecord) error) (int, error) {
+	n := 0
+	d, err := NewDeduper(opts.Duplicates, func(rec EvalRecord) error {
+		if err := fn(rec); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := DecodeNDJSONLines(r, opts, func(line int, rec EvalRecord) error {
+		return d.Add(RecordPosition{Line: line}, rec)
+	}); err != nil {
+		return n, err
+	}
+	if err := d.Flush(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// DecodeNDJSONLines is DecodeNDJSONFunc without duplicate handling: fn gets
+// every matching record with its 1-based line number. Callers that read
+// several inputs pair it with one Deduper.
+func DecodeNDJSONLines(r io.Reader, opts DecodeOptions, fn func(line int, rec EvalRecord) error) (int, error) {
+	classes := opts.PipelineClasses
+	if classes == nil {
+		classes = DefaultPipelineClasses()
+	}
+
 	sc := bufio.NewScanner(r)
 	sc.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
 
-	var out []EvalRecord
+	n := 0
 	line := 0
 	for sc.Scan() {
 		line++
@@ -108,68 +634,25 @@ func DecodeNDJSON(r io.Reader, windowID string) ([]EvalRecord, error) {
 			continue
 		}
 
-		rec, err := decodeLine(raw)
+		rec, err := decodeLine(raw, opts.Strict)
 		if err != nil {
-			return nil, fmt.Errorf("line %d: %w", line, err)
+			return n, fmt.Errorf("line %d: %w", line, err)
 		}
-		if windowID != "" && rec.WindowID != windowID {
+		if opts.WindowID != "" && rec.WindowID != opts.WindowID {
 			continue
 		}
-		if err := validateRecord(rec); err != nil {
-			return nil, fmt.Errorf("line %d: %w", line, err)
+		if err := validateRecord(rec, classes); err != nil {
+			return n, fmt.Errorf("line %d: %w", line, err)
 		}
-		out = append(out, rec)
-	}
-
-	if err := sc.Err(); err != nil {
-		return nil, err
-	}
-	if len(out) == 0 {
-		return nil, errors.New("no records matched filter")
-	}
-	return out, nil
-}
-
-func decodeLine(raw []byte) (EvalRecord, error) {
-	var keySet map[string]json.RawMessage
-	if err := json.Unmarshal(raw, &keySet); err != nil {
-		return EvalRecord{}, err
-	}
-
-	requiredKeys := map[string]struct{}{
-		"window_id":          {},
-		"run_id":             {},
-		"pipeline_id":        {},
-		"pipeline_class":     {},
-		"scenario_total":     {},
-		"scenario_passed":    {},
-		"first_pass_success": {},
-		"retries":            {},
-		"interventions":      {},
-		"decision":           {},
-		"decision_reversed":  {},
-		"critical_incident":  {},
-		"timestamp":          {},
-	}
-
-	for req := range requiredKeys {
-		if _, ok := keySet[req]; !ok {
-			return EvalRecord{}, fmt.Errorf("missing required field %q", req)
+		if err := fn(line, rec); err != nil {
+			return n, err
 		}
+		n++
 	}
-	for k := range keySet {
-		if _, ok := requiredKeys[k]; !ok {
-			return EvalRecord{}, fmt.Errorf("unknown field %q", k)
-		}
-	}
-
-	dec := json.NewDecoder(bytes.NewReader(raw))
-	dec.DisallowUnknownFields()
-	var rec EvalRecord
-	if err := dec.Decode(&rec); err != nil {
-		return EvalRecord{}, err
+	if err := sc.Err(); err != nil {
+		return n, err
 	}
-	return rec, nil
+	return n, nil
 }
 
 func Evaluate(records []EvalRecord, thresholds Thresholds, windowID string) GateReport {
@@ -178,124 +661,160 @@ func Evaluate(records []EvalRecord, thresholds Thresholds, windowID string) Gate
 	return EvaluateWithCriteria(records, criteria, windowID)
 }
 
+// EvaluateWithCriteria evaluates records in memory. Callers with large
+// inputs can feed an Accumulator directly instead.
 func EvaluateWithCriteria(records []EvalRecord, criteria Criteria, windowID string) GateReport {
-	m := computeMetrics(records)
-	failures := evaluateFailures(m, criteria)
-	return GateReport{
-		WindowID:   windowID,
-		Thresholds: criteria.Thresholds,
-		Metrics:    m,
-		Passed:     len(failures) == 0,
-		Failures:   failures,
-	}
-}
-
-func computeMetrics(records []EvalRecord) Metrics {
-	var scenarioTotal, scenarioPassed int
-	var firstPassCount int
-	var retriesTotal int
-	var interventionsTotal int
-	var reversals int
-	var approvedCount int
-	var approvedIncidents int
-	classCounts := map[string]int{}
-
-	firstHalfInterventions := 0
-	secondHalfInterventions := 0
-	split := len(records) / 2
+	acc := NewAccumulator(criteria)
+	for _, r := range records {
+		acc.Add(r)
+	}
+	return acc.Report(windowID)
+}
+
+// applyInterventionTrend fills the intervention trend metrics. The slope is
+// always the least-squares slope in interventions per run; the p-value is
+// the one-sided p-value of the selected method and is nil for halves.
+func applyInterventionTrend(m *Metrics, ys []float64, rule TrendRule) {
+	split := len(ys) / 2
 	if split == 0 {
 		split = 1
 	}
-
-	for i, r := range records {
-		classCounts[r.PipelineClass]++
-		scenarioTotal += r.ScenarioTotal
-		scenarioPassed += r.ScenarioPassed
-		if r.FirstPassSuccess {
-			firstPassCount++
-		}
-		retriesTotal += r.Retries
-		interventionsTotal += r.Interventions
-		if r.DecisionReversed {
-			reversals++
-		}
-		if r.Decision == "approved" {
-			approvedCount++
-			if r.CriticalIncident {
-				approvedIncidents++
-			}
-		}
-
+	var firstHalf, secondHalf float64
+	for i, y := range ys {
 		if i < split {
-			firstHalfInterventions += r.Interventions
+			firstHalf += y
 		} else {
-			secondHalfInterventions += r.Interventions
+			secondHalf += y
 		}
 	}
-
-	runCount := len(records)
-	secondHalfCount := runCount - split
+	secondHalfCount := len(ys) - split
 	if secondHalfCount == 0 {
 		secondHalfCount = 1
 	}
-	approvedDenominator := approvedCount
-	if approvedDenominator == 0 {
-		approvedDenominator = 1
-	}
+	m.InterventionAvgFirstHalf = firstHalf / float64(split)
+	m.InterventionAvgSecondHalf = secondHalf / float64(secondHalfCount)
 
-	scenarioPassRate := 0.0
-	if scenarioTotal > 0 {
-		scenarioPassRate = pct(float64(scenarioPassed), float64(scenarioTotal))
-	}
+	slope, lsP := leastSquaresSlope(ys)
+	m.InterventionTrendMethod = rule.Method
+	m.InterventionTrendSlope = slope
 
-	return Metrics{
-		RunCount:                       runCount,
-		RunCountByClass:                classCounts,
-		ScenarioPassRatePercent:        scenarioPassRate,
-		FirstPassRatePercent:           pct(float64(firstPassCount), float64(runCount)),
-		MeanRetries:                    float64(retriesTotal) / float64(runCount),
-		InterventionAvgFirstHalf:       float64(firstHalfInterventions) / float64(split),
-		InterventionAvgSecondHalf:      float64(secondHalfInterventions) / float64(secondHalfCount),
-		InterventionStableOrDecreasing: float64(secondHalfInterventions)/float64(secondHalfCount) <= float64(firstHalfInterventions)/float64(split),
-		DecisionReversalPercent:        pct(float64(reversals), float64(approvedDenominator)),
-		ApprovedRunCriticalIncidents:   approvedIncidents,
+	switch rule.Method {
+	case TrendHalves:
+		m.InterventionTrendPValue = nil
+		m.InterventionStableOrDecreasing = m.InterventionAvgSecondHalf <= m.InterventionAvgFirstHalf
+	case TrendLeastSquares:
+		m.InterventionTrendPValue = &lsP
+		m.InterventionStableOrDecreasing = !(slope > 0 && lsP < rule.Alpha)
+	default:
+		s, p := mannKendall(ys)
+		m.InterventionTrendPValue = &p
+		m.InterventionStableOrDecreasing = !(s > 0 && p < rule.Alpha)
 	}
 }
 
-func evaluateFailures(m Metrics, c Criteria) []string {
-	t := c.Thresholds
-	var failures []string
-	if m.RunCount < c.MinRuns {
-		failures = append(failures, fmt.Sprintf("run_count below minimum window (need >= %d)", c.MinRuns))
-	}
-	for className, min := range c.RequiredClassMinimum {
-		got := m.RunCountByClass[className]
-		if got < min {
-			failures = append(failures, fmt.Sprintf("run_count_by_class[%s] %d < %d", className, got, min))
+// windowFindings checks the window-level rules: minimum run counts, the
+// thresholds and the intervention trend.
+func windowFindings(m Metrics, c Criteria) []Finding {
+	runs := limit{id: "run_count", observed: float64(m.RunCount), threshold: float64(c.MinRuns), floor: true, integer: true}.finding()
+	if runs.Severity == FindingBlock {
+		runs.Message = fmt.Sprintf("run_count below minimum window (need >= %d)", c.MinRuns)
+	}
+	findings := []Finding{runs}
+	for _, className := range sortedKeys(c.RequiredClassMinimum) {
+		findings = append(findings, limit{
+			id:        fmt.Sprintf("run_count_by_class[%s]", className),
+			observed:  float64(m.RunCountByClass[className]),
+			threshold: float64(c.RequiredClassMinimum[className]),
+			floor:     true,
+			integer:   true,
+		}.finding())
+	}
+	findings = append(findings, thresholdFindings(m, c.Thresholds, c.ConfidenceOptions().GateOn, "")...)
+	findings = append(findings, trendFinding(m, c.TrendRuleOptions()))
+	if f, ok := reversalFinding(m); ok {
+		findings = append(findings, f)
+	}
+	if f, ok := incidentLinkFinding(m); ok {
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+func trendFinding(m Metrics, rule TrendRule) Finding {
+	f := Finding{RuleID: "intervention_trend", Severity: FindingInfo, Message: "intervention trend stable or decreasing"}
+	switch {
+	case m.InterventionStableOrDecreasing:
+	case m.InterventionTrendPValue == nil:
+		f.Severity = FindingBlock
+		f.Message = "intervention trend increased in second half"
+	default:
+		f.Severity = FindingBlock
+		f.Message = fmt.Sprintf(
+			"intervention trend increasing (%s slope=%.3f p=%.4f < alpha %.2f)",
+			m.InterventionTrendMethod,
+			m.InterventionTrendSlope,
+			*m.InterventionTrendPValue,
+			rule.Alpha,
+		)
+	}
+	return f
+}
+
+// thresholdFindings checks m against t. With gateOn=lower_bound the floor
+// rules compare the lower bound of the confidence interval instead of the
+// point estimate. A non-empty className labels each rule ID as
+// metric[className].
+func thresholdFindings(m Metrics, t Thresholds, gateOn string, className string) []Finding {
+	label := classLabel(className)
+	floor := label
+	scenarioPass := m.ScenarioPassRatePercent
+	firstPass := m.FirstPassRatePercent
+	if gateOn == GateOnLowerBound {
+		floor = func(name string) string { return label(name) + " lower_bound" }
+		scenarioPass = m.ScenarioPassRateCI.Lower
+		firstPass = m.FirstPassRateCI.Lower
+	}
+	findings := []Finding{
+		limit{id: label("scenario_pass_rate"), label: floor("scenario_pass_rate"), observed: scenarioPass, threshold: t.MinScenarioPassRatePercent, floor: true}.finding(),
+		limit{id: label("first_pass_rate"), label: floor("first_pass_rate"), observed: firstPass, threshold: t.MinFirstPassRatePercent, floor: true}.finding(),
+		limit{id: label("mean_retries"), observed: m.MeanRetries, threshold: t.MaxMeanRetries}.finding(),
+		limit{id: label("decision_reversal_rate"), observed: m.DecisionReversalPercent, threshold: t.MaxDecisionReversalPercent}.finding(),
+		limit{id: label("approved_run_critical_incidents"), observed: float64(m.ApprovedRunCriticalIncidents), threshold: float64(t.MaxApprovedIncidents), integer: true}.finding(),
+	}
+	findings = append(findings, economicFindings(m, t, label)...)
+	findings = append(findings, scenarioFindings(m, t, label)...)
+	findings = append(findings, incidentFindings(m, t, label)...)
+	findings = append(findings, remediationFindings(m, t, label)...)
+	return findings
+}
+
+// inconclusiveReasons lists the floor rules whose threshold lies inside the
+// metric's confidence interval. Ceiling rules are not included: with the
+// window sizes we run, a zero-event ceiling such as decision reversals is
+// almost never excluded by its interval.
+func inconclusiveReasons(m Metrics, t Thresholds, className string) []string {
+	label := classLabel(className)
+	level := m.ConfidenceLevel * 100
+	var reasons []string
+	if m.ScenarioPassRateCI.Spans(t.MinScenarioPassRatePercent) {
+		reasons = append(reasons, fmt.Sprintf("%s %.0f%% CI [%.2f, %.2f] spans threshold %.2f", label("scenario_pass_rate"), level, m.ScenarioPassRateCI.Lower, m.ScenarioPassRateCI.Upper, t.MinScenarioPassRatePercent))
+	}
+	if m.FirstPassRateCI.Spans(t.MinFirstPassRatePercent) {
+		reasons = append(reasons, fmt.Sprintf("%s %.0f%% CI [%.2f, %.2f] spans threshold %.2f", label("first_pass_rate"), level, m.FirstPassRateCI.Lower, m.FirstPassRateCI.Upper, t.MinFirstPassRatePercent))
+	}
+	return reasons
+}
+
+func classLabel(className string) func(string) string {
+	return func(name string) string {
+		if className == "" {
+			return name
 		}
+		return fmt.Sprintf("%s[%s]", name, className)
 	}
-	if m.ScenarioPassRatePercent < t.MinScenarioPassRatePercent {
-		failures = append(failures, fmt.Sprintf("scenario_pass_rate %.2f < %.2f", m.ScenarioPassRatePercent, t.MinScenarioPassRatePercent))
-	}
-	if m.FirstPassRatePercent < t.MinFirstPassRatePercent {
-		failures = append(failures, fmt.Sprintf("first_pass_rate %.2f < %.2f", m.FirstPassRatePercent, t.MinFirstPassRatePercent))
-	}
-	if m.MeanRetries > t.MaxMeanRetries {
-		failures = append(failures, fmt.Sprintf("mean_retries %.2f > %.2f", m.MeanRetries, t.MaxMeanRetries))
-	}
-	if !m.InterventionStableOrDecreasing {
-		failures = append(failures, "intervention trend increased in second half")
-	}
-	if m.DecisionReversalPercent > t.MaxDecisionReversalPercent {
-		failures = append(failures, fmt.Sprintf("decision_reversal_rate %.2f > %.2f", m.DecisionReversalPercent, t.MaxDecisionReversalPercent))
-	}
-	if m.ApprovedRunCriticalIncidents > t.MaxApprovedIncidents {
-		failures = append(failures, fmt.Sprintf("approved_run_critical_incidents %d > %d", m.ApprovedRunCriticalIncidents, t.MaxApprovedIncidents))
-	}
-	return failures
 }
 
-func validateRecord(r EvalRecord) error {
+func validateRecord(r EvalRecord, classes map[string]PipelineClass) error {
 	if r.WindowID == "" {
 		return errors.New("window_id is required")
 	}
@@ -305,10 +824,8 @@ func validateRecord(r EvalRecord) error {
 	if r.PipelineID == "" {
 		return errors.New("pipeline_id is required")
 	}
-	switch r.PipelineClass {
-	case "low_risk_feature", "medium_integration":
-	default:
-		return errors.New("pipeline_class must be low_risk_feature|medium_integration")
+	if _, ok := classes[r.PipelineClass]; !ok {
+		return fmt.Errorf("pipeline_class %q is not declared (declared: %s)", r.PipelineClass, strings.Join(classNames(classes), "|"))
 	}
 	if r.ScenarioTotal < 1 || r.ScenarioPassed < 0 || r.ScenarioPassed > r.ScenarioTotal {
 		return errors.New("invalid scenario counts")
@@ -316,6 +833,15 @@ func validateRecord(r EvalRecord) error {
 	if r.Retries < 0 || r.Interventions < 0 {
 		return errors.New("retries/interventions cannot be negative")
 	}
+	if err := validateRecordEconomics(r); err != nil {
+		return err
+	}
+	if err := validateRecordScenarios(r); err != nil {
+		return err
+	}
+	if err := validateRecordQuality(r); err != nil {
+		return err
+	}
 	switch r.Decision {
 	case "approved", "rejected", "failed":
 	default:
@@ -336,3 +862,21 @@ func pct(n, d float64) float64 {
 	}
 	return (n / d) * 100.0
 }
+
+func classNames(classes map[string]PipelineClass) []string {
+	out := make([]string, 0, len(classes))
+	for name := range classes {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func sortedKeys(m map[string]int) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -1,8 +1,10 @@
 package level4gate
 
 import (
+	"math"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestEvaluatePass(t *testing.T) {
@@ -50,7 +52,7 @@ func TestEvaluateFail(t *testing.T) {
 
 func TestDecodeNDJSONRejectsUnknownField(t *testing.T) {
 	in := `{"window_id":"w","run_id":"r1","pipeline_id":"p1","pipeline_class":"low_risk_feature","scenario_total":10,"scenario_passed":10,"first_pass_success":true,"retries":0,"interventions":0,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"2026-02-18T20:00:00Z","extra":"nope"}`
-	_, err := DecodeNDJSON(strings.NewReader(in), "")
+	_, err := DecodeNDJSONWithOptions(strings.NewReader(in), DecodeOptions{Strict: true})
 	if err == nil {
 		t.Fatalf("expected error for unknown field")
 	}
@@ -82,7 +84,7 @@ func TestDecodeNDJSONRejectsInvalidSchemaValues(t *testing.T) {
 	if err == nil {
 		t.Fatalf("expected decode failure")
 	}
-	if !strings.Contains(err.Error(), "line 1: pipeline_class must be low_risk_feature|medium_integration") {
+	if !strings.Contains(err.Error(), `line 1: pipeline_class "unknown" is not declared (declared: low_risk_feature|medium_integration)`) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
@@ -97,3 +99,207 @@ func TestDecodeNDJSONAcceptsValidRecord(t *testing.T) {
 		t.Fatalf("expected one record, got %d", len(recs))
 	}
 }
+
+func TestDecodeNDJSONHonoursDeclaredPipelineClasses(t *testing.T) {
+	in := `{"window_id":"w","run_id":"r1","pipeline_id":"p1","pipeline_class":"infra_change","scenario_total":10,"scenario_passed":10,"first_pass_success":true,"retries":0,"interventions":0,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"2026-02-18T20:00:00Z"}`
+	if _, err := DecodeNDJSON(strings.NewReader(in), "w"); err == nil {
+		t.Fatalf("expected undeclared class to fail with default registry")
+	}
+
+	recs, err := DecodeNDJSONWithOptions(strings.NewReader(in), DecodeOptions{
+		WindowID: "w",
+		PipelineClasses: map[string]PipelineClass{
+			"infra_change": {PipelinePrefix: "p-infra"},
+			"docs_only":    {},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recs) != 1 || recs[0].PipelineClass != "infra_change" {
+		t.Fatalf("unexpected records: %+v", recs)
+	}
+}
+
+func TestDecodeCriteriaRejectsUndeclaredRequiredClass(t *testing.T) {
+	in := `{"version":"v","min_runs":1,"pipeline_classes":{"docs_only":{}},"thresholds":{},"required_class_minimum":{"infra_change":1}}`
+	_, err := DecodeCriteria(strings.NewReader(in))
+	if err == nil {
+		t.Fatalf("expected criteria validation error")
+	}
+	if !strings.Contains(err.Error(), `undeclared pipeline_class "infra_change"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestEvaluateWithCriteriaAppliesClassThresholds(t *testing.T) {
+	var records []EvalRecord
+	for i := 0; i < 5; i++ {
+		records = append(records,
+			EvalRecord{RunID: "l", PipelineID: "p", PipelineClass: "low_risk_feature", ScenarioTotal: 10, ScenarioPassed: 10, FirstPassSuccess: true, Retries: 1, Decision: "approved"},
+			EvalRecord{RunID: "m", PipelineID: "p", PipelineClass: "medium_integration", ScenarioTotal: 10, ScenarioPassed: 10, FirstPassSuccess: true, Retries: 3, Decision: "approved"},
+		)
+	}
+	c := DefaultCriteria()
+	c.Thresholds.MaxMeanRetries = 2.5
+
+	if report := EvaluateWithCriteria(records, c, "w"); !report.Passed {
+		t.Fatalf("expected aggregate pass without overrides, got: %v", report.Failures)
+	}
+
+	lowMax := 1.0
+	medMax := 3.0
+	c.ClassThresholds = map[string]ThresholdOverrides{
+		"low_risk_feature":   {MaxMeanRetries: &lowMax},
+		"medium_integration": {MaxMeanRetries: &medMax},
+	}
+	report := EvaluateWithCriteria(records, c, "w")
+	if !report.Passed {
+		t.Fatalf("expected pass with per-class limits, got: %v", report.Failures)
+	}
+
+	medMax = 2.0
+	c.ClassThresholds["medium_integration"] = ThresholdOverrides{MaxMeanRetries: &medMax}
+	report = EvaluateWithCriteria(records, c, "w")
+	if report.Passed {
+		t.Fatalf("expected medium_integration override to fail")
+	}
+	if len(report.Classes) != 2 {
+		t.Fatalf("expected two class reports, got %d", len(report.Classes))
+	}
+	med := report.Classes[1]
+	if med.PipelineClass != "medium_integration" || med.Passed || med.Thresholds.MaxMeanRetries != 2.0 {
+		t.Fatalf("unexpected medium class report: %+v", med)
+	}
+	if !report.Classes[0].Passed {
+		t.Fatalf("expected low_risk_feature to pass: %v", report.Classes[0].Failures)
+	}
+	want := "mean_retries[medium_integration] 3.00 > 2.00"
+	if len(report.Failures) != 1 || report.Failures[0] != want {
+		t.Fatalf("expected %q, got %v", want, report.Failures)
+	}
+}
+
+func TestWilsonInterval(t *testing.T) {
+	got := wilsonInterval(9, 10, 0.95)
+	if math.Abs(got.Lower-59.58) > 0.01 || math.Abs(got.Upper-98.21) > 0.01 {
+		t.Fatalf("unexpected interval: %+v", got)
+	}
+	if all := wilsonInterval(10, 10, 0.95); all.Upper != 100 {
+		t.Fatalf("expected upper bound 100 for 10/10, got %+v", all)
+	}
+}
+
+func TestEvaluateWithCriteriaGatesOnLowerBound(t *testing.T) {
+	var records []EvalRecord
+	for i := 0; i < 10; i++ {
+		class := "low_risk_feature"
+		if i%2 == 1 {
+			class = "medium_integration"
+		}
+		records = append(records, EvalRecord{RunID: "r", PipelineID: "p", PipelineClass: class, ScenarioTotal: 10, ScenarioPassed: 9, FirstPassSuccess: true, Retries: 1, Decision: "approved"})
+	}
+	c := DefaultCriteria()
+
+	report := EvaluateWithCriteria(records, c, "w")
+	if !report.Passed {
+		t.Fatalf("expected point-estimate pass, got: %v", report.Failures)
+	}
+	if !report.Inconclusive || len(report.InconclusiveReasons) != 1 {
+		t.Fatalf("expected scenario pass rate to be inconclusive, got: %v", report.InconclusiveReasons)
+	}
+	if !strings.HasPrefix(report.InconclusiveReasons[0], "scenario_pass_rate 95% CI") {
+		t.Fatalf("unexpected reason: %s", report.InconclusiveReasons[0])
+	}
+
+	c.Confidence = &Confidence{GateOn: GateOnLowerBound}
+	report = EvaluateWithCriteria(records, c, "w")
+	if report.Passed {
+		t.Fatalf("expected lower-bound gate to fail")
+	}
+	if len(report.Failures) != 1 || !strings.HasPrefix(report.Failures[0], "scenario_pass_rate lower_bound ") {
+		t.Fatalf("unexpected failures: %v", report.Failures)
+	}
+}
+
+func TestMannKendall(t *testing.T) {
+	s, p := mannKendall([]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+	if s != 45 {
+		t.Fatalf("expected S=45, got %d", s)
+	}
+	if p > 0.0001 {
+		t.Fatalf("expected significant increasing trend, got p=%f", p)
+	}
+	if s, p := mannKendall([]float64{1, 1, 1, 1}); s != 0 || p != 1 {
+		t.Fatalf("expected no trend for constant series, got S=%d p=%f", s, p)
+	}
+}
+
+func TestLeastSquaresSlope(t *testing.T) {
+	slope, p := leastSquaresSlope([]float64{1, 3, 2, 4, 3, 5})
+	if math.Abs(slope-11.0/17.5) > 1e-9 {
+		t.Fatalf("expected slope 0.629, got %f", slope)
+	}
+	if math.Abs(p-0.0201) > 0.0001 {
+		t.Fatalf("expected one-sided p-value 0.0201, got %f", p)
+	}
+}
+
+func TestInterventionTrendUsesTimestampOrder(t *testing.T) {
+	var records []EvalRecord
+	for i := 0; i < 10; i++ {
+		class := "low_risk_feature"
+		if i%2 == 1 {
+			class = "medium_integration"
+		}
+		// File order decreases, but timestamps run backwards, so the
+		// chronological series is increasing.
+		records = append(records, EvalRecord{
+			RunID: "r", PipelineID: "p", PipelineClass: class,
+			ScenarioTotal: 10, ScenarioPassed: 10, FirstPassSuccess: true, Retries: 1,
+			Interventions: 10 - i, Decision: "approved",
+			Timestamp: time.Date(2026, 2, 18, 20, 0, 0, 0, time.UTC).Add(time.Duration(-i) * time.Hour).Format(time.RFC3339),
+		})
+	}
+	c := DefaultCriteria()
+	c.InterventionTrend = &TrendRule{Method: TrendMannKendall}
+	report := EvaluateWithCriteria(records, c, "w")
+	if report.Metrics.InterventionStableOrDecreasing {
+		t.Fatalf("expected increasing chronological trend")
+	}
+	if report.Metrics.InterventionTrendMethod != TrendMannKendall || report.Metrics.InterventionTrendSlope != 1 {
+		t.Fatalf("unexpected trend metrics: %+v", report.Metrics)
+	}
+}
+
+// TestInterventionTrendToleratesSingleSpike also pins the default: criteria
+// that name no method keep the v0.1 halves rule, which flips on the spike,
+// and Mann-Kendall has to be asked for.
+func TestInterventionTrendToleratesSingleSpike(t *testing.T) {
+	var records []EvalRecord
+	for i := 0; i < 10; i++ {
+		class := "low_risk_feature"
+		if i%2 == 1 {
+			class = "medium_integration"
+		}
+		interventions := 1
+		if i == 9 {
+			interventions = 3
+		}
+		records = append(records, EvalRecord{RunID: "r", PipelineID: "p", PipelineClass: class, ScenarioTotal: 10, ScenarioPassed: 10, FirstPassSuccess: true, Retries: 1, Interventions: interventions, Decision: "approved"})
+	}
+
+	report := Evaluate(records, DefaultThresholds(), "w")
+	if report.Metrics.InterventionTrendMethod != TrendHalves || report.Metrics.InterventionStableOrDecreasing || report.Passed {
+		t.Fatalf("expected the default halves rule to flip on a single spike, got %+v", report.Metrics)
+	}
+	if report.Metrics.InterventionTrendPValue != nil {
+		t.Fatalf("expected no p-value for halves method")
+	}
+
+	c := DefaultCriteria()
+	c.InterventionTrend = &TrendRule{Method: TrendMannKendall}
+	if report := EvaluateWithCriteria(records, c, "w"); !report.Metrics.InterventionStableOrDecreasing {
+		t.Fatalf("expected Mann-Kendall to tolerate a single spike, p=%v", *report.Metrics.InterventionTrendPValue)
+	}
+}
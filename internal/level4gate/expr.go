@@ -0,0 +1,640 @@
+package level4gate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Rule severities. A block rule that does not hold fails the gate; a warn
+// rule is reported in GateReport.Warnings only.
+const (
+	RuleBlock = FindingBlock
+	RuleWarn  = FindingWarn
+)
+
+// ExprRule is a gate rule declared in criteria. Expr must evaluate to a
+// boolean and states the condition that has to hold, for example
+// "first_pass_rate_percent - scenario_pass_rate_percent < 10".
+//
+// The language has number and boolean literals, metric names, + - * /,
+// comparisons (< <= > >= == !=), && || ! and parentheses. A metric name
+// followed by [class] reads that pipeline class's metrics, as in
+// "mean_retries[medium_integration] <= 1.5". See MetricNames for the
+// available names. Evaluation is pure and deterministic; a metric that is
+// absent (a class with no runs, a window without economics) or a division
+// by zero makes the rule not measurable, which is reported under the rule's
+// severity.
+//
+// Criteria loaded with LoadCriteria or DecodeCriteria carry each rule's
+// compiled expression; rules built in code are compiled when evaluated.
+type ExprRule struct {
+	Name     string `json:"name"`
+	Expr     string `json:"expr"`
+	Severity string `json:"severity"`
+	Message  string `json:"message,omitempty"`
+
+	compiled exprNode
+}
+
+type exprValue struct {
+	num    float64
+	b      bool
+	isBool bool
+}
+
+// metricVars maps rule variable names to Metrics fields. The second result
+// is false when the value is absent for this window.
+var metricVars = map[string]func(m Metrics) (exprValue, bool){
+	"run_count":                       numVar(func(m Metrics) float64 { return float64(m.RunCount) }),
+	"scenario_pass_rate_percent":      numVar(func(m Metrics) float64 { return m.ScenarioPassRatePercent }),
+	"first_pass_rate_percent":         numVar(func(m Metrics) float64 { return m.FirstPassRatePercent }),
+	"mean_retries":                    numVar(func(m Metrics) float64 { return m.MeanRetries }),
+	"intervention_avg_first_half":     numVar(func(m Metrics) float64 { return m.InterventionAvgFirstHalf }),
+	"intervention_avg_second_half":    numVar(func(m Metrics) float64 { return m.InterventionAvgSecondHalf }),
+	"intervention_trend_slope":        numVar(func(m Metrics) float64 { return m.InterventionTrendSlope }),
+	"decision_reversal_percent":       numVar(func(m Metrics) float64 { return m.DecisionReversalPercent }),
+	"approved_run_critical_incidents": numVar(func(m Metrics) float64 { return float64(m.ApprovedRunCriticalIncidents) }),
+	"scenario_pass_rate_ci_lower":     numVar(func(m Metrics) float64 { return m.ScenarioPassRateCI.Lower }),
+	"scenario_pass_rate_ci_upper":     numVar(func(m Metrics) float64 { return m.ScenarioPassRateCI.Upper }),
+	"first_pass_rate_ci_lower":        numVar(func(m Metrics) float64 { return m.FirstPassRateCI.Lower }),
+	"first_pass_rate_ci_upper":        numVar(func(m Metrics) float64 { return m.FirstPassRateCI.Upper }),
+	"decision_reversal_ci_lower":      numVar(func(m Metrics) float64 { return m.DecisionReversalCI.Lower }),
+	"decision_reversal_ci_upper":      numVar(func(m Metrics) float64 { return m.DecisionReversalCI.Upper }),
+	"intervention_stable_or_decreasing": func(m Metrics) (exprValue, bool) {
+		return exprValue{b: m.InterventionStableOrDecreasing, isBool: true}, true
+	},
+	"intervention_trend_p_value": func(m Metrics) (exprValue, bool) {
+		if m.InterventionTrendPValue == nil {
+			return exprValue{}, false
+		}
+		return exprValue{num: *m.InterventionTrendPValue}, true
+	},
+	"cost_per_approved_run_usd": func(m Metrics) (exprValue, bool) {
+		if m.Economics == nil || m.Economics.CostPerApprovedRunUSD == nil {
+			return exprValue{}, false
+		}
+		return exprValue{num: *m.Economics.CostPerApprovedRunUSD}, true
+	},
+	"tokens_in_mean":              economicVar(func(e *EconomicMetrics) Summary { return e.TokensIn }, false),
+	"tokens_out_mean":             economicVar(func(e *EconomicMetrics) Summary { return e.TokensOut }, false),
+	"cost_usd_mean":               economicVar(func(e *EconomicMetrics) Summary { return e.CostUSD }, false),
+	"cost_usd_p95":                economicVar(func(e *EconomicMetrics) Summary { return e.CostUSD }, true),
+	"duration_seconds_mean":       economicVar(func(e *EconomicMetrics) Summary { return e.DurationSeconds }, false),
+	"duration_seconds_p95":        economicVar(func(e *EconomicMetrics) Summary { return e.DurationSeconds }, true),
+	"approved_reversal_percent":   reversalVar(func(r *ReversalMetrics) (float64, bool) { return r.ApprovedReversalPercent, r.ApprovedRuns > 0 }),
+	"rejected_reversal_percent":   reversalVar(func(r *ReversalMetrics) (float64, bool) { return r.RejectedReversalPercent, r.RejectedRuns > 0 }),
+	"reversal_latency_mean_hours": reversalVar(func(r *ReversalMetrics) (float64, bool) { return r.LatencyHours.Mean, r.LatencyHours.Count > 0 }),
+	"reversal_latency_p95_hours":  reversalVar(func(r *ReversalMetrics) (float64, bool) { return r.LatencyHours.P95, r.LatencyHours.Count > 0 }),
+	"incidents_sev1":              incidentVar(func(i *IncidentMetrics) (float64, bool) { return float64(i.BySeverity[IncidentSev1]), true }),
+	"incidents_sev2":              incidentVar(func(i *IncidentMetrics) (float64, bool) { return float64(i.BySeverity[IncidentSev2]), true }),
+	"incidents_sev3":              incidentVar(func(i *IncidentMetrics) (float64, bool) { return float64(i.BySeverity[IncidentSev3]), true }),
+	"incidents_sev4":              incidentVar(func(i *IncidentMetrics) (float64, bool) { return float64(i.BySeverity[IncidentSev4]), true }),
+	"mean_time_to_detect_hours": incidentVar(func(i *IncidentMetrics) (float64, bool) {
+		return i.TimeToDetectHours.Mean, i.TimeToDetectHours.Count > 0
+	}),
+	"mean_time_to_mitigate_minutes": incidentVar(func(i *IncidentMetrics) (float64, bool) {
+		return i.TimeToMitigateMinutes.Mean, i.TimeToMitigateMinutes.Count > 0
+	}),
+	"remediation_share_percent": func(m Metrics) (exprValue, bool) {
+		if m.Remediation == nil {
+			return exprValue{}, false
+		}
+		return exprValue{num: m.Remediation.SharePercent}, true
+	},
+	"weighted_scenario_pass_rate_percent": func(m Metrics) (exprValue, bool) {
+		if m.Scenarios == nil {
+			return exprValue{}, false
+		}
+		return exprValue{num: m.Scenarios.WeightedPassRatePercent}, true
+	},
+}
+
+func numVar(f func(Metrics) float64) func(Metrics) (exprValue, bool) {
+	return func(m Metrics) (exprValue, bool) { return exprValue{num: f(m)}, true }
+}
+
+func economicVar(f func(*EconomicMetrics) Summary, p95 bool) func(Metrics) (exprValue, bool) {
+	return func(m Metrics) (exprValue, bool) {
+		if m.Economics == nil {
+			return exprValue{}, false
+		}
+		s := f(m.Economics)
+		if s.Count == 0 {
+			return exprValue{}, false
+		}
+		if p95 {
+			return exprValue{num: s.P95}, true
+		}
+		return exprValue{num: s.Mean}, true
+	}
+}
+
+// reversalVar reads a reversal metric. It is absent when the window was
+// evaluated without a reversal stream or has no runs it applies to.
+func reversalVar(f func(*ReversalMetrics) (float64, bool)) func(Metrics) (exprValue, bool) {
+	return func(m Metrics) (exprValue, bool) {
+		if m.Reversals == nil {
+			return exprValue{}, false
+		}
+		v, ok := f(m.Reversals)
+		return exprValue{num: v}, ok
+	}
+}
+
+// incidentVar reads an incident metric. It is absent when the window was
+// evaluated without an incident stream.
+func incidentVar(f func(*IncidentMetrics) (float64, bool)) func(Metrics) (exprValue, bool) {
+	return func(m Metrics) (exprValue, bool) {
+		if m.Incidents == nil {
+			return exprValue{}, false
+		}
+		v, ok := f(m.Incidents)
+		return exprValue{num: v}, ok
+	}
+}
+
+// MetricNames returns the variable names rule expressions can use.
+func MetricNames() []string {
+	out := make([]string, 0, len(metricVars))
+	for k := range metricVars {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// exprEnv is what a compiled rule reads: the window metrics and the metrics
+// of each pipeline class present.
+type exprEnv struct {
+	window  Metrics
+	classes map[string]Metrics
+}
+
+var errNotMeasurable = errors.New("not measurable")
+
+type exprNode interface {
+	eval(env exprEnv) (exprValue, error)
+	isBool() bool
+}
+
+type numLit float64
+
+func (n numLit) eval(exprEnv) (exprValue, error) { return exprValue{num: float64(n)}, nil }
+func (numLit) isBool() bool                      { return false }
+
+type boolLit bool
+
+func (b boolLit) eval(exprEnv) (exprValue, error) { return exprValue{b: bool(b), isBool: true}, nil }
+func (boolLit) isBool() bool                      { return true }
+
+type varRef struct {
+	name    string
+	class   string
+	get     func(Metrics) (exprValue, bool)
+	boolean bool
+}
+
+func (v varRef) eval(env exprEnv) (exprValue, error) {
+	m := env.window
+	if v.class != "" {
+		cm, ok := env.classes[v.class]
+		if !ok {
+			return exprValue{}, fmt.Errorf("%w: no runs for pipeline_class %q", errNotMeasurable, v.class)
+		}
+		m = cm
+	}
+	out, ok := v.get(m)
+	if !ok {
+		return exprValue{}, fmt.Errorf("%w: %s is absent", errNotMeasurable, v.name)
+	}
+	return out, nil
+}
+func (v varRef) isBool() bool { return v.boolean }
+
+type unaryOp struct {
+	op string
+	x  exprNode
+}
+
+func (u unaryOp) eval(env exprEnv) (exprValue, error) {
+	x, err := u.x.eval(env)
+	if err != nil {
+		return exprValue{}, err
+	}
+	if u.op == "!" {
+		return exprValue{b: !x.b, isBool: true}, nil
+	}
+	return exprValue{num: -x.num}, nil
+}
+func (u unaryOp) isBool() bool { return u.op == "!" }
+
+type binaryOp struct {
+	op   string
+	l, r exprNode
+}
+
+func (b binaryOp) eval(env exprEnv) (exprValue, error) {
+	l, err := b.l.eval(env)
+	if err != nil {
+		return exprValue{}, err
+	}
+	// && and || short-circuit, so a guard on the left can keep an absent
+	// metric on the right from being read.
+	switch b.op {
+	case "&&":
+		if !l.b {
+			return exprValue{isBool: true}, nil
+		}
+		return b.r.eval(env)
+	case "||":
+		if l.b {
+			return exprValue{b: true, isBool: true}, nil
+		}
+		return b.r.eval(env)
+	}
+	r, err := b.r.eval(env)
+	if err != nil {
+		return exprValue{}, err
+	}
+	switch b.op {
+	case "+":
+		return exprValue{num: l.num + r.num}, nil
+	case "-":
+		return exprValue{num: l.num - r.num}, nil
+	case "*":
+		return exprValue{num: l.num * r.num}, nil
+	case "/":
+		if r.num == 0 {
+			return exprValue{}, fmt.Errorf("%w: division by zero", errNotMeasurable)
+		}
+		return exprValue{num: l.num / r.num}, nil
+	case "<":
+		return exprValue{b: l.num < r.num, isBool: true}, nil
+	case "<=":
+		return exprValue{b: l.num <= r.num, isBool: true}, nil
+	case ">":
+		return exprValue{b: l.num > r.num, isBool: true}, nil
+	case ">=":
+		return exprValue{b: l.num >= r.num, isBool: true}, nil
+	case "==":
+		if l.isBool {
+			return exprValue{b: l.b == r.b, isBool: true}, nil
+		}
+		return exprValue{b: l.num == r.num, isBool: true}, nil
+	case "!=":
+		if l.isBool {
+			return exprValue{b: l.b != r.b, isBool: true}, nil
+		}
+		return exprValue{b: l.num != r.num, isBool: true}, nil
+	}
+	return exprValue{}, fmt.Errorf("unknown operator %q", b.op)
+}
+
+func (b binaryOp) isBool() bool {
+	switch b.op {
+	case "+", "-", "*", "/":
+		return false
+	}
+	return true
+}
+
+// compileExpr parses src and type-checks it. The result must be boolean.
+func compileExpr(src string) (exprNode, error) {
+	toks, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{toks: toks}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.toks[p.pos].text, p.toks[p.pos].pos)
+	}
+	if !n.isBool() {
+		return nil, errors.New("expression must be a comparison or boolean")
+	}
+	return n, nil
+}
+
+type exprToken struct {
+	text string
+	kind byte // 'n' number, 'i' identifier, 'o' operator or punctuation
+	pos  int
+}
+
+func tokenizeExpr(src string) ([]exprToken, error) {
+	var toks []exprToken
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			j := i
+			for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.') {
+				j++
+			}
+			toks = append(toks, exprToken{text: src[i:j], kind: 'n', pos: i})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(src) && (unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j])) || src[j] == '_') {
+				j++
+			}
+			toks = append(toks, exprToken{text: src[i:j], kind: 'i', pos: i})
+			i = j
+		default:
+			if i+1 < len(src) {
+				switch two := src[i : i+2]; two {
+				case "<=", ">=", "==", "!=", "&&", "||":
+					toks = append(toks, exprToken{text: two, kind: 'o', pos: i})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("+-*/<>!()[]", c) {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+			toks = append(toks, exprToken{text: string(c), kind: 'o', pos: i})
+			i++
+		}
+	}
+	return toks, nil
+}
+
+type exprParser struct {
+	toks []exprToken
+	pos  int
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.toks) && p.toks[p.pos].kind == 'o' {
+		return p.toks[p.pos].text
+	}
+	return ""
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.parseLogical("||", p.parseAnd)
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseLogical("&&", p.parseNot)
+}
+
+func (p *exprParser) parseLogical(op string, next func() (exprNode, error)) (exprNode, error) {
+	l, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == op {
+		p.pos++
+		r, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if !l.isBool() || !r.isBool() {
+			return nil, fmt.Errorf("%s needs boolean operands", op)
+		}
+		l = binaryOp{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if p.peek() == "!" {
+		p.pos++
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if !x.isBool() {
+			return nil, errors.New("! needs a boolean operand")
+		}
+		return unaryOp{op: "!", x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	l, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "<", "<=", ">", ">=", "==", "!=":
+		p.pos++
+		r, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if l.isBool() != r.isBool() {
+			return nil, fmt.Errorf("%s compares a boolean with a number", op)
+		}
+		if l.isBool() && op != "==" && op != "!=" {
+			return nil, fmt.Errorf("%s needs numeric operands", op)
+		}
+		return binaryOp{op: op, l: l, r: r}, nil
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	return p.parseArithmetic([]string{"+", "-"}, p.parseMultiplicative)
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	return p.parseArithmetic([]string{"*", "/"}, p.parseUnary)
+}
+
+func (p *exprParser) parseArithmetic(ops []string, next func() (exprNode, error)) (exprNode, error) {
+	l, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op == "" || (op != ops[0] && op != ops[1]) {
+			return l, nil
+		}
+		p.pos++
+		r, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if l.isBool() || r.isBool() {
+			return nil, fmt.Errorf("%s needs numeric operands", op)
+		}
+		l = binaryOp{op: op, l: l, r: r}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.peek() == "-" {
+		p.pos++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if x.isBool() {
+			return nil, errors.New("- needs a numeric operand")
+		}
+		return unaryOp{op: "-", x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.pos >= len(p.toks) {
+		return nil, errors.New("unexpected end of expression")
+	}
+	t := p.toks[p.pos]
+	p.pos++
+	switch t.kind {
+	case 'n':
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at offset %d", t.text, t.pos)
+		}
+		return numLit(v), nil
+	case 'i':
+		switch t.text {
+		case "true":
+			return boolLit(true), nil
+		case "false":
+			return boolLit(false), nil
+		}
+		return p.parseVar(t)
+	}
+	if t.text == "(" {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing ) for ( at offset %d", t.pos)
+		}
+		p.pos++
+		return n, nil
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+}
+
+func (p *exprParser) parseVar(t exprToken) (exprNode, error) {
+	get, ok := metricVars[t.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q at offset %d", t.text, t.pos)
+	}
+	probe, _ := get(Metrics{})
+	v := varRef{name: t.text, get: get, boolean: probe.isBool}
+	if p.peek() == "[" {
+		p.pos++
+		if p.pos >= len(p.toks) || p.toks[p.pos].kind != 'i' {
+			return nil, fmt.Errorf("expected pipeline class name after %s[", t.text)
+		}
+		v.class = p.toks[p.pos].text
+		v.name = fmt.Sprintf("%s[%s]", t.text, v.class)
+		p.pos++
+		if p.peek() != "]" {
+			return nil, fmt.Errorf("missing ] after %s", v.name)
+		}
+		p.pos++
+	}
+	return v, nil
+}
+
+// classRefs returns the pipeline classes n reads.
+func classRefs(n exprNode) []string {
+	switch x := n.(type) {
+	case varRef:
+		if x.class != "" {
+			return []string{x.class}
+		}
+	case unaryOp:
+		return classRefs(x.x)
+	case binaryOp:
+		return append(classRefs(x.l), classRefs(x.r)...)
+	}
+	return nil
+}
+
+// evaluateRules checks every rule against the window and class metrics and
+// returns one finding per rule, identified as rule[name]. A rule that holds
+// is info; one that is violated or cannot be measured takes the rule's
+// severity.
+func evaluateRules(rules []ExprRule, m Metrics, classes []ClassReport) []Finding {
+	env := exprEnv{window: m, classes: make(map[string]Metrics, len(classes))}
+	for _, cr := range classes {
+		env.classes[cr.PipelineClass] = cr.Metrics
+	}
+	findings := make([]Finding, 0, len(rules))
+	for _, rule := range rules {
+		findings = append(findings, ruleFinding(rule, env))
+	}
+	return findings
+}
+
+func ruleFinding(rule ExprRule, env exprEnv) Finding {
+	f := Finding{RuleID: fmt.Sprintf("rule[%s]", rule.Name), Severity: rule.Severity}
+	n := rule.compiled
+	if n == nil {
+		var err error
+		if n, err = compileExpr(rule.Expr); err != nil {
+			f.Message = fmt.Sprintf("%s invalid expression: %v", f.RuleID, err)
+			return f
+		}
+	}
+	v, err := n.eval(env)
+	switch {
+	case err != nil:
+		f.Message = fmt.Sprintf("%s %v (%s)", f.RuleID, err, rule.Expr)
+	case v.b:
+		f.Severity = FindingInfo
+		f.Message = fmt.Sprintf("%s holds (%s)", f.RuleID, rule.Expr)
+	case rule.Message != "":
+		f.Message = fmt.Sprintf("%s %s (%s)", f.RuleID, rule.Message, rule.Expr)
+	default:
+		f.Message = fmt.Sprintf("%s violated (%s)", f.RuleID, rule.Expr)
+	}
+	return f
+}
+
+// compileRules validates rules and returns a copy of them with each
+// expression compiled. rules itself is not modified.
+func compileRules(rules []ExprRule, classes map[string]PipelineClass) ([]ExprRule, error) {
+	if rules == nil {
+		return nil, nil
+	}
+	out := make([]ExprRule, len(rules))
+	seen := map[string]bool{}
+	for i, rule := range rules {
+		if strings.TrimSpace(rule.Name) == "" {
+			return nil, fmt.Errorf("rules[%d]: name is required", i)
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("rules[%d]: duplicate name %q", i, rule.Name)
+		}
+		seen[rule.Name] = true
+		if rule.Severity != RuleBlock && rule.Severity != RuleWarn {
+			return nil, fmt.Errorf("rules[%s]: severity must be %s|%s", rule.Name, RuleBlock, RuleWarn)
+		}
+		n, err := compileExpr(rule.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("rules[%s]: %v", rule.Name, err)
+		}
+		for _, class := range classRefs(n) {
+			if _, ok := classes[class]; !ok {
+				return nil, fmt.Errorf("rules[%s]: undeclared pipeline_class %q", rule.Name, class)
+			}
+		}
+		rule.compiled = n
+		out[i] = rule
+	}
+	return out, nil
+}
@@ -0,0 +1,96 @@
+package level4gate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompileExprRejectsInvalidExpressions(t *testing.T) {
+	cases := map[string]string{
+		"first_pass_rate_percent - scenario_pass_rate_percent": "must be a comparison or boolean",
+		"mean_retry < 2":                        `unknown metric "mean_retry"`,
+		"mean_retries < 2 &&":                   "unexpected end of expression",
+		"(mean_retries < 2":                     "missing )",
+		"intervention_stable_or_decreasing < 1": "compares a boolean with a number",
+		"mean_retries < 2; true":                `unexpected character ';'`,
+	}
+	for src, want := range cases {
+		_, err := compileExpr(src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("compileExpr(%q) error = %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestEvaluateWithCriteriaAppliesExprRules(t *testing.T) {
+	records := scenarioRecords()
+	records[0].FirstPassSuccess = false
+	c := DefaultCriteria()
+	c.Rules = []ExprRule{
+		{Name: "first-pass-gap", Expr: "first_pass_rate_percent - scenario_pass_rate_percent < 10", Severity: RuleBlock},
+		{Name: "medium-retries", Expr: "mean_retries[medium_integration] <= 0.5", Severity: RuleWarn, Message: "medium integration retries creeping up"},
+		{Name: "cost", Expr: "run_count < 100 || cost_per_approved_run_usd < 1", Severity: RuleBlock},
+		{Name: "economics", Expr: "cost_per_approved_run_usd < 1", Severity: RuleWarn},
+		{Name: "precedence", Expr: "!(1 + 2 * 3 != 7) && -mean_retries < 0", Severity: RuleBlock},
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	report := EvaluateWithCriteria(records, c, "w")
+	if !report.Passed {
+		t.Fatalf("expected block rules to hold, got %v", report.Failures)
+	}
+	wantWarnings := []string{
+		"rule[medium-retries] medium integration retries creeping up (mean_retries[medium_integration] <= 0.5)",
+		"rule[economics] not measurable: cost_per_approved_run_usd is absent (cost_per_approved_run_usd < 1)",
+	}
+	if strings.Join(report.Warnings, "\n") != strings.Join(wantWarnings, "\n") {
+		t.Fatalf("unexpected warnings: %v", report.Warnings)
+	}
+
+	c.Rules[0].Expr = "first_pass_rate_percent - scenario_pass_rate_percent < -10"
+	report = EvaluateWithCriteria(records, c, "w")
+	want := "rule[first-pass-gap] violated (first_pass_rate_percent - scenario_pass_rate_percent < -10)"
+	if report.Passed || len(report.Failures) != 1 || report.Failures[0] != want {
+		t.Fatalf("expected %q, got %v", want, report.Failures)
+	}
+}
+
+func TestValidateRulesChecksClassesAndSeverity(t *testing.T) {
+	c := DefaultCriteria()
+	c.Rules = []ExprRule{{Name: "r", Expr: "mean_retries[infra_change] < 1", Severity: RuleBlock}}
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), `undeclared pipeline_class "infra_change"`) {
+		t.Fatalf("expected undeclared class error, got %v", err)
+	}
+	c.Rules = []ExprRule{{Name: "r", Expr: "mean_retries < 1", Severity: "fatal"}}
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "severity must be block|warn") {
+		t.Fatalf("expected severity error, got %v", err)
+	}
+}
+
+func TestDecodeCriteriaCompilesRulesOnce(t *testing.T) {
+	in := `{"version":"v","min_runs":1,"thresholds":{"min_scenario_pass_rate_percent":0,"min_first_pass_rate_percent":0,"max_mean_retries":5,"max_decision_reversal_percent":100,"max_approved_incidents":0},"required_class_minimum":{},"rules":[{"name":"retries","expr":"mean_retries < 1","severity":"block"}]}`
+	c, err := DecodeCriteria(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("DecodeCriteria failed: %v", err)
+	}
+	if c.Rules[0].compiled == nil {
+		t.Fatalf("expected the rule to be compiled when decoded")
+	}
+	// Reports evaluate the cached form; the source is only quoted.
+	c.Rules[0].Expr = "not parsed again"
+	report := EvaluateWithCriteria(scenarioRecords(), c, "w")
+	if !containsString(report.Failures, "rule[retries] violated (not parsed again)") {
+		t.Fatalf("expected the compiled rule to be evaluated, got %v", report.Failures)
+	}
+
+	built := DefaultCriteria()
+	built.Rules = []ExprRule{{Name: "retries", Expr: "mean_retries <= 1", Severity: RuleBlock}}
+	if err := built.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if built.Rules[0].compiled != nil {
+		t.Fatalf("expected Validate to leave the caller's rules alone")
+	}
+}
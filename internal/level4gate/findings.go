@@ -0,0 +1,184 @@
+package level4gate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Finding severities. Block findings fail the gate, warn findings are
+// reported without failing it, and info findings record rules that held.
+const (
+	FindingBlock = "block"
+	FindingWarn  = "warn"
+	FindingInfo  = "info"
+)
+
+// Finding is the outcome of one gate rule.
+//
+// RuleID is stable across windows and criteria edits: the metric name
+// (first_pass_rate, failed_scenarios_major), labelled name[class] for class
+// thresholds, or rule[name] for expression rules. Observed, Threshold and
+// Margin are set for numeric rules that could be measured, with Comparison
+// the condition that must hold (">=" for floors, "<=" for ceilings). Margin
+// is the distance from the threshold on the passing side, so it is negative
+// when the rule is violated.
+type Finding struct {
+	RuleID     string   `json:"rule_id"`
+	Severity   string   `json:"severity"`
+	Message    string   `json:"message"`
+	Observed   *float64 `json:"observed,omitempty"`
+	Threshold  *float64 `json:"threshold,omitempty"`
+	Comparison string   `json:"comparison,omitempty"`
+	Margin     *float64 `json:"margin,omitempty"`
+}
+
+// limit is a numeric threshold check. Floors require observed >= threshold
+// and ceilings observed <= threshold.
+type limit struct {
+	id string
+	// label prefixes the message. It differs from id when a floor gates on
+	// the confidence interval's lower bound.
+	label     string
+	observed  float64
+	threshold float64
+	floor     bool
+	integer   bool
+}
+
+func (l limit) finding() Finding {
+	margin := l.threshold - l.observed
+	op, failOp := "<=", ">"
+	if l.floor {
+		margin = l.observed - l.threshold
+		op, failOp = ">=", "<"
+	}
+	comparison := op
+	severity := FindingInfo
+	if margin < 0 {
+		severity = FindingBlock
+		op = failOp
+	}
+	label := l.label
+	if label == "" {
+		label = l.id
+	}
+	msg := fmt.Sprintf("%s %.2f %s %.2f", label, l.observed, op, l.threshold)
+	if l.integer {
+		msg = fmt.Sprintf("%s %d %s %d", label, int(l.observed), op, int(l.threshold))
+	}
+	observed, threshold := l.observed, l.threshold
+	return Finding{
+		RuleID:     l.id,
+		Severity:   severity,
+		Message:    msg,
+		Observed:   &observed,
+		Threshold:  &threshold,
+		Comparison: comparison,
+		Margin:     &margin,
+	}
+}
+
+// notMeasurable is the block finding for a rule whose data is missing.
+func notMeasurable(id string, format string, args ...any) Finding {
+	return Finding{
+		RuleID:   id,
+		Severity: FindingBlock,
+		Message:  fmt.Sprintf("%s not measurable: %s", id, fmt.Sprintf(format, args...)),
+	}
+}
+
+// applyWarnBands downgrades passing findings whose margin is within the
+// band configured for their rule to warn. A band keyed by the full rule ID
+// (first_pass_rate[medium_integration]) takes precedence over one keyed by
+// the metric name, which applies to the window and every class.
+func applyWarnBands(findings []Finding, bands map[string]float64) {
+	if len(bands) == 0 {
+		return
+	}
+	for i := range findings {
+		f := &findings[i]
+		if f.Severity != FindingInfo || f.Margin == nil {
+			continue
+		}
+		band, ok := bands[f.RuleID]
+		if !ok {
+			band, ok = bands[baseRuleID(f.RuleID)]
+		}
+		if ok && *f.Margin <= band {
+			f.Severity = FindingWarn
+			f.Message = fmt.Sprintf("%s (within %.2f of threshold)", f.Message, band)
+		}
+	}
+}
+
+// findingMessages returns the messages of findings with the given severity,
+// or nil when there are none.
+func findingMessages(findings []Finding, severity string) []string {
+	var out []string
+	for _, f := range findings {
+		if f.Severity == severity {
+			out = append(out, f.Message)
+		}
+	}
+	return out
+}
+
+// baseRuleID strips a [class] suffix from a rule ID.
+func baseRuleID(id string) string {
+	if i := strings.IndexByte(id, '['); i > 0 {
+		return id[:i]
+	}
+	return id
+}
+
+// bandableRules lists the rule IDs warn_bands can refer to, without class
+// labels.
+func bandableRules() map[string]bool {
+	out := map[string]bool{
+		"run_count":                       true,
+		"run_count_by_class":              true,
+		"scenario_pass_rate":              true,
+		"first_pass_rate":                 true,
+		"mean_retries":                    true,
+		"decision_reversal_rate":          true,
+		"approved_run_critical_incidents": true,
+		"cost_per_approved_run_usd":       true,
+		"p95_duration_seconds":            true,
+		"weighted_scenario_pass_rate":     true,
+		"remediation_share":               true,
+	}
+	for _, c := range scenarioCategories {
+		out[c+"_scenario_pass_rate"] = true
+	}
+	for _, s := range scenarioSeverities {
+		out["failed_scenarios_"+s] = true
+	}
+	for _, s := range incidentSeverities {
+		out["incidents_"+s] = true
+	}
+	return out
+}
+
+func validateWarnBands(bands map[string]float64, classes map[string]PipelineClass) error {
+	known := bandableRules()
+	for _, id := range sortedFloatKeys(bands) {
+		if bands[id] < 0 {
+			return fmt.Errorf("warn_bands[%s] cannot be negative", id)
+		}
+		base := baseRuleID(id)
+		if !known[base] {
+			return fmt.Errorf("warn_bands[%s]: unknown rule %q", id, base)
+		}
+		if base == id {
+			continue
+		}
+		class := strings.TrimSuffix(strings.TrimPrefix(id, base+"["), "]")
+		if !strings.HasSuffix(id, "]") {
+			return fmt.Errorf("warn_bands[%s]: malformed rule id", id)
+		}
+		if _, ok := classes[class]; !ok {
+			return fmt.Errorf("warn_bands[%s]: undeclared pipeline_class %q", id, class)
+		}
+	}
+	return nil
+}
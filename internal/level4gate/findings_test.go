@@ -0,0 +1,104 @@
+package level4gate
+
+import (
+	"strings"
+	"testing"
+)
+
+func findingByID(t *testing.T, report GateReport, id string) Finding {
+	t.Helper()
+	for _, f := range report.Findings {
+		if f.RuleID == id {
+			return f
+		}
+	}
+	t.Fatalf("no finding %q in %+v", id, report.Findings)
+	return Finding{}
+}
+
+func TestReportFindingsCarryObservedThresholdAndMargin(t *testing.T) {
+	c := DefaultCriteria()
+	report := EvaluateWithCriteria(scenarioRecords(), c, "w")
+	if !report.Passed || report.Warnings != nil {
+		t.Fatalf("expected clean pass, got failures=%v warnings=%v", report.Failures, report.Warnings)
+	}
+	f := findingByID(t, report, "first_pass_rate")
+	if f.Severity != FindingInfo || *f.Observed != 100 || *f.Threshold != c.Thresholds.MinFirstPassRatePercent || *f.Margin != 100-c.Thresholds.MinFirstPassRatePercent {
+		t.Fatalf("unexpected first_pass_rate finding: %+v", f)
+	}
+
+	c.WarnBands = map[string]float64{"mean_retries": 1}
+	report = EvaluateWithCriteria(scenarioRecords(), c, "w")
+	want := "mean_retries 1.00 <= 2.00 (within 1.00 of threshold)"
+	if !report.Passed || len(report.Warnings) != 1 || report.Warnings[0] != want {
+		t.Fatalf("expected warning %q, got passed=%v warnings=%v", want, report.Passed, report.Warnings)
+	}
+	if f := findingByID(t, report, "mean_retries"); f.Severity != FindingWarn || *f.Margin != 1 {
+		t.Fatalf("unexpected mean_retries finding: %+v", f)
+	}
+
+	c.Thresholds.MaxMeanRetries = 0.5
+	report = EvaluateWithCriteria(scenarioRecords(), c, "w")
+	if report.Passed || strings.Join(report.Failures, "\n") != "mean_retries 1.00 > 0.50" {
+		t.Fatalf("expected mean_retries failure, got %v", report.Failures)
+	}
+	if f := findingByID(t, report, "mean_retries"); f.Severity != FindingBlock || *f.Margin != -0.5 {
+		t.Fatalf("unexpected mean_retries finding: %+v", f)
+	}
+}
+
+func TestWarnBandsPreferFullRuleID(t *testing.T) {
+	c := DefaultCriteria()
+	c.ClassThresholds = map[string]ThresholdOverrides{"medium_integration": {}}
+	c.WarnBands = map[string]float64{"mean_retries": 0.5, "mean_retries[medium_integration]": 1}
+	report := EvaluateWithCriteria(scenarioRecords(), c, "w")
+	if f := findingByID(t, report, "mean_retries"); f.Severity != FindingInfo {
+		t.Fatalf("window band 0.5 should not cover margin 1: %+v", f)
+	}
+	if f := findingByID(t, report, "mean_retries[medium_integration]"); f.Severity != FindingWarn {
+		t.Fatalf("class band should cover margin 1: %+v", f)
+	}
+}
+
+func TestValidateWarnBands(t *testing.T) {
+	cases := map[string]string{
+		"first_pass":                               `unknown rule "first_pass"`,
+		"mean_retries[infra_change]":               `undeclared pipeline_class "infra_change"`,
+		"mean_retries[medium_integration":          "malformed rule id",
+		"failed_scenarios_major[low_risk_feature]": "",
+	}
+	for id, want := range cases {
+		c := DefaultCriteria()
+		c.WarnBands = map[string]float64{id: 1}
+		err := c.Validate()
+		if want == "" {
+			if err != nil {
+				t.Fatalf("warn_bands[%s]: unexpected error %v", id, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("warn_bands[%s]: error = %v, want %q", id, err, want)
+		}
+	}
+	c := DefaultCriteria()
+	c.WarnBands = map[string]float64{"mean_retries": -1}
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "cannot be negative") {
+		t.Fatalf("expected negative band error, got %v", err)
+	}
+}
+
+func TestDiffMatchesFindingsByRuleID(t *testing.T) {
+	c := DefaultCriteria()
+	c.Thresholds.MinFirstPassRatePercent = 101
+	before := EvaluateWithCriteria(scenarioRecords(), c, "before")
+	c.Confidence = &Confidence{Level: 0.95, GateOn: GateOnLowerBound}
+	after := EvaluateWithCriteria(scenarioRecords(), c, "after")
+	if before.Failures[0] == after.Failures[0] {
+		t.Fatalf("expected differently worded failures, got %q", before.Failures[0])
+	}
+	d := Diff(before, after)
+	if len(d.FailuresGained) != 0 || len(d.FailuresLost) != 0 {
+		t.Fatalf("expected first_pass_rate to match by rule ID, got gained=%v lost=%v", d.FailuresGained, d.FailuresLost)
+	}
+}
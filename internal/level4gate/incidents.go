@@ -0,0 +1,331 @@
+package level4gate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Incident severities, most to least serious. A sev1 incident linked to an
+// approved run counts as a critical incident.
+const (
+	IncidentSev1 = "sev1"
+	IncidentSev2 = "sev2"
+	IncidentSev3 = "sev3"
+	IncidentSev4 = "sev4"
+)
+
+var incidentSeverities = []string{IncidentSev1, IncidentSev2, IncidentSev3, IncidentSev4}
+
+// Incident is one production incident attributed to the runs that caused
+// it. Incidents live in their own NDJSON stream and are joined to records
+// on (window_id, run_id), like reversal events. TimeToMitigateMinutes is
+// nil while the incident is open.
+type Incident struct {
+	IncidentID            string   `json:"incident_id"`
+	WindowID              string   `json:"window_id"`
+	RunIDs                []string `json:"run_ids"`
+	Severity              string   `json:"severity"`
+	DetectedAt            string   `json:"detected_at"`
+	TimeToMitigateMinutes *float64 `json:"time_to_mitigate_minutes,omitempty"`
+	RootCause             string   `json:"root_cause"`
+}
+
+func validateIncident(inc Incident) error {
+	if inc.IncidentID == "" {
+		return errors.New("incident_id is required")
+	}
+	if inc.WindowID == "" {
+		return errors.New("window_id is required")
+	}
+	if len(inc.RunIDs) == 0 {
+		return errors.New("run_ids needs at least one run")
+	}
+	for _, id := range inc.RunIDs {
+		if id == "" {
+			return errors.New("run_ids cannot contain an empty run_id")
+		}
+	}
+	if !isIncidentSeverity(inc.Severity) {
+		return fmt.Errorf("severity must be %s", strings.Join(incidentSeverities, "|"))
+	}
+	if _, err := time.Parse(time.RFC3339, inc.DetectedAt); err != nil {
+		return fmt.Errorf("detected_at must be RFC3339: %w", err)
+	}
+	if inc.TimeToMitigateMinutes != nil && *inc.TimeToMitigateMinutes < 0 {
+		return errors.New("time_to_mitigate_minutes cannot be negative")
+	}
+	if inc.RootCause == "" {
+		return errors.New("root_cause is required")
+	}
+	return nil
+}
+
+func isIncidentSeverity(s string) bool {
+	for _, v := range incidentSeverities {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// IncidentLog indexes incidents by linked run. A nil *IncidentLog is an
+// empty log.
+type IncidentLog struct {
+	count int
+	byRun map[runKey][]linkedIncident
+}
+
+type linkedIncident struct {
+	incident   *Incident
+	detectedAt time.Time
+}
+
+// NewIncidentLog validates incidents and indexes them by run. Incident IDs
+// must be unique; an incident caused by several runs lists them all.
+func NewIncidentLog(incidents []Incident) (*IncidentLog, error) {
+	l := &IncidentLog{byRun: map[runKey][]linkedIncident{}}
+	seen := map[string]bool{}
+	for i := range incidents {
+		inc := &incidents[i]
+		if err := validateIncident(*inc); err != nil {
+			return nil, fmt.Errorf("incident %d: %w", i+1, err)
+		}
+		if seen[inc.IncidentID] {
+			return nil, fmt.Errorf("incident %d: duplicate incident_id %q", i+1, inc.IncidentID)
+		}
+		seen[inc.IncidentID] = true
+		at, _ := time.Parse(time.RFC3339, inc.DetectedAt)
+		for _, run := range inc.RunIDs {
+			k := runKey{window: inc.WindowID, run: run}
+			l.byRun[k] = append(l.byRun[k], linkedIncident{inc, at})
+		}
+		l.count++
+	}
+	return l, nil
+}
+
+// DecodeIncidentsNDJSON reads one Incident per line. Unknown keys are
+// rejected.
+func DecodeIncidentsNDJSON(r io.Reader) (*IncidentLog, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	var incidents []Incident
+	line := 0
+	for sc.Scan() {
+		line++
+		raw := sc.Bytes()
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		var inc Incident
+		if err := dec.Decode(&inc); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := validateIncident(inc); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		incidents = append(incidents, inc)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return NewIncidentLog(incidents)
+}
+
+// LoadIncidents reads an incident stream from path.
+func LoadIncidents(path string) (*IncidentLog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return DecodeIncidentsNDJSON(f)
+}
+
+// Len returns the number of incidents in the log.
+func (l *IncidentLog) Len() int {
+	if l == nil {
+		return 0
+	}
+	return l.count
+}
+
+// unmatched counts the links for windowID whose run is not in joined.
+func (l *IncidentLog) unmatched(windowID string, joined map[runKey]bool) int {
+	if l == nil {
+		return 0
+	}
+	n := 0
+	for k, links := range l.byRun {
+		if k.window == windowID && !joined[k] {
+			n += len(links)
+		}
+	}
+	return n
+}
+
+func (l *IncidentLog) forRecord(r EvalRecord) []linkedIncident {
+	if l == nil {
+		return nil
+	}
+	return l.byRun[runKey{window: r.WindowID, run: r.RunID}]
+}
+
+// IncidentMetrics joins the incident stream against the window's records.
+// Each incident counts once however many of the window's runs it names.
+// Time to detect runs from the earliest linked run's timestamp to
+// detected_at.
+//
+// Conflicts counts links that cannot be right: an incident linked to a run
+// that was not approved, or detected before the run. UnmatchedLinks counts
+// links for the evaluated window to runs it does not have, and is only set
+// on the window's metrics. A window with conflicts or unmatched links fails
+// closed.
+type IncidentMetrics struct {
+	Count                 int            `json:"count"`
+	BySeverity            map[string]int `json:"by_severity"`
+	ByRootCause           map[string]int `json:"by_root_cause"`
+	TimeToDetectHours     Summary        `json:"time_to_detect_hours"`
+	TimeToMitigateMinutes Summary        `json:"time_to_mitigate_minutes"`
+	Unmitigated           int            `json:"unmitigated"`
+	Conflicts             int            `json:"conflicts"`
+	UnmatchedLinks        int            `json:"unmatched_links"`
+}
+
+// incidentAccumulator is set on a metricAccumulator only when an incident
+// log is attached. It keeps one entry per incident seen, with the earliest
+// timestamp among its linked runs.
+type incidentAccumulator struct {
+	seen      map[string]*seenIncident
+	conflicts int
+}
+
+type seenIncident struct {
+	incident   *Incident
+	detectedAt time.Time
+	firstRun   time.Time
+}
+
+func newIncidentAccumulator() *incidentAccumulator {
+	return &incidentAccumulator{seen: map[string]*seenIncident{}}
+}
+
+// add links the run's incidents and reports whether any of them is sev1.
+// Conflicting links are counted and otherwise ignored.
+func (a *incidentAccumulator) add(r EvalRecord, incidents []linkedIncident) bool {
+	runAt, _ := time.Parse(time.RFC3339, r.Timestamp)
+	sev1 := false
+	for _, li := range incidents {
+		if r.Decision != "approved" || li.detectedAt.Before(runAt) {
+			a.conflicts++
+			continue
+		}
+		s, ok := a.seen[li.incident.IncidentID]
+		if !ok {
+			s = &seenIncident{incident: li.incident, detectedAt: li.detectedAt, firstRun: runAt}
+			a.seen[li.incident.IncidentID] = s
+		}
+		if runAt.Before(s.firstRun) {
+			s.firstRun = runAt
+		}
+		if li.incident.Severity == IncidentSev1 {
+			sev1 = true
+		}
+	}
+	return sev1
+}
+
+func (a *incidentAccumulator) metrics() *IncidentMetrics {
+	if a == nil {
+		return nil
+	}
+	m := &IncidentMetrics{
+		Count:       len(a.seen),
+		BySeverity:  make(map[string]int, len(incidentSeverities)),
+		ByRootCause: map[string]int{},
+		Conflicts:   a.conflicts,
+	}
+	for _, s := range incidentSeverities {
+		m.BySeverity[s] = 0
+	}
+	ids := make([]string, 0, len(a.seen))
+	for id := range a.seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var detect, mitigate []float64
+	for _, id := range ids {
+		s := a.seen[id]
+		m.BySeverity[s.incident.Severity]++
+		m.ByRootCause[s.incident.RootCause]++
+		detect = append(detect, s.detectedAt.Sub(s.firstRun).Hours())
+		if s.incident.TimeToMitigateMinutes == nil {
+			m.Unmitigated++
+		} else {
+			mitigate = append(mitigate, *s.incident.TimeToMitigateMinutes)
+		}
+	}
+	m.TimeToDetectHours = summarize(detect)
+	m.TimeToMitigateMinutes = summarize(mitigate)
+	return m
+}
+
+// incidentFindings checks the per-severity ceilings and fails the window
+// when incident links conflict with the records. A ceiling fails closed
+// when the window was evaluated without an incident stream.
+func incidentFindings(m Metrics, t Thresholds, label func(string) string) []Finding {
+	var findings []Finding
+	for _, severity := range incidentSeverities {
+		max, ok := t.MaxIncidentsBySeverity[severity]
+		if !ok {
+			continue
+		}
+		id := label("incidents_" + severity)
+		if m.Incidents == nil {
+			findings = append(findings, notMeasurable(id, "no incident stream attached"))
+			continue
+		}
+		findings = append(findings, limit{id: id, observed: float64(m.Incidents.BySeverity[severity]), threshold: float64(max), integer: true}.finding())
+	}
+	return findings
+}
+
+// incidentLinkFinding fails the window when incidents are linked to runs
+// they cannot belong to or that are not in the window.
+func incidentLinkFinding(m Metrics) (Finding, bool) {
+	inc := m.Incidents
+	if inc == nil {
+		return Finding{}, false
+	}
+	if inc.Conflicts > 0 {
+		return notMeasurable("incident_links", "%d incident links point at runs that were not approved or ran after detection", inc.Conflicts), true
+	}
+	if inc.UnmatchedLinks > 0 {
+		return notMeasurable("incident_links", "%d incident links point at runs that are not in the window", inc.UnmatchedLinks), true
+	}
+	return Finding{RuleID: "incident_links", Severity: FindingInfo, Message: fmt.Sprintf("incident_links %d incidents linked", inc.Count)}, true
+}
+
+func validateIncidentThresholds(field string, t Thresholds) error {
+	for _, severity := range sortedKeys(t.MaxIncidentsBySeverity) {
+		if !isIncidentSeverity(severity) {
+			return fmt.Errorf("%s.max_incidents_by_severity: unknown severity %q (known: %s)", field, severity, strings.Join(incidentSeverities, "|"))
+		}
+		if t.MaxIncidentsBySeverity[severity] < 0 {
+			return fmt.Errorf("%s.max_incidents_by_severity[%s] cannot be negative", field, severity)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package level4gate
+
+import (
+	"strings"
+	"testing"
+)
+
+const incidentStream = `{"incident_id":"inc-1","window_id":"w","run_ids":["r1","r3"],"severity":"sev2","detected_at":"2026-02-18T05:00:00Z","time_to_mitigate_minutes":30,"root_cause":"config_drift"}
+{"incident_id":"inc-2","window_id":"w","run_ids":["r4"],"severity":"sev1","detected_at":"2026-02-18T10:00:00Z","root_cause":"missing_scenario"}
+{"incident_id":"inc-3","window_id":"other","run_ids":["r1"],"severity":"sev1","detected_at":"2026-02-18T10:00:00Z","root_cause":"missing_scenario"}
+`
+
+func evaluateWithIncidents(t *testing.T, c Criteria, stream string) GateReport {
+	t.Helper()
+	log, err := DecodeIncidentsNDJSON(strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("DecodeIncidentsNDJSON failed: %v", err)
+	}
+	acc := NewAccumulator(c).WithIncidents(log)
+	for _, r := range reversalWindow() {
+		acc.Add(r)
+	}
+	return acc.Report("w")
+}
+
+func TestIncidentsLinkToApprovedRuns(t *testing.T) {
+	report := evaluateWithIncidents(t, DefaultCriteria(), incidentStream)
+	inc := report.Metrics.Incidents
+	if inc == nil {
+		t.Fatalf("expected incident metrics")
+	}
+	if inc.Count != 2 || inc.BySeverity[IncidentSev1] != 1 || inc.BySeverity[IncidentSev2] != 1 || inc.BySeverity[IncidentSev4] != 0 {
+		t.Fatalf("unexpected counts: %+v", inc)
+	}
+	if inc.ByRootCause["config_drift"] != 1 || inc.Unmitigated != 1 || inc.TimeToMitigateMinutes.Mean != 30 {
+		t.Fatalf("unexpected detail: %+v", inc)
+	}
+	// inc-1 is detected 4h after r1 (its earliest run); inc-2 6h after r4.
+	if inc.TimeToDetectHours.Mean != 5 {
+		t.Fatalf("expected mean time to detect 5h, got %.2f", inc.TimeToDetectHours.Mean)
+	}
+	if report.Metrics.ApprovedRunCriticalIncidents != 1 {
+		t.Fatalf("expected the sev1 link to count as critical, got %d", report.Metrics.ApprovedRunCriticalIncidents)
+	}
+	if report.Passed {
+		t.Fatalf("expected the sev1 incident to fail the default ceiling")
+	}
+
+	for _, c := range report.Classes {
+		if c.Metrics.Incidents == nil || c.Metrics.Incidents.Count != 1 {
+			t.Fatalf("expected one incident per class, got %+v", c.Metrics.Incidents)
+		}
+	}
+}
+
+func TestIncidentSeverityCeilings(t *testing.T) {
+	c := DefaultCriteria()
+	c.Thresholds.MaxApprovedIncidents = 1
+	c.Thresholds.MaxIncidentsBySeverity = map[string]int{IncidentSev1: 1, IncidentSev2: 0}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	report := evaluateWithIncidents(t, c, incidentStream)
+	if report.Passed || len(report.Failures) != 1 || report.Failures[0] != "incidents_sev2 1 > 0" {
+		t.Fatalf("expected only the sev2 ceiling to fail, got %v", report.Failures)
+	}
+
+	acc := NewAccumulator(c)
+	for _, r := range reversalWindow() {
+		acc.Add(r)
+	}
+	want := "incidents_sev1 not measurable: no incident stream attached"
+	if r := acc.Report("w"); !containsString(r.Failures, want) {
+		t.Fatalf("expected %q without a stream, got %v", want, r.Failures)
+	}
+
+	c.Thresholds.MaxIncidentsBySeverity = map[string]int{"sev5": 0}
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), `unknown severity "sev5"`) {
+		t.Fatalf("expected unknown severity error, got %v", err)
+	}
+}
+
+func TestIncidentLinksToRejectedRunsFailClosed(t *testing.T) {
+	stream := `{"incident_id":"inc-1","window_id":"w","run_ids":["r9"],"severity":"sev3","detected_at":"2026-02-19T00:00:00Z","root_cause":"config_drift"}
+{"incident_id":"inc-2","window_id":"w","run_ids":["r5"],"severity":"sev4","detected_at":"2026-02-18T01:00:00Z","root_cause":"config_drift"}
+`
+	report := evaluateWithIncidents(t, DefaultCriteria(), stream)
+	if report.Metrics.Incidents.Conflicts != 2 || report.Metrics.Incidents.Count != 0 {
+		t.Fatalf("expected 2 conflicts and no incidents, got %+v", report.Metrics.Incidents)
+	}
+	want := "incident_links not measurable: 2 incident links point at runs that were not approved or ran after detection"
+	if !containsString(report.Failures, want) {
+		t.Fatalf("expected %q, got %v", want, report.Failures)
+	}
+}
+
+func TestDecodeIncidentsRejectsInvalidIncidents(t *testing.T) {
+	cases := map[string]string{
+		`{"incident_id":"i","window_id":"w","run_ids":["r1"],"severity":"critical","detected_at":"2026-02-19T00:00:00Z","root_cause":"x"}`: "line 1: severity must be sev1|sev2|sev3|sev4",
+		`{"incident_id":"i","window_id":"w","run_ids":[],"severity":"sev1","detected_at":"2026-02-19T00:00:00Z","root_cause":"x"}`:         "line 1: run_ids needs at least one run",
+		`{"incident_id":"i","window_id":"w","run_ids":["r1"],"severity":"sev1","detected_at":"yesterday","root_cause":"x"}`:                `line 1: detected_at must be RFC3339: parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`,
+	}
+	for line, want := range cases {
+		_, err := DecodeIncidentsNDJSON(strings.NewReader(line))
+		if err == nil || err.Error() != want {
+			t.Fatalf("%s: error = %v, want %q", line, err, want)
+		}
+	}
+
+	dup := `{"incident_id":"i","window_id":"w","run_ids":["r1"],"severity":"sev1","detected_at":"2026-02-19T00:00:00Z","root_cause":"x"}`
+	if _, err := DecodeIncidentsNDJSON(strings.NewReader(dup + "\n" + dup)); err == nil || !strings.Contains(err.Error(), `duplicate incident_id "i"`) {
+		t.Fatalf("expected duplicate incident error, got %v", err)
+	}
+}
+
+func TestIncidentLinksToMissingRunsFailClosed(t *testing.T) {
+	stream := incidentStream + `{"incident_id":"inc-4","window_id":"w","run_ids":["r2","r42"],"severity":"sev1","detected_at":"2026-02-19T00:00:00Z","root_cause":"config_drift"}
+`
+	report := evaluateWithIncidents(t, DefaultCriteria(), stream)
+	// inc-3 belongs to window "other", which is not evaluated here.
+	if inc := report.Metrics.Incidents; inc.UnmatchedLinks != 1 || inc.Count != 3 {
+		t.Fatalf("expected 1 unmatched link and 3 incidents, got %+v", inc)
+	}
+	want := "incident_links not measurable: 1 incident links point at runs that are not in the window"
+	if !containsString(report.Failures, want) {
+		t.Fatalf("expected %q, got %v", want, report.Failures)
+	}
+}
@@ -0,0 +1,102 @@
+package level4gate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Quality modes a record can carry. A high-quality run is a remediation
+// run whose scenario outcomes were forced rather than measured.
+const (
+	QualityStandard = "standard"
+	QualityHigh     = "high"
+)
+
+// RemediationMetrics counts remediation runs. RecordedRunCount is the
+// number of runs carrying quality_mode; SharePercent is high-quality runs
+// over all runs in the window.
+type RemediationMetrics struct {
+	RecordedRunCount int            `json:"recorded_run_count"`
+	HighRunCount     int            `json:"high_run_count"`
+	SharePercent     float64        `json:"share_percent"`
+	HighRunsByReason map[string]int `json:"high_runs_by_reason,omitempty"`
+}
+
+type remediationAccumulator struct {
+	recorded int
+	high     int
+	reasons  map[string]int
+}
+
+func (a *remediationAccumulator) add(r EvalRecord) {
+	if r.QualityMode == "" {
+		return
+	}
+	a.recorded++
+	if r.QualityMode != QualityHigh {
+		return
+	}
+	a.high++
+	if a.reasons == nil {
+		a.reasons = map[string]int{}
+	}
+	a.reasons[r.QualityReason]++
+}
+
+func (a *remediationAccumulator) metrics(runCount int) *RemediationMetrics {
+	if a.recorded == 0 {
+		return nil
+	}
+	reasons := make(map[string]int, len(a.reasons))
+	for k, v := range a.reasons {
+		reasons[k] = v
+	}
+	return &RemediationMetrics{
+		RecordedRunCount: a.recorded,
+		HighRunCount:     a.high,
+		SharePercent:     pct(float64(a.high), float64(runCount)),
+		HighRunsByReason: reasons,
+	}
+}
+
+// remediationFindings checks the optional remediation share ceiling. Like
+// the economic ceilings it fails closed: a run without quality_mode may
+// have been forced, so the share cannot be measured.
+func remediationFindings(m Metrics, t Thresholds, label func(string) string) []Finding {
+	if t.MaxRemediationSharePercent == nil {
+		return nil
+	}
+	id := label("remediation_share")
+	recorded := 0
+	if m.Remediation != nil {
+		recorded = m.Remediation.RecordedRunCount
+	}
+	if recorded < m.RunCount {
+		return []Finding{notMeasurable(id, "quality_mode missing on %d of %d runs", m.RunCount-recorded, m.RunCount)}
+	}
+	return []Finding{limit{id: id, observed: m.Remediation.SharePercent, threshold: *t.MaxRemediationSharePercent}.finding()}
+}
+
+func validateRemediationThresholds(field string, t Thresholds) error {
+	if v := t.MaxRemediationSharePercent; v != nil && (*v < 0 || *v > 100) {
+		return fmt.Errorf("%s.max_remediation_share_percent must be between 0 and 100", field)
+	}
+	return nil
+}
+
+func validateRecordQuality(r EvalRecord) error {
+	switch r.QualityMode {
+	case "", QualityStandard:
+		if r.QualityReason != "" {
+			return errors.New("quality_reason requires quality_mode=high")
+		}
+	case QualityHigh:
+		if strings.TrimSpace(r.QualityReason) == "" {
+			return errors.New("quality_mode=high requires quality_reason")
+		}
+	default:
+		return fmt.Errorf("quality_mode must be %s|%s", QualityStandard, QualityHigh)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package level4gate
+
+import (
+	"strings"
+	"testing"
+)
+
+func remediationRecords(high int) []EvalRecord {
+	var records []EvalRecord
+	for i := 0; i < 10; i++ {
+		class := "low_risk_feature"
+		if i%2 == 1 {
+			class = "medium_integration"
+		}
+		r := EvalRecord{
+			RunID: "r", PipelineID: "p", PipelineClass: class,
+			ScenarioTotal: 10, ScenarioPassed: 9, FirstPassSuccess: true, Retries: 1, Interventions: 1, Decision: "approved",
+			QualityMode: QualityStandard,
+		}
+		if i < high {
+			r.ScenarioPassed = 10
+			r.QualityMode = QualityHigh
+			r.QualityReason = "flaky fixture"
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestRemediationShareCeiling(t *testing.T) {
+	c := DefaultCriteria()
+	limit := 20.0
+	c.Thresholds.MaxRemediationSharePercent = &limit
+
+	report := EvaluateWithCriteria(remediationRecords(2), c, "w")
+	r := report.Metrics.Remediation
+	if r == nil || r.RecordedRunCount != 10 || r.HighRunCount != 2 || r.SharePercent != 20 || r.HighRunsByReason["flaky fixture"] != 2 {
+		t.Fatalf("unexpected remediation metrics: %+v", r)
+	}
+	if !report.Passed {
+		t.Fatalf("expected a 20%% share to pass a 20%% ceiling, got %v", report.Failures)
+	}
+
+	report = EvaluateWithCriteria(remediationRecords(3), c, "w")
+	if report.Passed || !strings.Contains(strings.Join(report.Failures, "\n"), "remediation_share") {
+		t.Fatalf("expected a 30%% share to fail, got %+v", report.Failures)
+	}
+
+	legacy := remediationRecords(0)
+	legacy[4].QualityMode = ""
+	report = EvaluateWithCriteria(legacy, c, "w")
+	if report.Passed || !strings.Contains(strings.Join(report.Failures, "\n"), "quality_mode missing on 1 of 10 runs") {
+		t.Fatalf("expected the ceiling to fail closed, got %+v", report.Failures)
+	}
+
+	for i := range legacy {
+		legacy[i].QualityMode = ""
+	}
+	if report := EvaluateWithCriteria(legacy, DefaultCriteria(), "w"); report.Metrics.Remediation != nil || !report.Passed {
+		t.Fatalf("expected no remediation metrics or rule without quality_mode: %+v", report)
+	}
+}
+
+func TestDecodeValidatesQualityMode(t *testing.T) {
+	base := `{"schema_version":"level4-eval-record-v0.3","window_id":"w","run_id":"r1","pipeline_id":"p","pipeline_class":"low_risk_feature","scenario_total":10,"scenario_passed":10,"first_pass_success":true,"retries":0,"interventions":0,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"2026-02-18T20:00:00Z"`
+	cases := map[string]string{
+		`,"quality_mode":"high"}`:                          "quality_mode=high requires quality_reason",
+		`,"quality_mode":"standard","quality_reason":"x"}`: "quality_reason requires quality_mode=high",
+		`,"quality_mode":"turbo"}`:                         "quality_mode must be standard|high",
+	}
+	for tail, want := range cases {
+		_, err := DecodeNDJSONWithOptions(strings.NewReader(base+tail), DecodeOptions{Strict: true})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: error = %v, want %q", tail, err, want)
+		}
+	}
+	recs, err := DecodeNDJSONWithOptions(strings.NewReader(base+`,"quality_mode":"high","quality_reason":"flaky fixture"}`), DecodeOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if recs[0].QualityMode != QualityHigh || recs[0].QualityReason != "flaky fixture" {
+		t.Fatalf("unexpected record: %+v", recs[0])
+	}
+}
@@ -0,0 +1,159 @@
+package level4gate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ResolvedCriteria is a criteria profile with its extends chain applied.
+//
+// A profile may name a parent with "extends": a path relative to the
+// profile's own directory. The parent is resolved first and the child is
+// merged over it field by field: objects merge recursively, any other value
+// replaces the parent's, and null removes the inherited key.
+type ResolvedCriteria struct {
+	// Document is the effective profile without the extends key.
+	Document map[string]any `json:"criteria"`
+	// Sources maps the JSON pointer of every leaf value in Document to the
+	// file that set it.
+	Sources map[string]string `json:"sources"`
+	// Chain lists the files applied, from the requested profile to its root
+	// ancestor.
+	Chain []string `json:"chain"`
+}
+
+// ResolveCriteria follows the extends chain of the profile at path. It fails
+// on an inheritance cycle.
+func ResolveCriteria(path string) (ResolvedCriteria, error) {
+	return resolveCriteria(filepath.Clean(path), nil)
+}
+
+// Decode converts the effective document into Criteria and validates it.
+func (r ResolvedCriteria) Decode() (Criteria, error) {
+	b, err := json.Marshal(r.Document)
+	if err != nil {
+		return Criteria{}, err
+	}
+	return DecodeCriteria(bytes.NewReader(b))
+}
+
+// SourcePaths returns the keys of Sources in sorted order.
+func (r ResolvedCriteria) SourcePaths() []string {
+	out := make([]string, 0, len(r.Sources))
+	for k := range r.Sources {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func resolveCriteria(path string, stack []string) (ResolvedCriteria, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ResolvedCriteria{}, err
+	}
+	for i, seen := range stack {
+		if seen == abs {
+			cycle := append(append([]string{}, stack[i:]...), abs)
+			return ResolvedCriteria{}, fmt.Errorf("criteria inheritance cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	doc, err := readCriteriaDocument(path)
+	if err != nil {
+		return ResolvedCriteria{}, err
+	}
+
+	parentRef, hasParent := doc["extends"]
+	delete(doc, "extends")
+	if !hasParent {
+		sources := map[string]string{}
+		recordSources(sources, "", doc, path)
+		return ResolvedCriteria{Document: doc, Sources: sources, Chain: []string{path}}, nil
+	}
+
+	ref, ok := parentRef.(string)
+	if !ok || ref == "" {
+		return ResolvedCriteria{}, fmt.Errorf("%s: extends must be a non-empty string", path)
+	}
+	parentPath := ref
+	if !filepath.IsAbs(ref) {
+		parentPath = filepath.Join(filepath.Dir(path), ref)
+	}
+	parent, err := resolveCriteria(parentPath, append(stack, abs))
+	if err != nil {
+		return ResolvedCriteria{}, err
+	}
+	mergeCriteriaDocument(parent.Document, doc, "", parent.Sources, path)
+	parent.Chain = append([]string{path}, parent.Chain...)
+	return parent, nil
+}
+
+func readCriteriaDocument(path string) (map[string]any, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("%s: criteria must be a JSON object", path)
+	}
+	return doc, nil
+}
+
+// mergeCriteriaDocument merges src over dst in place and updates sources
+// for every value src sets or removes.
+func mergeCriteriaDocument(dst, src map[string]any, prefix string, sources map[string]string, file string) {
+	for k, v := range src {
+		ptr := prefix + "/" + escapePointerToken(k)
+		if v == nil {
+			delete(dst, k)
+			dropSources(sources, ptr)
+			continue
+		}
+		srcObj, srcIsObj := v.(map[string]any)
+		dstObj, dstIsObj := dst[k].(map[string]any)
+		if srcIsObj && dstIsObj && len(srcObj) > 0 {
+			mergeCriteriaDocument(dstObj, srcObj, ptr, sources, file)
+			continue
+		}
+		dst[k] = v
+		dropSources(sources, ptr)
+		recordSources(sources, ptr, v, file)
+	}
+}
+
+func recordSources(sources map[string]string, ptr string, v any, file string) {
+	obj, ok := v.(map[string]any)
+	if !ok || len(obj) == 0 {
+		if ptr != "" {
+			sources[ptr] = file
+		}
+		return
+	}
+	for k, child := range obj {
+		recordSources(sources, ptr+"/"+escapePointerToken(k), child, file)
+	}
+}
+
+func dropSources(sources map[string]string, ptr string) {
+	for k := range sources {
+		if k == ptr || strings.HasPrefix(k, ptr+"/") {
+			delete(sources, k)
+		}
+	}
+}
+
+func escapePointerToken(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
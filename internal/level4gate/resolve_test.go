@@ -0,0 +1,92 @@
+package level4gate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mustWrite(t *testing.T, path string, body string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+}
+
+func TestResolveCriteriaMergesExtendsChain(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.json")
+	team := filepath.Join(dir, "teams", "team.json")
+	mustWrite(t, base, `{"version":"base","min_runs":10,"thresholds":{"min_scenario_pass_rate_percent":90,"min_first_pass_rate_percent":70,"max_mean_retries":2,"max_decision_reversal_percent":5,"max_approved_incidents":0},"required_class_minimum":{"low_risk_feature":4,"medium_integration":4},"confidence":{"level":0.9}}`)
+	mustWrite(t, team, `{"extends":"../base.json","version":"team","thresholds":{"max_mean_retries":1.5},"confidence":null}`)
+
+	res, err := ResolveCriteria(team)
+	if err != nil {
+		t.Fatalf("ResolveCriteria failed: %v", err)
+	}
+	c, err := res.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if c.Version != "team" || c.MinRuns != 10 || c.Thresholds.MaxMeanRetries != 1.5 || c.Thresholds.MinScenarioPassRatePercent != 90 {
+		t.Fatalf("unexpected resolved criteria: %+v", c)
+	}
+	if c.Confidence != nil {
+		t.Fatalf("expected null to remove inherited confidence, got %+v", c.Confidence)
+	}
+	if got := res.Sources["/thresholds/max_mean_retries"]; got != team {
+		t.Fatalf("max_mean_retries source = %q, want %q", got, team)
+	}
+	if got := res.Sources["/thresholds/max_decision_reversal_percent"]; got != base {
+		t.Fatalf("max_decision_reversal_percent source = %q, want %q", got, base)
+	}
+	if _, ok := res.Sources["/confidence/level"]; ok {
+		t.Fatalf("expected removed key to have no source")
+	}
+	if len(res.Chain) != 2 || res.Chain[0] != team || res.Chain[1] != base {
+		t.Fatalf("unexpected chain: %v", res.Chain)
+	}
+}
+
+func TestResolveCriteriaDetectsCycle(t *testing.T) {
+	dir := t.TempDir()
+	mustWrite(t, filepath.Join(dir, "a.json"), `{"extends":"b.json"}`)
+	mustWrite(t, filepath.Join(dir, "b.json"), `{"extends":"a.json"}`)
+
+	_, err := ResolveCriteria(filepath.Join(dir, "a.json"))
+	if err == nil || !strings.Contains(err.Error(), "criteria inheritance cycle") {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+}
+
+func TestDecodeCriteriaRejectsExtends(t *testing.T) {
+	_, err := DecodeCriteria(strings.NewReader(`{"extends":"base.json","min_runs":1}`))
+	if err == nil || !strings.Contains(err.Error(), "extends is only supported") {
+		t.Fatalf("expected extends error, got %v", err)
+	}
+}
+
+func TestCheckedInProfilesResolve(t *testing.T) {
+	c, err := LoadCriteria(filepath.Join("..", "..", "profiles", "level4-gate-v0.1-adversarial.json"))
+	if err != nil {
+		t.Fatalf("LoadCriteria failed: %v", err)
+	}
+	if c.MinRuns != 20 || c.Thresholds.MinScenarioPassRatePercent != 95 || len(c.PipelineClasses) != 2 {
+		t.Fatalf("unexpected adversarial profile: %+v", c)
+	}
+	// The v0.1 profiles name the halves rule explicitly, so their verdicts
+	// do not depend on the default method.
+	for _, name := range []string{"level4-gate-v0.1-baseline.json", "level4-gate-v0.1-adversarial.json"} {
+		c, err := LoadCriteria(filepath.Join("..", "..", "profiles", name))
+		if err != nil {
+			t.Fatalf("LoadCriteria(%s) failed: %v", name, err)
+		}
+		if c.InterventionTrend == nil || c.InterventionTrend.Method != TrendHalves {
+			t.Fatalf("%s: expected intervention_trend.method=%s, got %+v", name, TrendHalves, c.InterventionTrend)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package level4gate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// ReversalEvent records one change to a run's decision after the fact. It
+// lives in its own NDJSON stream, so a reversal made after a window closed
+// can be applied to that window by re-evaluating it with the stream.
+// Events are joined to records on (window_id, run_id), the same key
+// duplicate detection uses, since run IDs repeat across windows.
+type ReversalEvent struct {
+	WindowID  string `json:"window_id"`
+	RunID     string `json:"run_id"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Actor     string `json:"actor"`
+	Reason    string `json:"reason"`
+	Timestamp string `json:"timestamp"`
+}
+
+func validateReversal(e ReversalEvent) error {
+	if e.WindowID == "" {
+		return errors.New("window_id is required")
+	}
+	if e.RunID == "" {
+		return errors.New("run_id is required")
+	}
+	for _, d := range []struct{ field, value string }{{"from", e.From}, {"to", e.To}} {
+		switch d.value {
+		case "approved", "rejected", "failed":
+		default:
+			return fmt.Errorf("%s must be approved|rejected|failed", d.field)
+		}
+	}
+	if e.From == e.To {
+		return errors.New("from and to must differ")
+	}
+	if e.Actor == "" {
+		return errors.New("actor is required")
+	}
+	if e.Reason == "" {
+		return errors.New("reason is required")
+	}
+	if _, err := time.Parse(time.RFC3339, e.Timestamp); err != nil {
+		return fmt.Errorf("timestamp must be RFC3339: %w", err)
+	}
+	return nil
+}
+
+// ReversalLog indexes reversal events by run. A nil *ReversalLog is an
+// empty log.
+type ReversalLog struct {
+	byRun map[runKey][]reversalAt
+}
+
+type reversalAt struct {
+	event ReversalEvent
+	at    time.Time
+}
+
+// NewReversalLog validates events and indexes them. Each run's events are
+// kept in timestamp order; events with equal timestamps keep their input
+// order.
+func NewReversalLog(events []ReversalEvent) (*ReversalLog, error) {
+	l := &ReversalLog{byRun: map[runKey][]reversalAt{}}
+	for i, e := range events {
+		if err := validateReversal(e); err != nil {
+			return nil, fmt.Errorf("reversal %d: %w", i+1, err)
+		}
+		at, _ := time.Parse(time.RFC3339, e.Timestamp)
+		k := runKey{window: e.WindowID, run: e.RunID}
+		l.byRun[k] = append(l.byRun[k], reversalAt{e, at})
+	}
+	for _, evs := range l.byRun {
+		sort.SliceStable(evs, func(i, j int) bool { return evs[i].at.Before(evs[j].at) })
+	}
+	return l, nil
+}
+
+// DecodeReversalsNDJSON reads one ReversalEvent per line. Unknown keys are
+// rejected, so a misspelled field is not silently dropped.
+func DecodeReversalsNDJSON(r io.Reader) (*ReversalLog, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	var events []ReversalEvent
+	line := 0
+	for sc.Scan() {
+		line++
+		raw := sc.Bytes()
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		var e ReversalEvent
+		if err := dec.Decode(&e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := validateReversal(e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return NewReversalLog(events)
+}
+
+// LoadReversals reads a reversal event stream from path.
+func LoadReversals(path string) (*ReversalLog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return DecodeReversalsNDJSON(f)
+}
+
+// Len returns the number of events in the log.
+func (l *ReversalLog) Len() int {
+	if l == nil {
+		return 0
+	}
+	n := 0
+	for _, evs := range l.byRun {
+		n += len(evs)
+	}
+	return n
+}
+
+// AsOf returns the events made at or before t, which reproduces the
+// verdict a window had at that time.
+func (l *ReversalLog) AsOf(t time.Time) *ReversalLog {
+	out := &ReversalLog{byRun: map[runKey][]reversalAt{}}
+	if l == nil {
+		return out
+	}
+	for k, evs := range l.byRun {
+		for _, e := range evs {
+			if !e.at.After(t) {
+				out.byRun[k] = append(out.byRun[k], e)
+			}
+		}
+	}
+	return out
+}
+
+// unmatched counts the events for windowID whose run is not in joined.
+func (l *ReversalLog) unmatched(windowID string, joined map[runKey]bool) int {
+	if l == nil {
+		return 0
+	}
+	n := 0
+	for k, evs := range l.byRun {
+		if k.window == windowID && !joined[k] {
+			n += len(evs)
+		}
+	}
+	return n
+}
+
+func (l *ReversalLog) forRecord(r EvalRecord) []reversalAt {
+	if l == nil {
+		return nil
+	}
+	return l.byRun[runKey{window: r.WindowID, run: r.RunID}]
+}
+
+// ReversalMetrics joins the reversal stream against the window's records.
+// A run is reversed when it has a matching event or, for records written
+// before the stream existed, decision_reversed is set; the latter count in
+// the rates but not in the directions or latency. Rates are per original
+// decision. Latency runs from the record's timestamp to its first event.
+//
+// Conflicts counts events that cannot be applied: an event whose from does
+// not match the decision it reverses, or one dated before its run.
+// Unmatched counts events for the evaluated window whose run is not in it.
+// A window with conflicts or unmatched events fails closed. Unmatched is
+// only set on the window's metrics, not on its classes.
+type ReversalMetrics struct {
+	Events                  int            `json:"events"`
+	ApprovedRuns            int            `json:"approved_runs"`
+	ApprovedReversed        int            `json:"approved_reversed"`
+	ApprovedReversalPercent float64        `json:"approved_reversal_percent"`
+	RejectedRuns            int            `json:"rejected_runs"`
+	RejectedReversed        int            `json:"rejected_reversed"`
+	RejectedReversalPercent float64        `json:"rejected_reversal_percent"`
+	ByDirection             map[string]int `json:"by_direction"`
+	ByActor                 map[string]int `json:"by_actor"`
+	LatencyHours            Summary        `json:"latency_hours"`
+	FlaggedWithoutEvent     int            `json:"flagged_without_event"`
+	Conflicts               int            `json:"conflicts"`
+	Unmatched               int            `json:"unmatched"`
+}
+
+// reversalAccumulator is set on a metricAccumulator only when a reversal
+// log is attached, so windows evaluated without one report no metrics.
+type reversalAccumulator struct {
+	events                         int
+	approvedRuns, approvedReversed int
+	rejectedRuns, rejectedReversed int
+	byDirection, byActor           map[string]int
+	latencyHours                   []float64
+	flaggedWithoutEvent, conflicts int
+}
+
+func newReversalAccumulator() *reversalAccumulator {
+	return &reversalAccumulator{byDirection: map[string]int{}, byActor: map[string]int{}}
+}
+
+// add applies the run's events in order and reports whether its decision
+// ended up reversed by them. Events after a conflict are not applied.
+func (a *reversalAccumulator) add(r EvalRecord, events []reversalAt) bool {
+	recordAt, _ := time.Parse(time.RFC3339, r.Timestamp)
+	decision := r.Decision
+	applied := 0
+	a.events += len(events)
+	for i, e := range events {
+		if e.event.From != decision || e.at.Before(recordAt) {
+			a.conflicts += len(events) - i
+			break
+		}
+		if applied == 0 {
+			a.latencyHours = append(a.latencyHours, e.at.Sub(recordAt).Hours())
+		}
+		a.byDirection[e.event.From+"->"+e.event.To]++
+		a.byActor[e.event.Actor]++
+		decision = e.event.To
+		applied++
+	}
+
+	reversed := applied > 0
+	if !reversed && r.DecisionReversed {
+		a.flaggedWithoutEvent++
+		reversed = true
+	}
+	switch r.Decision {
+	case "approved":
+		a.approvedRuns++
+		if reversed {
+			a.approvedReversed++
+		}
+	case "rejected":
+		a.rejectedRuns++
+		if reversed {
+			a.rejectedReversed++
+		}
+	}
+	return applied > 0
+}
+
+func (a *reversalAccumulator) metrics() *ReversalMetrics {
+	if a == nil {
+		return nil
+	}
+	m := &ReversalMetrics{
+		Events:                  a.events,
+		ApprovedRuns:            a.approvedRuns,
+		ApprovedReversed:        a.approvedReversed,
+		ApprovedReversalPercent: pct(float64(a.approvedReversed), float64(a.approvedRuns)),
+		RejectedRuns:            a.rejectedRuns,
+		RejectedReversed:        a.rejectedReversed,
+		RejectedReversalPercent: pct(float64(a.rejectedReversed), float64(a.rejectedRuns)),
+		ByDirection:             make(map[string]int, len(a.byDirection)),
+		ByActor:                 make(map[string]int, len(a.byActor)),
+		LatencyHours:            summarize(a.latencyHours),
+		FlaggedWithoutEvent:     a.flaggedWithoutEvent,
+		Conflicts:               a.conflicts,
+	}
+	for k, v := range a.byDirection {
+		m.ByDirection[k] = v
+	}
+	for k, v := range a.byActor {
+		m.ByActor[k] = v
+	}
+	return m
+}
+
+// reversalFinding fails the window when reversal events could not be
+// applied or name runs it does not have, since the reversal rates would
+// then be understated.
+func reversalFinding(m Metrics) (Finding, bool) {
+	r := m.Reversals
+	if r == nil {
+		return Finding{}, false
+	}
+	if r.Conflicts > 0 {
+		return notMeasurable("reversal_events", "%d of %d events do not match the decision they reverse", r.Conflicts, r.Events), true
+	}
+	if r.Unmatched > 0 {
+		return notMeasurable("reversal_events", "%d events name runs that are not in the window", r.Unmatched), true
+	}
+	return Finding{RuleID: "reversal_events", Severity: FindingInfo, Message: fmt.Sprintf("reversal_events %d applied", r.Events)}, true
+}
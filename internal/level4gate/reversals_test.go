@@ -0,0 +1,176 @@
+package level4gate
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func reversalWindow() []EvalRecord {
+	var records []EvalRecord
+	for i := 1; i <= 10; i++ {
+		class := "low_risk_feature"
+		if i%2 == 0 {
+			class = "medium_integration"
+		}
+		decision := "approved"
+		if i > 8 {
+			decision = "rejected"
+		}
+		records = append(records, EvalRecord{
+			WindowID: "w", RunID: fmt.Sprintf("r%d", i), PipelineID: "p", PipelineClass: class,
+			ScenarioTotal: 10, ScenarioPassed: 10, FirstPassSuccess: true, Retries: 1, Decision: decision,
+			Timestamp: fmt.Sprintf("2026-02-18T%02d:00:00Z", i),
+		})
+	}
+	return records
+}
+
+const reversalStream = `{"window_id":"w","run_id":"r2","from":"approved","to":"rejected","actor":"alice","reason":"holdout regression","timestamp":"2026-02-18T14:00:00Z"}
+{"window_id":"w","run_id":"r9","from":"rejected","to":"approved","actor":"bob","reason":"false positive","timestamp":"2026-02-20T09:00:00Z"}
+{"window_id":"other","run_id":"r1","from":"approved","to":"rejected","actor":"alice","reason":"different window","timestamp":"2026-02-18T14:00:00Z"}
+`
+
+func evaluateWithReversals(t *testing.T, records []EvalRecord, log *ReversalLog) GateReport {
+	t.Helper()
+	acc := NewAccumulator(DefaultCriteria()).WithReversals(log)
+	for _, r := range records {
+		acc.Add(r)
+	}
+	return acc.Report("w")
+}
+
+func TestReversalEventsJoinOnWindowAndRun(t *testing.T) {
+	log, err := DecodeReversalsNDJSON(strings.NewReader(reversalStream))
+	if err != nil {
+		t.Fatalf("DecodeReversalsNDJSON failed: %v", err)
+	}
+	if log.Len() != 3 {
+		t.Fatalf("expected 3 events, got %d", log.Len())
+	}
+	report := evaluateWithReversals(t, reversalWindow(), log)
+	rv := report.Metrics.Reversals
+	if rv == nil {
+		t.Fatalf("expected reversal metrics")
+	}
+	if rv.Events != 2 || rv.Conflicts != 0 {
+		t.Fatalf("expected 2 joined events and no conflicts, got %+v", rv)
+	}
+	if rv.ApprovedReversed != 1 || rv.ApprovedRuns != 8 || rv.ApprovedReversalPercent != 12.5 {
+		t.Fatalf("unexpected approved rate: %+v", rv)
+	}
+	if rv.RejectedReversed != 1 || rv.RejectedRuns != 2 || rv.RejectedReversalPercent != 50 {
+		t.Fatalf("unexpected rejected rate: %+v", rv)
+	}
+	if rv.ByDirection["approved->rejected"] != 1 || rv.ByDirection["rejected->approved"] != 1 || rv.ByActor["alice"] != 1 {
+		t.Fatalf("unexpected breakdown: %+v %+v", rv.ByDirection, rv.ByActor)
+	}
+	// r2 at 02:00 reversed at 14:00; r9 at 09:00 reversed two days later.
+	if rv.LatencyHours.Count != 2 || rv.LatencyHours.Total != 12+48 {
+		t.Fatalf("unexpected latency: %+v", rv.LatencyHours)
+	}
+	if report.Metrics.DecisionReversalPercent != 25 {
+		t.Fatalf("expected joined events in the v0.1 rate, got %.2f", report.Metrics.DecisionReversalPercent)
+	}
+	if report.Passed {
+		t.Fatalf("expected the late reversals to fail the window")
+	}
+}
+
+func TestReversalLogAsOfReproducesEarlierVerdict(t *testing.T) {
+	log, err := DecodeReversalsNDJSON(strings.NewReader(reversalStream))
+	if err != nil {
+		t.Fatalf("DecodeReversalsNDJSON failed: %v", err)
+	}
+	cutoff := time.Date(2026, 2, 18, 13, 0, 0, 0, time.UTC)
+	report := evaluateWithReversals(t, reversalWindow(), log.AsOf(cutoff))
+	if report.Metrics.Reversals.Events != 0 || report.Metrics.DecisionReversalPercent != 0 {
+		t.Fatalf("expected no reversals before the cutoff, got %+v", report.Metrics.Reversals)
+	}
+	if !report.Passed {
+		t.Fatalf("expected pass as of the cutoff, got %v", report.Failures)
+	}
+}
+
+func TestReversalConflictsFailClosed(t *testing.T) {
+	stream := `{"window_id":"w","run_id":"r1","from":"rejected","to":"approved","actor":"alice","reason":"wrong from","timestamp":"2026-02-19T00:00:00Z"}
+{"window_id":"w","run_id":"r1","from":"approved","to":"failed","actor":"alice","reason":"after a conflict","timestamp":"2026-02-19T01:00:00Z"}
+{"window_id":"w","run_id":"r3","from":"approved","to":"rejected","actor":"bob","reason":"before the run","timestamp":"2026-02-18T00:00:00Z"}
+`
+	log, err := DecodeReversalsNDJSON(strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("DecodeReversalsNDJSON failed: %v", err)
+	}
+	report := evaluateWithReversals(t, reversalWindow(), log)
+	if report.Metrics.Reversals.Conflicts != 3 || report.Metrics.Reversals.ApprovedReversed != 0 {
+		t.Fatalf("expected 3 conflicts and nothing applied, got %+v", report.Metrics.Reversals)
+	}
+	want := "reversal_events not measurable: 3 of 3 events do not match the decision they reverse"
+	if report.Passed || !containsString(report.Failures, want) {
+		t.Fatalf("expected %q, got %v", want, report.Failures)
+	}
+}
+
+func TestReversalEventsForMissingRunsFailClosed(t *testing.T) {
+	stream := reversalStream + `{"window_id":"w","run_id":"r42","from":"approved","to":"rejected","actor":"alice","reason":"typo in run_id","timestamp":"2026-02-19T00:00:00Z"}
+`
+	log, err := DecodeReversalsNDJSON(strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("DecodeReversalsNDJSON failed: %v", err)
+	}
+	report := evaluateWithReversals(t, reversalWindow(), log)
+	// The event for window "other" belongs to a window not evaluated here.
+	if rv := report.Metrics.Reversals; rv.Unmatched != 1 || rv.Events != 2 {
+		t.Fatalf("expected 1 unmatched event, got %+v", rv)
+	}
+	want := "reversal_events not measurable: 1 events name runs that are not in the window"
+	if !containsString(report.Failures, want) {
+		t.Fatalf("expected %q, got %v", want, report.Failures)
+	}
+	for _, c := range report.Classes {
+		if c.Metrics.Reversals.Unmatched != 0 {
+			t.Fatalf("expected unmatched events only on the window, got %+v", c.Metrics.Reversals)
+		}
+	}
+}
+
+func TestDecodeReversalsRejectsInvalidEvents(t *testing.T) {
+	cases := map[string]string{
+		`{"window_id":"w","run_id":"r1","from":"approved","to":"approved","actor":"a","reason":"x","timestamp":"2026-02-19T00:00:00Z"}`: "line 1: from and to must differ",
+		`{"window_id":"w","run_id":"r1","from":"approved","to":"merged","actor":"a","reason":"x","timestamp":"2026-02-19T00:00:00Z"}`:   "line 1: to must be approved|rejected|failed",
+		`{"window_id":"w","run_id":"r1","from":"approved","to":"rejected","reason":"x","timestamp":"2026-02-19T00:00:00Z"}`:             "line 1: actor is required",
+		`{"run_id":"r1","from":"approved","to":"rejected","actor":"a","reason":"x","timestamp":"2026-02-19T00:00:00Z","who":"a"}`:       `line 1: json: unknown field "who"`,
+	}
+	for line, want := range cases {
+		_, err := DecodeReversalsNDJSON(strings.NewReader(line))
+		if err == nil || err.Error() != want {
+			t.Fatalf("%s: error = %v, want %q", line, err, want)
+		}
+	}
+}
+
+func TestReversalRulesNeedTheStream(t *testing.T) {
+	c := DefaultCriteria()
+	c.Rules = []ExprRule{{Name: "rejected_reversals", Expr: "rejected_reversal_percent <= 20", Severity: RuleWarn}}
+	acc := NewAccumulator(c)
+	for _, r := range reversalWindow() {
+		acc.Add(r)
+	}
+	report := acc.Report("w")
+	if report.Metrics.Reversals != nil {
+		t.Fatalf("expected no reversal metrics without a stream")
+	}
+	if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "not measurable") {
+		t.Fatalf("expected a not measurable warning, got %v", report.Warnings)
+	}
+}
+
+func containsString(list []string, want string) bool {
+	for _, s := range list {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
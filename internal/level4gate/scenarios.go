@@ -0,0 +1,349 @@
+package level4gate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Scenario categories follow the sections of
+// scenarios/scenario-suite-template.md.
+const (
+	ScenarioCategoryHappyPath = "happy_path"
+	ScenarioCategoryError     = "error"
+	ScenarioCategoryEdge      = "edge"
+)
+
+// Failed scenario severities, most to least serious.
+const (
+	SeverityCritical = "critical"
+	SeverityMajor    = "major"
+	SeverityMinor    = "minor"
+	SeverityCosmetic = "cosmetic"
+)
+
+var scenarioCategories = []string{ScenarioCategoryEdge, ScenarioCategoryError, ScenarioCategoryHappyPath}
+
+var scenarioSeverities = []string{SeverityCritical, SeverityMajor, SeverityMinor, SeverityCosmetic}
+
+type ScenarioCategoryCount struct {
+	Total  int `json:"total"`
+	Passed int `json:"passed"`
+}
+
+type FailedScenario struct {
+	ID       string `json:"id"`
+	Category string `json:"category"`
+	Severity string `json:"severity"`
+}
+
+// ScenarioScoring weights scenario categories in the weighted pass rate.
+// Categories without a weight count 1, as do scenarios on records that do
+// not report scenario_categories.
+type ScenarioScoring struct {
+	CategoryWeights map[string]float64 `json:"category_weights"`
+}
+
+type CategoryMetrics struct {
+	Total           int     `json:"total"`
+	Passed          int     `json:"passed"`
+	PassRatePercent float64 `json:"pass_rate_percent"`
+}
+
+// ScenarioMetrics aggregates the optional scenario detail. Categories only
+// counts records with scenario_categories. UnattributedFailures counts failed
+// scenarios on records without a failed_scenarios list, whose severity is
+// therefore unknown. UnweightableRuns counts, when category weights are
+// configured, records that list failed_scenarios without
+// scenario_categories: their passed scenarios have no category, so the
+// weighted pass rate cannot be measured.
+type ScenarioMetrics struct {
+	WeightedPassRatePercent float64                    `json:"weighted_pass_rate_percent"`
+	Categories              map[string]CategoryMetrics `json:"categories"`
+	FailedBySeverity        map[string]int             `json:"failed_by_severity"`
+	UnattributedFailures    int                        `json:"unattributed_failures"`
+	UnweightableRuns        int                        `json:"unweightable_runs,omitempty"`
+}
+
+func (s *ScenarioScoring) weights() map[string]float64 {
+	if s == nil {
+		return nil
+	}
+	return s.CategoryWeights
+}
+
+func (s *ScenarioScoring) validate() error {
+	if s == nil {
+		return nil
+	}
+	for _, name := range sortedFloatKeys(s.CategoryWeights) {
+		if !isScenarioCategory(name) {
+			return fmt.Errorf("scenario_scoring.category_weights: unknown category %q (known: %s)", name, strings.Join(scenarioCategories, "|"))
+		}
+		if s.CategoryWeights[name] <= 0 {
+			return fmt.Errorf("scenario_scoring.category_weights[%s] must be > 0", name)
+		}
+	}
+	return nil
+}
+
+// scenarioAccumulator keeps category totals and uncategorized scenario
+// counts separately so weights can be applied when metrics are read.
+type scenarioAccumulator struct {
+	detailed             bool
+	categories           map[string]ScenarioCategoryCount
+	uncategorizedTotal   int
+	uncategorizedPassed  int
+	bySeverity           map[string]int
+	unattributedFailures int
+	failedOnlyRuns       int
+}
+
+func newScenarioAccumulator() scenarioAccumulator {
+	return scenarioAccumulator{
+		categories: map[string]ScenarioCategoryCount{},
+		bySeverity: map[string]int{},
+	}
+}
+
+func (a *scenarioAccumulator) add(r EvalRecord) {
+	if len(r.ScenarioCategories) > 0 || len(r.FailedScenarios) > 0 {
+		a.detailed = true
+	}
+	if len(r.ScenarioCategories) > 0 {
+		for name, cc := range r.ScenarioCategories {
+			agg := a.categories[name]
+			agg.Total += cc.Total
+			agg.Passed += cc.Passed
+			a.categories[name] = agg
+		}
+	} else {
+		a.uncategorizedTotal += r.ScenarioTotal
+		a.uncategorizedPassed += r.ScenarioPassed
+		if len(r.FailedScenarios) > 0 {
+			a.failedOnlyRuns++
+		}
+	}
+	if len(r.FailedScenarios) > 0 {
+		for _, f := range r.FailedScenarios {
+			a.bySeverity[f.Severity]++
+		}
+	} else {
+		a.unattributedFailures += r.ScenarioTotal - r.ScenarioPassed
+	}
+}
+
+func (a *scenarioAccumulator) metrics(weights map[string]float64) *ScenarioMetrics {
+	if !a.detailed {
+		return nil
+	}
+	weight := func(category string) float64 {
+		if w, ok := weights[category]; ok {
+			return w
+		}
+		return 1
+	}
+
+	categories := make(map[string]CategoryMetrics, len(a.categories))
+	weightedTotal := float64(a.uncategorizedTotal)
+	weightedPassed := float64(a.uncategorizedPassed)
+	for _, name := range sortedCategoryKeys(a.categories) {
+		cc := a.categories[name]
+		categories[name] = CategoryMetrics{
+			Total:           cc.Total,
+			Passed:          cc.Passed,
+			PassRatePercent: pct(float64(cc.Passed), float64(cc.Total)),
+		}
+		weightedTotal += weight(name) * float64(cc.Total)
+		weightedPassed += weight(name) * float64(cc.Passed)
+	}
+	bySeverity := make(map[string]int, len(a.bySeverity))
+	for k, v := range a.bySeverity {
+		bySeverity[k] = v
+	}
+	out := &ScenarioMetrics{
+		WeightedPassRatePercent: pct(weightedPassed, weightedTotal),
+		Categories:              categories,
+		FailedBySeverity:        bySeverity,
+		UnattributedFailures:    a.unattributedFailures,
+	}
+	if len(weights) > 0 {
+		out.UnweightableRuns = a.failedOnlyRuns
+	}
+	return out
+}
+
+// scenarioFindings checks the optional scenario rules. Without scenario
+// detail the weighted pass rate equals the plain scenario pass rate; the
+// category and severity rules fail closed, as does the weighted pass rate
+// when a run's failures carry categories its passes do not.
+func scenarioFindings(m Metrics, t Thresholds, label func(string) string) []Finding {
+	var findings []Finding
+	s := m.Scenarios
+	if t.MinWeightedScenarioPassRatePercent != nil {
+		got := m.ScenarioPassRatePercent
+		if s != nil {
+			got = s.WeightedPassRatePercent
+		}
+		id := label("weighted_scenario_pass_rate")
+		if s != nil && s.UnweightableRuns > 0 {
+			findings = append(findings, notMeasurable(id, "%d runs list failed_scenarios without scenario_categories", s.UnweightableRuns))
+		} else {
+			findings = append(findings, limit{id: id, observed: got, threshold: *t.MinWeightedScenarioPassRatePercent, floor: true}.finding())
+		}
+	}
+	for _, name := range sortedFloatKeys(t.MinCategoryPassRatePercent) {
+		id := label(name + "_scenario_pass_rate")
+		var cm CategoryMetrics
+		if s != nil {
+			cm = s.Categories[name]
+		}
+		if cm.Total == 0 {
+			findings = append(findings, notMeasurable(id, "no runs report scenario_categories[%s]", name))
+			continue
+		}
+		findings = append(findings, limit{id: id, observed: cm.PassRatePercent, threshold: t.MinCategoryPassRatePercent[name], floor: true}.finding())
+	}
+	for _, severity := range scenarioSeverities {
+		max, ok := t.MaxFailedScenariosBySeverity[severity]
+		if !ok {
+			continue
+		}
+		id := label("failed_scenarios_" + severity)
+		got := 0
+		unattributed := m.ScenarioPassRatePercent < 100
+		if s != nil {
+			got = s.FailedBySeverity[severity]
+			unattributed = s.UnattributedFailures > 0
+		}
+		f := limit{id: id, observed: float64(got), threshold: float64(max), integer: true}.finding()
+		if f.Severity != FindingBlock && unattributed {
+			f = notMeasurable(id, "some failed scenarios lack failed_scenarios detail")
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+func validateScenarioThresholds(field string, t Thresholds) error {
+	if t.MinWeightedScenarioPassRatePercent != nil {
+		if v := *t.MinWeightedScenarioPassRatePercent; v < 0 || v > 100 {
+			return fmt.Errorf("%s.min_weighted_scenario_pass_rate_percent must be between 0 and 100", field)
+		}
+	}
+	for _, name := range sortedFloatKeys(t.MinCategoryPassRatePercent) {
+		if !isScenarioCategory(name) {
+			return fmt.Errorf("%s.min_category_pass_rate_percent: unknown category %q (known: %s)", field, name, strings.Join(scenarioCategories, "|"))
+		}
+		if v := t.MinCategoryPassRatePercent[name]; v < 0 || v > 100 {
+			return fmt.Errorf("%s.min_category_pass_rate_percent[%s] must be between 0 and 100", field, name)
+		}
+	}
+	for _, severity := range sortedKeys(t.MaxFailedScenariosBySeverity) {
+		if !isSeverity(severity) {
+			return fmt.Errorf("%s.max_failed_scenarios_by_severity: unknown severity %q (known: %s)", field, severity, strings.Join(scenarioSeverities, "|"))
+		}
+		if t.MaxFailedScenariosBySeverity[severity] < 0 {
+			return fmt.Errorf("%s.max_failed_scenarios_by_severity[%s] cannot be negative", field, severity)
+		}
+	}
+	return nil
+}
+
+// validateRecordScenarios checks that the optional scenario detail agrees
+// with scenario_total and scenario_passed.
+func validateRecordScenarios(r EvalRecord) error {
+	if len(r.ScenarioCategories) > 0 {
+		var total, passed int
+		for _, name := range sortedCategoryKeys(r.ScenarioCategories) {
+			cc := r.ScenarioCategories[name]
+			if !isScenarioCategory(name) {
+				return fmt.Errorf("scenario_categories: unknown category %q (known: %s)", name, strings.Join(scenarioCategories, "|"))
+			}
+			if cc.Total < 0 || cc.Passed < 0 || cc.Passed > cc.Total {
+				return fmt.Errorf("scenario_categories[%s]: invalid counts", name)
+			}
+			total += cc.Total
+			passed += cc.Passed
+		}
+		if total != r.ScenarioTotal || passed != r.ScenarioPassed {
+			return fmt.Errorf("scenario_categories sum to %d/%d, want scenario_passed/scenario_total %d/%d", passed, total, r.ScenarioPassed, r.ScenarioTotal)
+		}
+	}
+
+	if len(r.FailedScenarios) == 0 {
+		return nil
+	}
+	if failed := r.ScenarioTotal - r.ScenarioPassed; len(r.FailedScenarios) != failed {
+		return fmt.Errorf("failed_scenarios lists %d scenarios, want %d", len(r.FailedScenarios), failed)
+	}
+	seen := map[string]bool{}
+	byCategory := map[string]int{}
+	for i, f := range r.FailedScenarios {
+		if f.ID == "" {
+			return fmt.Errorf("failed_scenarios[%d]: id is required", i)
+		}
+		if seen[f.ID] {
+			return fmt.Errorf("failed_scenarios[%d]: duplicate id %q", i, f.ID)
+		}
+		seen[f.ID] = true
+		if !isScenarioCategory(f.Category) {
+			return fmt.Errorf("failed_scenarios[%d]: unknown category %q (known: %s)", i, f.Category, strings.Join(scenarioCategories, "|"))
+		}
+		if !isSeverity(f.Severity) {
+			return fmt.Errorf("failed_scenarios[%d]: unknown severity %q (known: %s)", i, f.Severity, strings.Join(scenarioSeverities, "|"))
+		}
+		byCategory[f.Category]++
+	}
+	if len(r.ScenarioCategories) > 0 {
+		for _, name := range sortedCategoryKeys(r.ScenarioCategories) {
+			cc := r.ScenarioCategories[name]
+			if byCategory[name] != cc.Total-cc.Passed {
+				return errors.New("failed_scenarios categories do not match scenario_categories")
+			}
+		}
+		for name := range byCategory {
+			if _, ok := r.ScenarioCategories[name]; !ok {
+				return errors.New("failed_scenarios categories do not match scenario_categories")
+			}
+		}
+	}
+	return nil
+}
+
+func isScenarioCategory(name string) bool {
+	for _, c := range scenarioCategories {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isSeverity(name string) bool {
+	for _, s := range scenarioSeverities {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedFloatKeys(m map[string]float64) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func sortedCategoryKeys(m map[string]ScenarioCategoryCount) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,135 @@
+package level4gate
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func scenarioRecords() []EvalRecord {
+	var records []EvalRecord
+	for i := 0; i < 10; i++ {
+		class := "low_risk_feature"
+		if i%2 == 1 {
+			class = "medium_integration"
+		}
+		r := EvalRecord{
+			RunID: "r", PipelineID: "p", PipelineClass: class,
+			ScenarioTotal: 7, ScenarioPassed: 7, FirstPassSuccess: true, Retries: 1, Interventions: 1, Decision: "approved",
+			ScenarioCategories: map[string]ScenarioCategoryCount{
+				ScenarioCategoryHappyPath: {Total: 3, Passed: 3},
+				ScenarioCategoryError:     {Total: 2, Passed: 2},
+				ScenarioCategoryEdge:      {Total: 2, Passed: 2},
+			},
+		}
+		if i == 4 {
+			r.ScenarioPassed = 6
+			r.ScenarioCategories[ScenarioCategoryError] = ScenarioCategoryCount{Total: 2, Passed: 1}
+			r.FailedScenarios = []FailedScenario{{ID: "ER-2", Category: ScenarioCategoryError, Severity: SeverityMajor}}
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestComputeScenarioMetricsWeightsCategories(t *testing.T) {
+	c := DefaultCriteria()
+	c.ScenarioScoring = &ScenarioScoring{CategoryWeights: map[string]float64{ScenarioCategoryError: 3}}
+	report := EvaluateWithCriteria(scenarioRecords(), c, "w")
+	s := report.Metrics.Scenarios
+	if s == nil {
+		t.Fatalf("expected scenario metrics")
+	}
+	// 30 happy + 20 edge at weight 1, 20 error at weight 3 with one miss.
+	want := pct(30+20+3*19, 30+20+3*20)
+	if math.Abs(s.WeightedPassRatePercent-want) > 1e-9 {
+		t.Fatalf("weighted pass rate = %.4f, want %.4f", s.WeightedPassRatePercent, want)
+	}
+	if got := s.Categories[ScenarioCategoryError]; got.Total != 20 || got.Passed != 19 || got.PassRatePercent != 95 {
+		t.Fatalf("unexpected error category: %+v", got)
+	}
+	if s.FailedBySeverity[SeverityMajor] != 1 || s.UnattributedFailures != 0 {
+		t.Fatalf("unexpected severity counts: %+v", s)
+	}
+}
+
+func TestEvaluateWithCriteriaAppliesScenarioRules(t *testing.T) {
+	c := DefaultCriteria()
+	c.Thresholds.MinCategoryPassRatePercent = map[string]float64{ScenarioCategoryError: 100}
+	c.Thresholds.MaxFailedScenariosBySeverity = map[string]int{SeverityCritical: 0, SeverityMajor: 0}
+
+	report := EvaluateWithCriteria(scenarioRecords(), c, "w")
+	want := []string{
+		"error_scenario_pass_rate 95.00 < 100.00",
+		"failed_scenarios_major 1 > 0",
+	}
+	if strings.Join(report.Failures, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected failures: %v", report.Failures)
+	}
+
+	plain := scenarioRecords()
+	for i := range plain {
+		plain[i].ScenarioCategories, plain[i].FailedScenarios = nil, nil
+	}
+	report = EvaluateWithCriteria(plain, c, "w")
+	want = []string{
+		"error_scenario_pass_rate not measurable: no runs report scenario_categories[error]",
+		"failed_scenarios_critical not measurable: some failed scenarios lack failed_scenarios detail",
+		"failed_scenarios_major not measurable: some failed scenarios lack failed_scenarios detail",
+	}
+	if strings.Join(report.Failures, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected failures without detail: %v", report.Failures)
+	}
+}
+
+func TestWeightedPassRateFailsClosedOnFailedOnlyRuns(t *testing.T) {
+	floor := 90.0
+	c := DefaultCriteria()
+	c.Thresholds.MinWeightedScenarioPassRatePercent = &floor
+	records := scenarioRecords()
+	records[4].ScenarioCategories = nil
+
+	if report := EvaluateWithCriteria(records, c, "w"); !report.Passed || report.Metrics.Scenarios.UnweightableRuns != 0 {
+		t.Fatalf("expected unweighted scoring to use failed-only runs, got %v %+v", report.Failures, report.Metrics.Scenarios)
+	}
+
+	c.ScenarioScoring = &ScenarioScoring{CategoryWeights: map[string]float64{ScenarioCategoryError: 3}}
+	report := EvaluateWithCriteria(records, c, "w")
+	want := "weighted_scenario_pass_rate not measurable: 1 runs list failed_scenarios without scenario_categories"
+	if report.Passed || !strings.Contains(strings.Join(report.Failures, "\n"), want) {
+		t.Fatalf("expected %q, got %v", want, report.Failures)
+	}
+}
+
+func TestDecodeNDJSONChecksScenarioDetail(t *testing.T) {
+	base := `{"schema_version":"level4-eval-record-v0.3","window_id":"w","run_id":"r1","pipeline_id":"p1","pipeline_class":"low_risk_feature","scenario_total":7,"scenario_passed":6,"first_pass_success":true,"retries":0,"interventions":0,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"2026-02-18T20:00:00Z",`
+	cases := []struct {
+		detail string
+		err    string
+	}{
+		{`"scenario_categories":{"happy_path":{"total":3,"passed":3},"error":{"total":2,"passed":1},"edge":{"total":2,"passed":2}},"failed_scenarios":[{"id":"ER-2","category":"error","severity":"critical"}]}`, ""},
+		{`"scenario_categories":{"happy_path":{"total":3,"passed":3},"error":{"total":2,"passed":2},"edge":{"total":2,"passed":2}}}`, "scenario_categories sum to 7/7"},
+		{`"scenario_categories":{"happy":{"total":7,"passed":6}}}`, `unknown category "happy"`},
+		{`"failed_scenarios":[]}`, ""},
+		{`"failed_scenarios":[{"id":"ER-2","category":"error","severity":"critical"},{"id":"EC-1","category":"edge","severity":"minor"}]}`, "failed_scenarios lists 2 scenarios, want 1"},
+		{`"failed_scenarios":[{"id":"ER-2","category":"error","severity":"blocker"}]}`, `unknown severity "blocker"`},
+		{`"scenario_categories":{"happy_path":{"total":3,"passed":3},"error":{"total":2,"passed":1},"edge":{"total":2,"passed":2}},"failed_scenarios":[{"id":"EC-1","category":"edge","severity":"minor"}]}`, "do not match scenario_categories"},
+	}
+	for _, tc := range cases {
+		_, err := DecodeNDJSONWithOptions(strings.NewReader(base+tc.detail), DecodeOptions{Strict: true})
+		if tc.err == "" && err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.detail, err)
+		}
+		if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Fatalf("%s: expected %q, got %v", tc.detail, tc.err, err)
+		}
+	}
+}
+
+func TestDecodeCriteriaRejectsUnknownScenarioCategory(t *testing.T) {
+	in := `{"version":"v","min_runs":1,"thresholds":{"min_scenario_pass_rate_percent":90,"min_first_pass_rate_percent":70,"max_mean_retries":2,"max_decision_reversal_percent":5,"max_approved_incidents":0,"min_category_pass_rate_percent":{"errors":100}},"required_class_minimum":{}}`
+	_, err := DecodeCriteria(strings.NewReader(in))
+	if err == nil || !strings.Contains(err.Error(), `unknown category "errors"`) {
+		t.Fatalf("expected unknown category error, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package level4gate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	SchemaVersionV01 = "level4-eval-record-v0.1"
+	SchemaVersionV02 = "level4-eval-record-v0.2"
+	SchemaVersionV03 = "level4-eval-record-v0.3"
+
+	// CurrentSchemaVersion is the version every decoded record is upgraded
+	// to and the version written by MigrateNDJSON.
+	CurrentSchemaVersion = SchemaVersionV03
+)
+
+// recordSchema describes the keys of one EvalRecord schema version and how
+// a decoded record of that version is upgraded to the current shape.
+type recordSchema struct {
+	required []string
+	optional []string
+	upgrade  func(*EvalRecord)
+}
+
+var v01RequiredFields = []string{
+	"window_id",
+	"run_id",
+	"pipeline_id",
+	"pipeline_class",
+	"scenario_total",
+	"scenario_passed",
+	"first_pass_success",
+	"retries",
+	"interventions",
+	"decision",
+	"decision_reversed",
+	"critical_incident",
+	"timestamp",
+}
+
+// recordSchemas is the decoder registry keyed by schema_version. Lines
+// without schema_version are treated as v0.1. A change to the record shape
+// gets a new version: v0.2 only adds schema_version, and v0.3 adds the
+// optional economics, scenario detail and quality mode fields.
+var recordSchemas = map[string]recordSchema{
+	SchemaVersionV01: {
+		required: v01RequiredFields,
+		optional: []string{"schema_version"},
+		upgrade:  upgradeToCurrent,
+	},
+	SchemaVersionV02: {
+		required: append(append([]string{}, v01RequiredFields...), "schema_version"),
+		upgrade:  upgradeToCurrent,
+	},
+	SchemaVersionV03: {
+		required: append(append([]string{}, v01RequiredFields...), "schema_version"),
+		optional: []string{"tokens_in", "tokens_out", "cost_usd", "duration_seconds", "scenario_categories", "failed_scenarios", "quality_mode", "quality_reason"},
+		upgrade:  func(r *EvalRecord) {},
+	},
+}
+
+// upgradeToCurrent upgrades a record whose fields are a subset of the
+// current shape; the fields it lacks stay unset.
+func upgradeToCurrent(r *EvalRecord) {
+	r.SchemaVersion = CurrentSchemaVersion
+}
+
+// IsSchemaVersion reports whether v is a record schema_version the decoder
+// registry knows.
+func IsSchemaVersion(v string) bool {
+	_, ok := recordSchemas[v]
+	return ok
+}
+
+func decodeLine(raw []byte, strict bool) (EvalRecord, error) {
+	var keySet map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &keySet); err != nil {
+		return EvalRecord{}, err
+	}
+
+	version := SchemaVersionV01
+	if v, ok := keySet["schema_version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return EvalRecord{}, fmt.Errorf("schema_version must be a string")
+		}
+	}
+	schema, ok := recordSchemas[version]
+	if !ok {
+		return EvalRecord{}, fmt.Errorf("unsupported schema_version %q", version)
+	}
+
+	known := make(map[string]struct{}, len(schema.required)+len(schema.optional))
+	for _, k := range schema.required {
+		known[k] = struct{}{}
+		if _, ok := keySet[k]; !ok {
+			return EvalRecord{}, fmt.Errorf("missing required field %q", k)
+		}
+	}
+	for _, k := range schema.optional {
+		known[k] = struct{}{}
+	}
+	// Keys the declared version does not define are an error in strict
+	// mode and dropped otherwise, so a v0.1 line carrying cost_usd does not
+	// feed the economics rules.
+	dropped := false
+	for _, k := range sortedRawKeys(keySet) {
+		if _, ok := known[k]; ok {
+			continue
+		}
+		if strict {
+			return EvalRecord{}, fmt.Errorf("unknown field %q", k)
+		}
+		delete(keySet, k)
+		dropped = true
+	}
+	if dropped {
+		b, err := json.Marshal(keySet)
+		if err != nil {
+			return EvalRecord{}, err
+		}
+		raw = b
+	}
+
+	var rec EvalRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return EvalRecord{}, err
+	}
+	rec.SchemaVersion = version
+	schema.upgrade(&rec)
+	return rec, nil
+}
+
+// MigrateNDJSON rewrites every record in r as CurrentSchemaVersion and
+// returns the number of records written. Decoding is strict so no field is
+// dropped silently; blank lines are removed.
+func MigrateNDJSON(r io.Reader, w io.Writer) (int, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	bw := bufio.NewWriter(w)
+
+	line := 0
+	count := 0
+	for sc.Scan() {
+		line++
+		raw := sc.Bytes()
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		rec, err := decodeLine(raw, true)
+		if err != nil {
+			return count, fmt.Errorf("line %d: %w", line, err)
+		}
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return count, err
+		}
+		if _, err := bw.Write(append(b, '\n')); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := sc.Err(); err != nil {
+		return count, err
+	}
+	return count, bw.Flush()
+}
+
+func sortedRawKeys(m map[string]json.RawMessage) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
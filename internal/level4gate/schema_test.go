@@ -0,0 +1,181 @@
+package level4gate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rickhallett/darkfactorio/internal/jsonschema"
+	"github.com/rickhallett/darkfactorio/schemas"
+)
+
+const v01Line = `{"window_id":"w","run_id":"r1","pipeline_id":"p1","pipeline_class":"low_risk_feature","scenario_total":10,"scenario_passed":10,"first_pass_success":true,"retries":0,"interventions":0,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"2026-02-18T20:00:00Z"}`
+
+func TestDecodeNDJSONUpgradesV01Records(t *testing.T) {
+	recs, err := DecodeNDJSON(strings.NewReader(v01Line), "w")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if recs[0].SchemaVersion != CurrentSchemaVersion {
+		t.Fatalf("expected upgrade to %s, got %q", CurrentSchemaVersion, recs[0].SchemaVersion)
+	}
+}
+
+func TestDecodeNDJSONIgnoresUnknownFieldsUnlessStrict(t *testing.T) {
+	in := strings.Replace(v01Line, `{"window_id"`, `{"schema_version":"level4-eval-record-v0.2","emitter":"ci-7","window_id"`, 1)
+	recs, err := DecodeNDJSON(strings.NewReader(in), "w")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("expected one record, got %d", len(recs))
+	}
+
+	_, err = DecodeNDJSONWithOptions(strings.NewReader(in), DecodeOptions{Strict: true})
+	if err == nil || !strings.Contains(err.Error(), `unknown field "emitter"`) {
+		t.Fatalf("expected strict unknown field error, got %v", err)
+	}
+}
+
+func TestDecodeNDJSONIgnoresFieldsTheDeclaredVersionLacks(t *testing.T) {
+	extra := `,"cost_usd":12.5,"quality_mode":"high","quality_reason":"flaky fixture"}`
+	for _, prefix := range []string{`{`, `{"schema_version":"level4-eval-record-v0.2",`} {
+		in := strings.Replace(v01Line, `{`, prefix, 1)
+		in = strings.TrimSuffix(in, "}") + extra
+		recs, err := DecodeNDJSON(strings.NewReader(in), "w")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", prefix, err)
+		}
+		if r := recs[0]; r.CostUSD != nil || r.QualityMode != "" || r.QualityReason != "" || r.SchemaVersion != CurrentSchemaVersion {
+			t.Fatalf("%s: expected v0.3 fields to be dropped, got %+v", prefix, r)
+		}
+		if _, err := DecodeNDJSONWithOptions(strings.NewReader(in), DecodeOptions{Strict: true}); err == nil || !strings.Contains(err.Error(), `unknown field "cost_usd"`) {
+			t.Fatalf("%s: expected strict unknown field error, got %v", prefix, err)
+		}
+	}
+
+	in := strings.Replace(v01Line, `{`, `{"schema_version":"`+SchemaVersionV03+`",`, 1)
+	recs, err := DecodeNDJSONWithOptions(strings.NewReader(strings.TrimSuffix(in, "}")+extra), DecodeOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r := recs[0]; r.CostUSD == nil || *r.CostUSD != 12.5 || r.QualityMode != QualityHigh {
+		t.Fatalf("expected v0.3 fields to be kept, got %+v", r)
+	}
+}
+
+func TestDecodeNDJSONRejectsUnsupportedSchemaVersion(t *testing.T) {
+	in := strings.Replace(v01Line, `{"window_id"`, `{"schema_version":"level4-eval-record-v9","window_id"`, 1)
+	_, err := DecodeNDJSON(strings.NewReader(in), "")
+	if err == nil || !strings.Contains(err.Error(), `line 1: unsupported schema_version "level4-eval-record-v9"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for v, want := range map[string]bool{SchemaVersionV01: true, SchemaVersionV02: true, SchemaVersionV03: true, "level4-eval-record-v9": false, "../run-envelope-v0.1": false} {
+		if IsSchemaVersion(v) != want {
+			t.Fatalf("IsSchemaVersion(%q) = %v, want %v", v, !want, want)
+		}
+	}
+}
+
+func TestMigrateNDJSONRewritesToCurrentVersion(t *testing.T) {
+	var out bytes.Buffer
+	second := strings.Replace(v01Line, `"run_id":"r1"`, `"run_id":"r2"`, 1)
+	n, err := MigrateNDJSON(strings.NewReader(v01Line+"\n\n"+second+"\n"), &out)
+	if err != nil {
+		t.Fatalf("MigrateNDJSON failed: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 migrated records, got %d", n)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"schema_version":"`+CurrentSchemaVersion+`",`) {
+		t.Fatalf("unexpected migrated output: %s", out.String())
+	}
+
+	recs, err := DecodeNDJSONWithOptions(&out, DecodeOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("migrated output must decode strictly: %v", err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(recs))
+	}
+}
+
+// TestGoDecodersAgreeWithSchemas runs the same documents through the Go
+// decoders and the embedded JSON schemas, so neither drifts from the other.
+func TestGoDecodersAgreeWithSchemas(t *testing.T) {
+	v03 := `{"schema_version":"level4-eval-record-v0.3","window_id":"w","run_id":"r1","pipeline_id":"p1","pipeline_class":"low_risk_feature","scenario_total":10,"scenario_passed":9,"first_pass_success":false,"retries":1,"interventions":0,"decision":"approved","decision_reversed":false,"critical_incident":false,"timestamp":"2026-02-18T20:00:00Z","cost_usd":1.5,"quality_mode":"standard"}`
+	records := []struct {
+		name  string
+		line  string
+		valid bool
+	}{
+		{"v0.1", v01Line, true},
+		{"v0.3", v03, true},
+		{"missing run_id", strings.Replace(v01Line, `"run_id":"r1",`, "", 1), false},
+		{"empty pipeline_id", strings.Replace(v01Line, `"pipeline_id":"p1"`, `"pipeline_id":""`, 1), false},
+		{"negative retries", strings.Replace(v01Line, `"retries":0`, `"retries":-1`, 1), false},
+		{"no scenarios", strings.Replace(v01Line, `"scenario_total":10`, `"scenario_total":0`, 1), false},
+		{"unknown decision", strings.Replace(v01Line, `"approved"`, `"maybe"`, 1), false},
+		{"bad timestamp", strings.Replace(v01Line, `2026-02-18T20:00:00Z`, `yesterday`, 1), false},
+		{"unknown field", strings.Replace(v01Line, `"retries":0`, `"retries":0,"colour":"red"`, 1), false},
+		{"v0.1 with cost", strings.Replace(v01Line, `"retries":0`, `"retries":0,"cost_usd":1`, 1), false},
+		{"negative cost", strings.Replace(v03, `"cost_usd":1.5`, `"cost_usd":-1`, 1), false},
+		{"unknown quality mode", strings.Replace(v03, `"standard"`, `"turbo"`, 1), false},
+	}
+	for _, tc := range records {
+		t.Run("record/"+tc.name, func(t *testing.T) {
+			rec, goErr := decodeLine([]byte(tc.line), true)
+			if goErr == nil {
+				goErr = validateRecord(rec, DefaultPipelineClasses())
+			}
+			version := SchemaVersionV01
+			if strings.Contains(tc.line, `"schema_version"`) {
+				version = SchemaVersionV03
+			}
+			schemaErrs := validateAgainstSchema(t, version+".json", tc.line)
+			if (goErr == nil) != tc.valid || (len(schemaErrs) == 0) != tc.valid {
+				t.Fatalf("want valid=%v; Go decoder: %v; schema: %v", tc.valid, goErr, schemaErrs)
+			}
+		})
+	}
+
+	base := `{"version":"v","min_runs":5,"thresholds":{"min_scenario_pass_rate_percent":90,"min_first_pass_rate_percent":70,"max_mean_retries":1,"max_decision_reversal_percent":5,"max_approved_incidents":0},"required_class_minimum":{"low_risk_feature":1}}`
+	criteria := []struct {
+		name  string
+		doc   string
+		valid bool
+	}{
+		{"minimal", base, true},
+		{"halves trend", strings.Replace(base, `"min_runs":5`, `"min_runs":5,"intervention_trend":{"method":"halves"}`, 1), true},
+		{"missing version", strings.Replace(base, `"version":"v",`, "", 1), false},
+		{"zero min_runs", strings.Replace(base, `"min_runs":5`, `"min_runs":0`, 1), false},
+		{"pass rate over 100", strings.Replace(base, `"min_scenario_pass_rate_percent":90`, `"min_scenario_pass_rate_percent":120`, 1), false},
+		{"negative retries", strings.Replace(base, `"max_mean_retries":1`, `"max_mean_retries":-1`, 1), false},
+		{"missing threshold", strings.Replace(base, `"max_approved_incidents":0`, `"max_cost_per_approved_run_usd":1`, 1), false},
+		{"unknown trend method", strings.Replace(base, `"min_runs":5`, `"min_runs":5,"intervention_trend":{"method":"vibes"}`, 1), false},
+		{"unknown field", strings.Replace(base, `"min_runs":5`, `"min_runs":5,"colour":"red"`, 1), false},
+	}
+	for _, tc := range criteria {
+		t.Run("criteria/"+tc.name, func(t *testing.T) {
+			_, goErr := DecodeCriteria(strings.NewReader(tc.doc))
+			schemaErrs := validateAgainstSchema(t, "level4-gate-criteria-v0.1.json", tc.doc)
+			if (goErr == nil) != tc.valid || (len(schemaErrs) == 0) != tc.valid {
+				t.Fatalf("want valid=%v; Go decoder: %v; schema: %v", tc.valid, goErr, schemaErrs)
+			}
+		})
+	}
+}
+
+func validateAgainstSchema(t *testing.T, name, doc string) []jsonschema.ValidationError {
+	t.Helper()
+	schema, err := jsonschema.LoadFS(schemas.FS, name)
+	if err != nil {
+		t.Fatalf("loading schema %s: %v", name, err)
+	}
+	errs, err := schema.ValidateJSON([]byte(doc))
+	if err != nil {
+		t.Fatalf("validating against %s: %v", name, err)
+	}
+	return errs
+}
@@ -0,0 +1,254 @@
+package level4gate
+
+import (
+	"math"
+	"sort"
+)
+
+// Interval is a two-sided confidence interval expressed in percent.
+type Interval struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+// Spans reports whether a floor threshold v cannot be decided by the
+// interval: the lower bound falls short of v but the upper bound reaches it.
+func (i Interval) Spans(v float64) bool {
+	return i.Lower < v && v <= i.Upper
+}
+
+// wilsonInterval returns the Wilson score interval for k successes out of n
+// trials at the given two-sided confidence level, in percent.
+func wilsonInterval(k, n int, level float64) Interval {
+	if n <= 0 {
+		return Interval{Lower: 0, Upper: 100}
+	}
+	z := zScore(level)
+	nf := float64(n)
+	p := float64(k) / nf
+	z2 := z * z
+	denom := 1 + z2/nf
+	center := (p + z2/(2*nf)) / denom
+	half := z * math.Sqrt(p*(1-p)/nf+z2/(4*nf*nf)) / denom
+	return Interval{
+		Lower: math.Max(0, center-half) * 100,
+		Upper: math.Min(1, center+half) * 100,
+	}
+}
+
+// zScore returns the standard normal quantile for a two-sided confidence
+// level, e.g. 1.96 for 0.95.
+func zScore(level float64) float64 {
+	return math.Sqrt2 * math.Erfinv(level)
+}
+
+// leastSquaresSlope fits y against its index and returns the slope together
+// with the one-sided p-value of a t-test for a positive slope.
+func leastSquaresSlope(ys []float64) (slope, pValue float64) {
+	n := len(ys)
+	if n < 2 {
+		return 0, 1
+	}
+	nf := float64(n)
+	xMean := (nf - 1) / 2
+	yMean := 0.0
+	for _, y := range ys {
+		yMean += y
+	}
+	yMean /= nf
+
+	var sxx, sxy float64
+	for i, y := range ys {
+		dx := float64(i) - xMean
+		sxx += dx * dx
+		sxy += dx * (y - yMean)
+	}
+	slope = sxy / sxx
+	if n < 3 {
+		return slope, 1
+	}
+
+	intercept := yMean - slope*xMean
+	var sse float64
+	for i, y := range ys {
+		r := y - (intercept + slope*float64(i))
+		sse += r * r
+	}
+	if sse == 0 {
+		if slope > 0 {
+			return slope, 0
+		}
+		return slope, 1
+	}
+	se := math.Sqrt(sse / (nf - 2) / sxx)
+	return slope, studentTUpperTail(slope/se, nf-2)
+}
+
+// mannKendall returns the Mann-Kendall S statistic for ys and the one-sided
+// p-value for an increasing trend, using the normal approximation with the
+// tie-corrected variance. S is counted with a merge sort in O(n log n) so
+// windows with millions of runs stay tractable.
+func mannKendall(ys []float64) (s int, pValue float64) {
+	n := len(ys)
+	work := append([]float64(nil), ys...)
+	s = kendallS(work, make([]float64, n))
+
+	ties := map[float64]int{}
+	for _, y := range ys {
+		ties[y]++
+	}
+	nf := float64(n)
+	variance := nf * (nf - 1) * (2*nf + 5)
+	for _, t := range ties {
+		tf := float64(t)
+		variance -= tf * (tf - 1) * (2*tf + 5)
+	}
+	variance /= 18
+	if variance <= 0 {
+		return s, 1
+	}
+
+	var z float64
+	switch {
+	case s > 0:
+		z = float64(s-1) / math.Sqrt(variance)
+	case s < 0:
+		z = float64(s+1) / math.Sqrt(variance)
+	}
+	return s, 0.5 * math.Erfc(z/math.Sqrt2)
+}
+
+// kendallS sorts ys in place and returns the number of pairs i < j with
+// ys[i] < ys[j] minus the number with ys[i] > ys[j]. buf must be as long as
+// ys.
+func kendallS(ys, buf []float64) int {
+	n := len(ys)
+	if n < 2 {
+		return 0
+	}
+	mid := n / 2
+	s := kendallS(ys[:mid], buf[:mid]) + kendallS(ys[mid:], buf[mid:])
+
+	left, right := ys[:mid], ys[mid:]
+	// For each right element, count left elements strictly below and
+	// strictly above it; both pointers only move forward because right is
+	// sorted.
+	below, notAbove := 0, 0
+	for _, r := range right {
+		for below < len(left) && left[below] < r {
+			below++
+		}
+		for notAbove < len(left) && left[notAbove] <= r {
+			notAbove++
+		}
+		s += below - (len(left) - notAbove)
+	}
+
+	merged := buf[:0]
+	i, j := 0, 0
+	for i < len(left) && j < len(right) {
+		if left[i] <= right[j] {
+			merged = append(merged, left[i])
+			i++
+		} else {
+			merged = append(merged, right[j])
+			j++
+		}
+	}
+	merged = append(merged, left[i:]...)
+	merged = append(merged, right[j:]...)
+	copy(ys, merged)
+	return s
+}
+
+// studentTUpperTail returns P(T > t) for Student's t distribution with df
+// degrees of freedom.
+func studentTUpperTail(t, df float64) float64 {
+	tail := 0.5 * regularizedIncompleteBeta(df/(df+t*t), df/2, 0.5)
+	if t < 0 {
+		return 1 - tail
+	}
+	return tail
+}
+
+// regularizedIncompleteBeta evaluates I_x(a, b) with the continued fraction
+// from Numerical Recipes.
+func regularizedIncompleteBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(x, a, b) / a
+	}
+	return 1 - front*betaContinuedFraction(1-x, b, a)/b
+}
+
+func betaContinuedFraction(x, a, b float64) float64 {
+	const (
+		maxIter = 200
+		eps     = 3e-14
+		tiny    = 1e-300
+	)
+	qab := a + b
+	qap := a + 1
+	qam := a - 1
+	c := 1.0
+	d := 1 - qab*x/qap
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIter; m++ {
+		mf := float64(m)
+		m2 := 2 * mf
+		aa := mf * (b - mf) * x / ((qam + m2) * (a + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		aa = -(a + mf) * (qab + mf) * x / ((a + m2) * (qap + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < eps {
+			break
+		}
+	}
+	return h
+}
+
+// percentile returns the nearest-rank p-th percentile (0 < p <= 100) of
+// values. values is sorted in place.
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	rank := int(math.Ceil(p / 100 * float64(len(values))))
+	if rank < 1 {
+		rank = 1
+	}
+	return values[rank-1]
+}
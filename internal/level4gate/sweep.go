@@ -0,0 +1,163 @@
+package level4gate
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxSweepValues bounds one parameter's range so a tiny step does not
+// produce millions of settings.
+const maxSweepValues = 1000
+
+// Sweep is one criteria parameter and the values to try for it, in
+// ascending order.
+type Sweep struct {
+	Parameter string    `json:"parameter"`
+	Values    []float64 `json:"values"`
+}
+
+// sweepParameter sets one criteria value. Integer parameters reject
+// fractional values; min and max are the inclusive bounds of
+// schemas/level4-gate-criteria-v0.1.json.
+type sweepParameter struct {
+	integer  bool
+	min, max float64
+	set      func(c *Criteria, v float64)
+}
+
+var (
+	percent  = sweepParameter{min: 0, max: 100}
+	nonNeg   = sweepParameter{min: 0, max: math.Inf(1)}
+	count    = sweepParameter{integer: true, min: 0, max: math.Inf(1)}
+	positive = sweepParameter{integer: true, min: 1, max: math.Inf(1)}
+)
+
+func (p sweepParameter) with(set func(c *Criteria, v float64)) sweepParameter {
+	p.set = set
+	return p
+}
+
+var sweepParameters = map[string]sweepParameter{
+	"min_runs":                       positive.with(func(c *Criteria, v float64) { c.MinRuns = int(v) }),
+	"min_scenario_pass_rate_percent": percent.with(func(c *Criteria, v float64) { c.Thresholds.MinScenarioPassRatePercent = v }),
+	"min_first_pass_rate_percent":    percent.with(func(c *Criteria, v float64) { c.Thresholds.MinFirstPassRatePercent = v }),
+	"max_mean_retries":               nonNeg.with(func(c *Criteria, v float64) { c.Thresholds.MaxMeanRetries = v }),
+	"max_decision_reversal_percent":  percent.with(func(c *Criteria, v float64) { c.Thresholds.MaxDecisionReversalPercent = v }),
+	"max_approved_incidents":         count.with(func(c *Criteria, v float64) { c.Thresholds.MaxApprovedIncidents = int(v) }),
+	"max_cost_per_approved_run_usd":  nonNeg.with(func(c *Criteria, v float64) { c.Thresholds.MaxCostPerApprovedRunUSD = &v }),
+	"max_p95_duration_seconds":       nonNeg.with(func(c *Criteria, v float64) { c.Thresholds.MaxP95DurationSeconds = &v }),
+	"min_weighted_scenario_pass_rate_percent": percent.with(func(c *Criteria, v float64) {
+		c.Thresholds.MinWeightedScenarioPassRatePercent = &v
+	}),
+	"max_remediation_share_percent": percent.with(func(c *Criteria, v float64) { c.Thresholds.MaxRemediationSharePercent = &v }),
+}
+
+// SweepParameters returns the criteria parameters a Sweep can vary. They
+// are the window-level thresholds plus min_runs; class_thresholds that
+// override a swept value keep their own value.
+func SweepParameters() []string {
+	out := make([]string, 0, len(sweepParameters))
+	for k := range sweepParameters {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ParseSweep parses "name=start:end:step" (end inclusive) or
+// "name=v1,v2,...". Values are returned sorted and de-duplicated. NaN,
+// infinities and values outside the parameter's range are rejected.
+func ParseSweep(spec string) (Sweep, error) {
+	name, raw, ok := strings.Cut(spec, "=")
+	if !ok || name == "" || raw == "" {
+		return Sweep{}, fmt.Errorf("sweep %q: want name=start:end:step or name=v1,v2", spec)
+	}
+	p, ok := sweepParameters[name]
+	if !ok {
+		return Sweep{}, fmt.Errorf("sweep %q: unknown parameter %q (known: %s)", spec, name, strings.Join(SweepParameters(), "|"))
+	}
+
+	var values []float64
+	if strings.Contains(raw, ":") {
+		parts := strings.Split(raw, ":")
+		if len(parts) != 3 {
+			return Sweep{}, fmt.Errorf("sweep %q: range must be start:end:step", spec)
+		}
+		var nums [3]float64
+		for i, part := range parts {
+			v, err := strconv.ParseFloat(part, 64)
+			if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+				return Sweep{}, fmt.Errorf("sweep %q: %q is not a finite number", spec, part)
+			}
+			nums[i] = v
+		}
+		start, end, step := nums[0], nums[1], nums[2]
+		if step <= 0 || end < start {
+			return Sweep{}, fmt.Errorf("sweep %q: need start <= end and a positive step", spec)
+		}
+		n := int(math.Floor((end-start)/step+1e-9)) + 1
+		if n > maxSweepValues {
+			return Sweep{}, fmt.Errorf("sweep %q: %d values (max %d); use a larger step", spec, n, maxSweepValues)
+		}
+		for i := 0; i < n; i++ {
+			// Round away float noise from repeated steps, e.g. 0.1*3.
+			values = append(values, math.Round((start+float64(i)*step)*1e9)/1e9)
+		}
+	} else {
+		for _, part := range strings.Split(raw, ",") {
+			v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+				return Sweep{}, fmt.Errorf("sweep %q: %q is not a finite number", spec, part)
+			}
+			values = append(values, v)
+		}
+		if len(values) > maxSweepValues {
+			return Sweep{}, fmt.Errorf("sweep %q: %d values (max %d)", spec, len(values), maxSweepValues)
+		}
+	}
+
+	sort.Float64s(values)
+	out := values[:0]
+	for _, v := range values {
+		if len(out) > 0 && v == out[len(out)-1] {
+			continue
+		}
+		if p.integer && v != math.Trunc(v) {
+			return Sweep{}, fmt.Errorf("sweep %q: %s takes whole numbers, got %v", spec, name, v)
+		}
+		if v < p.min || v > p.max {
+			return Sweep{}, fmt.Errorf("sweep %q: %s must be %s, got %v", spec, name, p.bounds(), v)
+		}
+		out = append(out, v)
+	}
+	return Sweep{Parameter: name, Values: out}, nil
+}
+
+func (p sweepParameter) bounds() string {
+	if math.IsInf(p.max, 1) {
+		return fmt.Sprintf(">= %v", p.min)
+	}
+	return fmt.Sprintf("between %v and %v", p.min, p.max)
+}
+
+// WithParameter returns a copy of c with the named parameter set to v and
+// validates the result, so a swept setting is held to the same rules as a
+// loaded profile. The copy shares c's maps, which the sweepable parameters
+// do not touch.
+func (c Criteria) WithParameter(name string, v float64) (Criteria, error) {
+	p, ok := sweepParameters[name]
+	if !ok {
+		return Criteria{}, fmt.Errorf("unknown sweep parameter %q", name)
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) || v < p.min || v > p.max || (p.integer && v != math.Trunc(v)) {
+		return Criteria{}, fmt.Errorf("%s must be a finite %s, got %v", name, p.bounds(), v)
+	}
+	p.set(&c, v)
+	if err := c.validate(); err != nil {
+		return Criteria{}, fmt.Errorf("%s=%v: %w", name, v, err)
+	}
+	return c, nil
+}
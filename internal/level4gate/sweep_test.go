@@ -0,0 +1,84 @@
+package level4gate
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSweep(t *testing.T) {
+	cases := map[string][]float64{
+		"min_scenario_pass_rate_percent=90:96:2": {90, 92, 94, 96},
+		"max_mean_retries=0.1:0.3:0.1":           {0.1, 0.2, 0.3},
+		"max_mean_retries=2,1,1.5,1":             {1, 1.5, 2},
+		"min_runs=10:15:10":                      {10},
+	}
+	for spec, want := range cases {
+		s, err := ParseSweep(spec)
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		if !reflect.DeepEqual(s.Values, want) {
+			t.Fatalf("%s: got %v, want %v", spec, s.Values, want)
+		}
+	}
+
+	errs := map[string]string{
+		"max_mean_retries":                      "want name=start:end:step",
+		"min_pass=1:2:1":                        `unknown parameter "min_pass"`,
+		"max_mean_retries=3:1:1":                "need start <= end and a positive step",
+		"max_mean_retries=0:1:0":                "need start <= end and a positive step",
+		"max_mean_retries=0:1":                  "range must be start:end:step",
+		"min_runs=10:11:0.5":                    "min_runs takes whole numbers, got 10.5",
+		"max_mean_retries=0:1:0.0001":           "10001 values (max 1000)",
+		"max_mean_retries=NaN":                  `"NaN" is not a finite number`,
+		"max_mean_retries=0:Inf:1":              `"Inf" is not a finite number`,
+		"min_scenario_pass_rate_percent=95,105": "min_scenario_pass_rate_percent must be between 0 and 100, got 105",
+		"max_mean_retries=-1:1:1":               "max_mean_retries must be >= 0, got -1",
+		"min_runs=0,10":                         "min_runs must be >= 1, got 0",
+	}
+	for spec, want := range errs {
+		if _, err := ParseSweep(spec); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: error = %v, want %q", spec, err, want)
+		}
+	}
+}
+
+func TestReportWithAppliesSweptCriteria(t *testing.T) {
+	acc := NewAccumulator(DefaultCriteria())
+	for _, r := range reversalWindow() {
+		acc.Add(r)
+	}
+	if !acc.Report("w").Passed {
+		t.Fatalf("expected the window to pass under default criteria")
+	}
+	strict, err := DefaultCriteria().WithParameter("max_mean_retries", 0.5)
+	if err != nil {
+		t.Fatalf("WithParameter failed: %v", err)
+	}
+	r := acc.ReportWith("w", strict)
+	if r.Passed || !containsString(r.Failures, "mean_retries 1.00 > 0.50") {
+		t.Fatalf("expected mean_retries to fail, got %v", r.Failures)
+	}
+	if !acc.Report("w").Passed {
+		t.Fatalf("ReportWith must not change the accumulator's own criteria")
+	}
+}
+
+func TestWithParameterValidatesSetting(t *testing.T) {
+	c := DefaultCriteria()
+	for name, v := range map[string]float64{
+		"max_mean_retries":              math.NaN(),
+		"max_remediation_share_percent": 101,
+		"min_runs":                      0.5,
+	} {
+		if _, err := c.WithParameter(name, v); err == nil {
+			t.Fatalf("%s=%v: expected an error", name, v)
+		}
+	}
+	got, err := c.WithParameter("max_remediation_share_percent", 25)
+	if err != nil || got.Thresholds.MaxRemediationSharePercent == nil || *got.Thresholds.MaxRemediationSharePercent != 25 {
+		t.Fatalf("unexpected setting %+v: %v", got.Thresholds, err)
+	}
+}
@@ -31,17 +31,21 @@ type ScenarioResult struct {
 }
 
 type Report struct {
-	PackID                     string   `json:"pack_id"`
-	Passed                     bool     `json:"passed"`
-	OverlapCount               int      `json:"overlap_count"`
-	CandidateOnlyCount         int      `json:"candidate_only_count"`
-	HoldoutOnlyCount           int      `json:"holdout_only_count"`
-	OutcomeMismatchCount       int      `json:"outcome_mismatch_count"`
-	OutcomeMismatchRatePercent float64  `json:"outcome_mismatch_rate_percent"`
-	CandidateP95LatencyMs      float64  `json:"candidate_p95_latency_ms"`
-	HoldoutP95LatencyMs        float64  `json:"holdout_p95_latency_ms"`
-	P95LatencyDriftPercent     float64  `json:"p95_latency_drift_percent"`
-	Failures                   []string `json:"failures"`
+	PackID                     string  `json:"pack_id"`
+	Passed                     bool    `json:"passed"`
+	OverlapCount               int     `json:"overlap_count"`
+	CandidateOnlyCount         int     `json:"candidate_only_count"`
+	HoldoutOnlyCount           int     `json:"holdout_only_count"`
+	OutcomeMismatchCount       int     `json:"outcome_mismatch_count"`
+	OutcomeMismatchRatePercent float64 `json:"outcome_mismatch_rate_percent"`
+	CandidateP95LatencyMs      float64 `json:"candidate_p95_latency_ms"`
+	HoldoutP95LatencyMs        float64 `json:"holdout_p95_latency_ms"`
+	P95LatencyDriftPercent     float64 `json:"p95_latency_drift_percent"`
+	// Checks names the criteria that held. Each failure starts with the
+	// name of the criterion it breaks, so the two lists cover every
+	// criterion between them.
+	Checks   []string `json:"checks"`
+	Failures []string `json:"failures"`
 }
 
 func Evaluate(root, manifestPath string) (Report, error) {
@@ -55,16 +59,22 @@ func Evaluate(root, manifestPath string) (Report, error) {
 	r := Report{
 		PackID:   m.PackID,
 		Passed:   true,
+		Checks:   []string{},
 		Failures: []string{},
 	}
+	check := func(name string, ok bool, failure string) {
+		if ok {
+			r.Checks = append(r.Checks, name)
+			return
+		}
+		r.Passed = false
+		r.Failures = append(r.Failures, failure)
+	}
 
 	if m.CandidateProducer == "" || m.HoldoutProducer == "" {
 		return Report{}, fmt.Errorf("candidate_producer and holdout_producer are required")
 	}
-	if m.CandidateProducer == m.HoldoutProducer {
-		r.Passed = false
-		r.Failures = append(r.Failures, "candidate_producer must differ from holdout_producer")
-	}
+	check("candidate_producer", m.CandidateProducer != m.HoldoutProducer, "candidate_producer must differ from holdout_producer")
 
 	cand, err := loadJSON[[]ScenarioResult](filepath.Join(root, m.CandidateResults))
 	if err != nil {
@@ -120,18 +130,12 @@ func Evaluate(root, manifestPath string) (Report, error) {
 		r.P95LatencyDriftPercent = math.Abs(r.CandidateP95LatencyMs-r.HoldoutP95LatencyMs) / r.HoldoutP95LatencyMs * 100
 	}
 
-	if r.OverlapCount < m.Criteria.MinOverlap {
-		r.Passed = false
-		r.Failures = append(r.Failures, fmt.Sprintf("overlap_count %d < %d", r.OverlapCount, m.Criteria.MinOverlap))
-	}
-	if r.OutcomeMismatchRatePercent > m.Criteria.MaxOutcomeMismatchRatePercent {
-		r.Passed = false
-		r.Failures = append(r.Failures, fmt.Sprintf("outcome_mismatch_rate %.2f > %.2f", r.OutcomeMismatchRatePercent, m.Criteria.MaxOutcomeMismatchRatePercent))
-	}
-	if r.P95LatencyDriftPercent > m.Criteria.MaxP95LatencyDriftPercent {
-		r.Passed = false
-		r.Failures = append(r.Failures, fmt.Sprintf("p95_latency_drift %.2f > %.2f", r.P95LatencyDriftPercent, m.Criteria.MaxP95LatencyDriftPercent))
-	}
+	check("overlap_count", r.OverlapCount >= m.Criteria.MinOverlap,
+		fmt.Sprintf("overlap_count %d < %d", r.OverlapCount, m.Criteria.MinOverlap))
+	check("outcome_mismatch_rate", r.OutcomeMismatchRatePercent <= m.Criteria.MaxOutcomeMismatchRatePercent,
+		fmt.Sprintf("outcome_mismatch_rate %.2f > %.2f", r.OutcomeMismatchRatePercent, m.Criteria.MaxOutcomeMismatchRatePercent))
+	check("p95_latency_drift", r.P95LatencyDriftPercent <= m.Criteria.MaxP95LatencyDriftPercent,
+		fmt.Sprintf("p95_latency_drift %.2f > %.2f", r.P95LatencyDriftPercent, m.Criteria.MaxP95LatencyDriftPercent))
 	return r, nil
 }
 
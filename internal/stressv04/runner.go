@@ -62,7 +62,7 @@ func checkDataContractFuzz(root string) (bool, string) {
 	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
 		return false, err.Error()
 	}
-	_, err := level4gate.LoadNDJSON(path, "")
+	_, err := level4gate.LoadNDJSONWithOptions(path, level4gate.DecodeOptions{Strict: true})
 	if err == nil {
 		return false, "expected unknown field validation failure"
 	}
@@ -147,7 +147,7 @@ func checkCorpusDegradation(root string) (bool, string) {
 	if err := appendNDJSON(dst2, degrade); err != nil {
 		return false, err.Error()
 	}
-	criteria, err := loadCriteria(filepath.Join(root, "profiles/level4-gate-v0.1-adversarial.json"))
+	criteria, err := level4gate.LoadCriteria(filepath.Join(root, "profiles/level4-gate-v0.1-adversarial.json"))
 	if err != nil {
 		return false, err.Error()
 	}
@@ -311,6 +311,7 @@ func checkQualityGuardrail(root string) (bool, string) {
 	_, err := dfwindow.Advance(dfwindow.AdvanceOptions{
 		Root:                td,
 		WindowID:            "w-guard",
+		Synthetic:           true,
 		RunsPath:            "runs/w-guard.ndjson",
 		AppendCount:         1,
 		BaselineCriteria:    "profiles/level4-gate-v0.1-baseline.json",
@@ -325,6 +326,7 @@ func checkQualityGuardrail(root string) (bool, string) {
 	_, err = dfwindow.Advance(dfwindow.AdvanceOptions{
 		Root:                td,
 		WindowID:            "w-guard",
+		Synthetic:           true,
 		RunsPath:            "runs/w-guard.ndjson",
 		AppendCount:         1,
 		BaselineCriteria:    "profiles/level4-gate-v0.1-baseline.json",
@@ -413,14 +415,6 @@ func relFrom(root, abs string) string {
 	return r
 }
 
-func loadCriteria(path string) (level4gate.Criteria, error) {
-	var c level4gate.Criteria
-	if err := readJSON(path, &c); err != nil {
-		return c, err
-	}
-	return c, nil
-}
-
 func readJSON(path string, out any) error {
 	f, err := os.Open(path)
 	if err != nil {
@@ -458,18 +452,7 @@ func writeNDJSON(path string, recs []level4gate.EvalRecord) error {
 }
 
 func appendNDJSON(path string, recs []level4gate.EvalRecord) error {
-	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	enc := json.NewEncoder(f)
-	for _, r := range recs {
-		if err := enc.Encode(r); err != nil {
-			return err
-		}
-	}
-	return nil
+	return dfwindow.AppendRecords(path, recs)
 }
 
 func generateRecords(window string, start int, n int, high bool) []level4gate.EvalRecord {
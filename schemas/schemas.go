@@ -0,0 +1,10 @@
+// Package schemas embeds the checked-in JSON schemas, so tools validate
+// against the schemas they were built with when no directory is given.
+package schemas
+
+import "embed"
+
+// FS holds every *.json schema in this directory, by file name.
+//
+//go:embed *.json
+var FS embed.FS